@@ -3,15 +3,25 @@ module github.com/alx696/libp2p/go-dht-fire
 go 1.14
 
 require (
-	github.com/libp2p/go-libp2p v0.8.3
+	github.com/ipfs/go-cid v0.0.5
+	github.com/libp2p/go-libp2p v0.9.0
+	github.com/libp2p/go-libp2p-autonat v0.2.3
 	github.com/libp2p/go-libp2p-autonat-svc v0.1.0
 	github.com/libp2p/go-libp2p-connmgr v0.2.3
 	github.com/libp2p/go-libp2p-core v0.5.6
+	github.com/libp2p/go-libp2p-discovery v0.4.0
 	github.com/libp2p/go-libp2p-kad-dht v0.7.11
+	github.com/libp2p/go-libp2p-kbucket v0.4.1
 	github.com/libp2p/go-libp2p-peerstore v0.2.4 // indirect; Fix https://github.com/libp2p/go-libp2p/issues/932
 	github.com/libp2p/go-libp2p-quic-transport v0.3.7
 	github.com/libp2p/go-libp2p-secio v0.2.2
+	github.com/libp2p/go-libp2p-swarm v0.2.4
 	github.com/libp2p/go-libp2p-tls v0.1.3
+	github.com/libp2p/go-libp2p-transport-upgrader v0.3.0
 	github.com/libp2p/go-nat v0.0.5
 	github.com/multiformats/go-multiaddr v0.2.2
+	github.com/multiformats/go-multiaddr-net v0.1.5
+	github.com/multiformats/go-multistream v0.1.1
+	go.uber.org/multierr v1.5.0
+	gopkg.in/yaml.v2 v2.2.4
 )
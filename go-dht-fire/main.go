@@ -4,18 +4,129 @@ import (
 	"flag"
 	"github.com/alx696/libp2p/go-dht-fire/mp2p"
 	"log"
+	"strings"
 )
 
 // 参考 https://github.com/libp2p/go-libp2p-examples/blob/b7ac9e91865656b3ec13d18987a09779adad49dc/ipfs-camp-2019/06-Pubsub/main.go
 func main() {
 	log.Println("DHT星星之火")
 
+	//配置文件, YAML或JSON, 明确指定的参数覆盖配置文件
+	configFlag := flag.String("config", "", "")
 	//指定端口,否则随机
 	portFlag := flag.String("port", "0", "")
 	//启发节点
 	//必须是P2P地址, 即 https://github.com/multiformats/multiaddr#protocols (含/ipfs/Qm...)
 	bootstrapFlag := flag.String("bootstrap", "", "")
+	//启发节点文件, 每行一个P2P地址或JSON数组
+	bootstrapFileFlag := flag.String("bootstrap-file", "", "")
+	//引导回复的最大节点数量, 0为不限
+	bootstrapLimitFlag := flag.Int("bootstrap-limit", 0, "")
+	//引导回复的节点选择策略, random, round-robin或recent
+	bootstrapSelectFlag := flag.String("bootstrap-select", "random", "")
+	//连接IPFS公共启发节点, 加入IPFS公共DHT
+	ipfsFlag := flag.Bool("ipfs", false, "")
+	//同时运行局域网和互联网DHT
+	dualFlag := flag.Bool("dual", false, "")
+	//汇合点, 宣告和查找同一汇合点的节点
+	rendezvousFlag := flag.String("rendezvous", "", "")
+	//监听地址, 多个用逗号分隔, 例如 /ip4/192.168.1.2/udp/60000/quic
+	listenFlag := flag.String("listen", "", "")
+	//宣告地址, 多个用逗号分隔, 设置后不使用NAT映射得到的地址, 例如 /ip4/1.2.3.4/udp/4001/quic
+	announceFlag := flag.String("announce", "", "")
+	//Unix域套接字路径, 用于同一主机的进程间通信
+	unixFlag := flag.String("unix", "", "")
+	//宣告IPv6链路本地和唯一本地地址, 只在同一链路或站点内组网时开启
+	ipv6LocalFlag := flag.Bool("announce-ipv6-local", false, "")
+	//NAT穿越, 有公网IP时可关闭
+	natFlag := flag.Bool("nat", true, "")
+	//优先使用的NAT协议, upnp或natpmp
+	natProtocolFlag := flag.String("nat-protocol", "", "")
+	//禁止拨号私有网段地址, 局域网测试时勿用
+	filterPrivateFlag := flag.Bool("filter-private", false, "")
+	//日志语言, en或zh
+	langFlag := flag.String("lang", "en", "")
+	//日志格式, text或json
+	logFormatFlag := flag.String("log-format", "text", "")
+	//日志文件, 按大小轮转
+	logFileFlag := flag.String("log-file", "", "")
+	//没有密钥时生成的密钥类型, rsa, ed25519, secp256k1或ecdsa
+	keyTypeFlag := flag.String("key-type", "ed25519", "")
+	//没有密钥时启动失败, 不生成新密钥
+	requireKeyFlag := flag.Bool("require-key", false, "")
+	//更换密钥并退出, 新密钥类型为rsa, ed25519, secp256k1或ecdsa
+	rotateKeyFlag := flag.String("rotate-key", "", "")
+	//只检查配置, 不启动节点
+	checkFlag := flag.Bool("check", false, "")
 	flag.Parse()
 
-	mp2p.Init(*portFlag, *bootstrapFlag)
+	c := mp2p.DefaultConfig()
+	if *configFlag != "" {
+		var e error
+		c, e = mp2p.LoadConfig(*configFlag)
+		if e != nil {
+			log.Fatalln(e)
+		}
+	}
+	//使用配置文件时只使用明确指定的参数
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+	apply := func(name string, set func()) {
+		if *configFlag == "" || setFlags[name] {
+			set()
+		}
+	}
+	apply("port", func() { c.Port = *portFlag })
+	apply("bootstrap", func() { c.BootstrapAddr = *bootstrapFlag })
+	apply("bootstrap-file", func() { c.BootstrapFile = *bootstrapFileFlag })
+	apply("bootstrap-limit", func() { c.BootstrapResponseLimit = *bootstrapLimitFlag })
+	apply("bootstrap-select", func() { c.BootstrapSelection = *bootstrapSelectFlag })
+	apply("ipfs", func() { c.UseIPFSBootstrap = *ipfsFlag })
+	apply("dual", func() { c.DualDHT = *dualFlag })
+	apply("rendezvous", func() { c.Rendezvous = *rendezvousFlag })
+	apply("listen", func() {
+		c.ListenAddrs = nil
+		if *listenFlag != "" {
+			c.ListenAddrs = strings.Split(*listenFlag, ",")
+		}
+	})
+	apply("announce", func() {
+		if *announceFlag != "" {
+			c.AnnounceAddrs = strings.Split(*announceFlag, ",")
+		}
+	})
+	apply("unix", func() { c.UnixSocketPath = *unixFlag })
+	apply("announce-ipv6-local", func() { c.AnnounceIPv6Local = *ipv6LocalFlag })
+	apply("nat", func() { c.EnableNAT = *natFlag })
+	apply("nat-protocol", func() { c.NATProtocol = *natProtocolFlag })
+	apply("filter-private", func() { c.FilterPrivateAddrs = *filterPrivateFlag })
+	apply("lang", func() { c.Language = *langFlag })
+	apply("log-format", func() { c.LogFormat = *logFormatFlag })
+	apply("log-file", func() { c.LogFile = *logFileFlag })
+	apply("key-type", func() { c.KeyType = *keyTypeFlag })
+	apply("require-key", func() { c.RequireExistingKey = *requireKeyFlag })
+	if *rotateKeyFlag != "" {
+		keyType, e := mp2p.ParseKeyType(*rotateKeyFlag)
+		if e != nil {
+			log.Fatalln(e)
+		}
+		oldID, newID, e := mp2p.RotateKey(c.KeyDir, keyType)
+		if e != nil {
+			log.Fatalln(e)
+		}
+		log.Println("旧节点ID:", oldID.String())
+		log.Println("新节点ID:", newID.String())
+		return
+	}
+	if *checkFlag {
+		e := c.Validate()
+		if e != nil {
+			log.Fatalln(e)
+		}
+		log.Println("配置正确")
+		return
+	}
+	mp2p.InitWithConfig(c)
 }
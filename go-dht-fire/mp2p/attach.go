@@ -0,0 +1,113 @@
+package mp2p
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"io"
+	"sync"
+)
+
+// 写入一帧消息, 格式为 无符号varint长度 + 数据(同libp2p的长度前缀帧), 最多MAX_MESSAGE_SIZE字节
+// 订阅协议(Attach)的处理方用它推送消息.
+func WriteFrame(w io.Writer, data []byte) error {
+	if len(data) > MAX_MESSAGE_SIZE {
+		return fmt.Errorf("消息超过%d字节: %d", MAX_MESSAGE_SIZE, len(data))
+	}
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(data))
+	n := binary.PutUvarint(buf, uint64(len(data)))
+	_, e := w.Write(append(buf[:n], data...))
+	return e
+}
+
+// 读取一帧消息, 超过MAX_MESSAGE_SIZE字节时返回错误
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	size, e := binary.ReadUvarint(r)
+	if e != nil {
+		return nil, e
+	}
+	if size > MAX_MESSAGE_SIZE {
+		return nil, fmt.Errorf("消息超过%d字节: %d", MAX_MESSAGE_SIZE, size)
+	}
+	data := make([]byte, size)
+	_, e = io.ReadFull(r, data)
+	if e != nil {
+		return nil, e
+	}
+	return data, nil
+}
+
+// 订阅, 一个接收推送的长期流
+type attachment struct {
+	stream network.Stream
+	once   sync.Once
+	closed chan struct{} //关闭时关闭
+	done   chan struct{} //读取协程退出时关闭
+}
+
+// 关闭订阅, 重置流. 之后不再调用onMsg(正在执行的调用除外)
+func (a *attachment) Close() error {
+	var e error
+	a.once.Do(func() {
+		close(a.closed)
+		e = a.stream.Reset()
+	})
+	return e
+}
+
+// 逐帧读取直到对方关闭, 出错或订阅关闭
+func (a *attachment) read(onMsg func([]byte)) {
+	defer close(a.done)
+	id := a.stream.Conn().RemotePeer().String()
+	reader := bufio.NewReader(a.stream)
+	for {
+		data, e := readFrame(reader)
+		if e != nil {
+			select {
+			case <-a.closed:
+				return
+			default:
+			}
+			if e == io.EOF {
+				logMsg("attach.ended", id, a.stream.Protocol())
+				_ = a.stream.Close()
+			} else {
+				logMsg("attach.read_failed", id, e)
+				_ = a.stream.Reset()
+			}
+			return
+		}
+		onMsg(data)
+	}
+}
+
+// 连接节点并订阅协议
+// 连接节点(已连接时直接使用), 打开proto协议的流, 在协程中逐帧(WriteFrame)读取对方推送的消息并调用onMsg,
+// 直到对方关闭流, 出错, ctx结束或调用返回的Closer. onMsg在读取协程中依次调用, 阻塞时不再读取后面的消息.
+func Attach(ctx context.Context, pi peer.AddrInfo, proto protocol.ID, onMsg func([]byte)) (io.Closer, error) {
+	if !IsConnected(pi.ID) {
+		e := connectContext(ctx, pi)
+		if e != nil {
+			return nil, e
+		}
+	}
+	s, e := node.NewStream(ctx, pi.ID, proto)
+	if e != nil {
+		return nil, e
+	}
+	a := &attachment{stream: s, closed: make(chan struct{}), done: make(chan struct{})}
+	go a.read(onMsg)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = a.Close()
+		case <-a.done:
+		}
+	}()
+	logMsg("attach.opened", pi.ID.String(), proto)
+	return a, nil
+}
@@ -0,0 +1,75 @@
+package mp2p
+
+import (
+	"context"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"testing"
+	"time"
+)
+
+func TestAttach(t *testing.T) {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	prKey, e := generateKey(crypto.Ed25519)
+	if e != nil {
+		t.Fatal(e)
+	}
+	node, e = newMockHost(mn, prKey, "/ip4/127.0.0.1/tcp/4001")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node.Close()
+	other, e := mn.GenPeer()
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = LinkMockHosts(mn)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	//推送3条消息后等待订阅关闭
+	const proto = "/test/push/1.0.0"
+	reset := make(chan struct{})
+	other.SetStreamHandler(proto, func(s network.Stream) {
+		for _, text := range []string{"a", "", "包含\n换行"} {
+			_ = WriteFrame(s, []byte(text))
+		}
+		_, e := s.Read(make([]byte, 1))
+		if e != nil {
+			close(reset)
+		}
+	})
+
+	received := make(chan string, 3)
+	closer, e := Attach(ctx, peer.AddrInfo{ID: other.ID(), Addrs: other.Addrs()}, proto, func(data []byte) {
+		received <- string(data)
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, want := range []string{"a", "", "包含\n换行"} {
+		select {
+		case text := <-received:
+			if text != want {
+				t.Fatal("消息错误:", text, want)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("没有收到消息:", want)
+		}
+	}
+
+	_ = closer.Close()
+	select {
+	case <-reset:
+	case <-time.After(time.Second * 5):
+		t.Fatal("关闭订阅时应重置流")
+	}
+	<-closer.(*attachment).done
+}
@@ -0,0 +1,235 @@
+package mp2p
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/multiformats/go-multistream"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 创建测试启发节点, 返回P2P地址
+func newTestBootstrapHost(t *testing.T) (host.Host, string) {
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	addr := strings.Join([]string{remote.Addrs()[0].String(), "/p2p/", remote.ID().String()}, "")
+	return remote, addr
+}
+
+func TestBootstrapErrors(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+
+	check := func(name string, addr string, stage error) {
+		e := bootstrap(addr)
+		if !errors.Is(e, stage) {
+			t.Fatal(name, "错误阶段不对:", e)
+		}
+		var be *BootstrapError
+		if !errors.As(e, &be) || be.Addr != addr || be.Err == nil {
+			t.Fatal(name, "应该返回BootstrapError:", e)
+		}
+		if !strings.Contains(e.Error(), addr) {
+			t.Fatal(name, "错误信息应该包含地址:", e)
+		}
+	}
+
+	check("地址", "not-a-multiaddr", ErrBootstrapAddr)
+	check("连接", strings.Join([]string{"/ip4/127.0.0.1/tcp/1/p2p/", randomPeerID(t).String()}, ""), ErrBootstrapConnect)
+
+	//不支持引导协议
+	remote, addr := newTestBootstrapHost(t)
+	defer remote.Close()
+	check("打开流", addr, ErrBootstrapStream)
+
+	//不回复就关闭
+	remote.SetStreamHandler(PROTOCOL_BOOTSTRAP_V2, func(s network.Stream) {
+		_, _ = readTextFormStream(s)
+		_ = s.Close()
+	})
+	check("读取", addr, ErrBootstrapRead)
+
+	//回复格式错误
+	remote.SetStreamHandler(PROTOCOL_BOOTSTRAP_V2, func(s network.Stream) {
+		_, _ = readTextFormStream(s)
+		_, _ = s.Write([]byte("not json\n"))
+		_ = s.Close()
+	})
+	check("解析", addr, ErrBootstrapDecode)
+}
+
+func TestBootstrapStreamRetry(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	defer func() { config = Config{} }()
+
+	//对方不支持引导协议时不重试
+	remote, addr := newTestBootstrapHost(t)
+	defer remote.Close()
+	ai, _ := textToAddrInfo(addr)
+	if e := node.Connect(ctx, *ai); e != nil {
+		t.Fatal(e)
+	}
+	start := time.Now()
+	if _, e := newBootstrapStream(ai.ID); !errors.Is(e, multistream.ErrNotSupported) {
+		t.Fatal("应返回协议不支持:", e)
+	}
+	if time.Since(start) >= BOOTSTRAP_STREAM_BACKOFF {
+		t.Fatal("协议不支持时不应重试")
+	}
+
+	//打开流失败时按退避重试
+	config = Config{BootstrapStreamRetries: 2}
+	start = time.Now()
+	if _, e := newBootstrapStream(randomPeerID(t)); e == nil {
+		t.Fatal("没有地址的节点应打开失败")
+	}
+	if time.Since(start) < BOOTSTRAP_STREAM_BACKOFF*3 {
+		t.Fatal("应重试2次:", time.Since(start))
+	}
+
+	config = Config{BootstrapStreamRetries: -1}
+	start = time.Now()
+	if _, e := newBootstrapStream(randomPeerID(t)); e == nil {
+		t.Fatal("没有地址的节点应打开失败")
+	}
+	if time.Since(start) >= BOOTSTRAP_STREAM_BACKOFF {
+		t.Fatal("小于0时不应重试")
+	}
+}
+
+func TestBootstrapAll(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+
+	remote, addr := newTestBootstrapHost(t)
+	defer remote.Close()
+	remote.SetStreamHandler(PROTOCOL_BOOTSTRAP_V2, func(s network.Stream) {
+		defer s.Close()
+		_, _ = readTextFormStream(s)
+		_ = writeJSONToStream(s, BootstrapResponse{})
+	})
+
+	//一个成功即返回, 失败的不影响
+	n := bootstrapAll([]string{"not-a-multiaddr", addr, "also-not-a-multiaddr"})
+	if n != 1 {
+		t.Fatal("应引导成功1个:", n)
+	}
+	if n = bootstrapAll([]string{"not-a-multiaddr"}); n != 0 {
+		t.Fatal("全部失败时应返回0:", n)
+	}
+}
+
+func TestBootstrapGroupAddrs(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+
+	//启发节点和回复中的节点都有一个不可用的地址
+	other, otherAddr := newTestBootstrapHost(t)
+	defer other.Close()
+	otherBad := "/ip4/127.0.0.1/tcp/1/p2p/" + other.ID().String()
+	remote, addr := newTestBootstrapHost(t)
+	defer remote.Close()
+	remote.SetStreamHandler(PROTOCOL_BOOTSTRAP_V2, func(s network.Stream) {
+		defer s.Close()
+		_, _ = readTextFormStream(s)
+		_ = writeJSONToStream(s, BootstrapResponse{Peers: []string{otherBad, otherAddr}})
+	})
+	bad := "/ip4/127.0.0.1/tcp/1/p2p/" + remote.ID().String()
+
+	groups := groupAddrTexts([]string{bad, "not-a-multiaddr", otherAddr, addr})
+	if !reflect.DeepEqual(groups, [][]string{{bad, addr}, {"not-a-multiaddr"}, {otherAddr}}) {
+		t.Fatal("分组错误:", groups)
+	}
+
+	//同一节点的地址一起连接, 不可用的地址不影响
+	if n := bootstrapAll([]string{bad, addr}); n != 1 {
+		t.Fatal("应引导成功1个节点:", n)
+	}
+	if node.Network().Connectedness(remote.ID()) != network.Connected || node.Network().Connectedness(other.ID()) != network.Connected {
+		t.Fatal("应连接启发节点和回复中的节点")
+	}
+	sm.Lock()
+	cached := peerMap[other.ID().String()]
+	sm.Unlock()
+	if cached != otherAddr {
+		t.Fatal("应缓存连接使用的地址:", cached)
+	}
+
+	var be *BootstrapError
+	if e := bootstrap(addr, otherAddr); !errors.As(e, &be) || !errors.Is(e, ErrBootstrapAddr) || be.Addr != addr+","+otherAddr {
+		t.Fatal("不同节点的地址不能一起引导:", e)
+	}
+}
+
+func TestBootstrapRelayAddrs(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	fc, restoreClock := useFakeClock()
+	defer restoreClock()
+	responseCache = newBootstrapCache()
+	defer func() {
+		sm.Lock()
+		peerMap = make(map[string]string)
+		relayMap = make(map[string][]string)
+		sm.Unlock()
+		invalidateBootstrapCache()
+	}()
+	protocols.Register(PROTOCOL_BOOTSTRAP_V2, handleBootstrapStreamV2)
+
+	send := func(h host.Host, addrs []string) BootstrapResponse {
+		t.Helper()
+		var res BootstrapResponse
+		h.Peerstore().AddAddrs(node.ID(), node.Addrs(), time.Minute)
+		s, e := h.NewStream(ctx, node.ID(), PROTOCOL_BOOTSTRAP_V2)
+		if e != nil {
+			t.Fatal(e)
+		}
+		defer s.Close()
+		if e = writeJSONToStream(s, BootstrapRequest{Addrs: addrs}); e != nil {
+			t.Fatal(e)
+		}
+		text, e := readTextFormStream(s)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if e = json.Unmarshal([]byte(text), &res); e != nil {
+			t.Fatal(e)
+		}
+		return res
+	}
+
+	//第一个节点宣告直连地址和经中继的地址
+	first, _ := newTestBootstrapHost(t)
+	defer first.Close()
+	direct := "/ip4/1.2.3.4/tcp/4001/ipfs/" + first.ID().String()
+	relay := strings.Join([]string{"/ip4/5.6.7.8/tcp/4001/ipfs/", randomPeerID(t).String(), "/p2p-circuit/ipfs/", first.ID().String()}, "")
+	send(first, []string{relay, direct})
+	sm.Lock()
+	cached, relays := peerMap[first.ID().String()], relayMap[first.ID().String()]
+	sm.Unlock()
+	if cached != direct || !reflect.DeepEqual(relays, []string{relay}) {
+		t.Fatal("应分别缓存直连地址和中继地址:", cached, relays)
+	}
+
+	//第二个节点收到两个地址, 直连地址在前
+	fc.Advance(BOOTSTRAP_CACHE_INTERVAL)
+	second, _ := newTestBootstrapHost(t)
+	defer second.Close()
+	var got []string
+	for _, addr := range send(second, nil).Peers {
+		if strings.HasSuffix(addr, first.ID().String()) {
+			got = append(got, addr)
+		}
+	}
+	if !reflect.DeepEqual(got, []string{direct, relay}) {
+		t.Fatal("回复应包含中继地址:", got)
+	}
+}
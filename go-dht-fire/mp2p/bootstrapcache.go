@@ -0,0 +1,169 @@
+package mp2p
+
+import (
+	"encoding/json"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	BOOTSTRAP_CACHE_INTERVAL = time.Second //引导回复缓存的最短重建间隔
+)
+
+// 引导回复缓存
+// 每次引导请求都遍历缓存节点并编码JSON, 节点多时请求互相等待锁且占用CPU.
+// 缓存节点变化时标记过期, 过期后最多每BOOTSTRAP_CACHE_INTERVAL重建一次, 之间的请求使用旧的缓存.
+// 缓存为只读快照, 读取时不加锁; 同一时间只有一个请求重建快照, 其它请求继续使用旧的快照, 不会等待peerMap的写锁.
+type bootstrapCache struct {
+	dirty      int32        //原子操作, 1为过期
+	rebuilding int32        //原子操作, 1为正在重建
+	snapshot   atomic.Value //*bootstrapSnapshot
+}
+
+// 引导回复快照, 创建后不再修改
+type bootstrapSnapshot struct {
+	built    time.Time
+	ids      []peer.ID        //与addrs一一对应, 按选择策略排序(最近优先或节点ID)
+	addrs    [][]string       //经过宣告地址过滤的节点地址, 直连地址在前, 中继地址在后. 不含自己
+	jsonText []byte           //addrs的JSON数组(全部节点)
+	index    map[peer.ID]bool //ids的集合
+}
+
+func newBootstrapCache() *bootstrapCache {
+	return &bootstrapCache{dirty: 1}
+}
+
+var responseCache = newBootstrapCache()
+
+// 标记引导回复缓存过期, 修改peerMap后调用
+// 设置了内存上限时同时检查节点记录, 超过预算时移除价值最低的节点.
+func invalidateBootstrapCache() {
+	atomic.StoreInt32(&responseCache.dirty, 1)
+	trimPeers()
+}
+
+// 获取缓存快照, 过期且距上次重建超过间隔时重建
+// 返回的快照不能修改.
+func (c *bootstrapCache) get() *bootstrapSnapshot {
+	snap, _ := c.snapshot.Load().(*bootstrapSnapshot)
+	if atomic.LoadInt32(&c.dirty) == 1 && (snap == nil || clock.Now().Sub(snap.built) >= BOOTSTRAP_CACHE_INTERVAL) {
+		if atomic.CompareAndSwapInt32(&c.rebuilding, 0, 1) {
+			//先清除过期标记, 重建期间的修改会再次标记
+			atomic.StoreInt32(&c.dirty, 0)
+			snap = buildBootstrapSnapshot()
+			c.snapshot.Store(snap)
+			atomic.StoreInt32(&c.rebuilding, 0)
+		} else if snap == nil {
+			//首次重建还没有完成, 自己创建一份
+			snap = buildBootstrapSnapshot()
+		}
+	}
+	return snap
+}
+
+// 创建快照, peerMap只在复制时加读锁
+// 节点按选择策略排序, 回复的节点和顺序不受map遍历顺序影响.
+func buildBootstrapSnapshot() *bootstrapSnapshot {
+	var ids []peer.ID
+	var addrs [][]string
+	selfId := node.ID()
+	sm.RLock()
+	for k, v := range peerMap {
+		id, e := peer.Decode(k)
+		if e != nil || id == selfId {
+			continue
+		}
+		ids = append(ids, id)
+		addrs = append(addrs, append([]string{v}, relayMap[k]...))
+	}
+	sm.RUnlock()
+
+	//宣告地址过滤, 排序和编码不需要锁定peerMap
+	sortBootstrapPeers(ids, addrs)
+	snap := &bootstrapSnapshot{
+		built: clock.Now(),
+		ids:   make([]peer.ID, 0, len(ids)),
+		addrs: make([][]string, 0, len(addrs)),
+		index: make(map[peer.ID]bool, len(ids)),
+	}
+	all := make([]string, 0, len(addrs))
+	for i, peerAddrs := range addrs {
+		//直连地址不宣告时(例如在NAT后面), 中继地址仍可到达
+		peerAddrs = filterAnnounceTexts(peerAddrs)
+		if len(peerAddrs) == 0 {
+			continue
+		}
+		snap.ids = append(snap.ids, ids[i])
+		snap.addrs = append(snap.addrs, peerAddrs)
+		snap.index[ids[i]] = true
+		all = append(all, peerAddrs...)
+	}
+	snap.jsonText, _ = json.Marshal(all)
+	return snap
+}
+
+// 按选择策略排序节点: 最近优先时按最后发现或连接的时间, 否则按节点ID. 相同时按节点ID
+func sortBootstrapPeers(ids []peer.ID, addrs [][]string) {
+	seen := make(map[peer.ID]int64)
+	if bootstrapSelection == BOOTSTRAP_SELECT_RECENT {
+		for _, id := range ids {
+			seen[id] = peerLastSeen(id).UnixNano()
+		}
+	}
+	sort.Sort(bootstrapPeerSorter{ids: ids, addrs: addrs, seen: seen})
+}
+
+type bootstrapPeerSorter struct {
+	ids   []peer.ID
+	addrs [][]string
+	seen  map[peer.ID]int64
+}
+
+func (x bootstrapPeerSorter) Len() int {
+	return len(x.ids)
+}
+
+func (x bootstrapPeerSorter) Less(i, j int) bool {
+	if x.seen[x.ids[i]] != x.seen[x.ids[j]] {
+		return x.seen[x.ids[i]] > x.seen[x.ids[j]]
+	}
+	return x.ids[i] < x.ids[j]
+}
+
+func (x bootstrapPeerSorter) Swap(i, j int) {
+	x.ids[i], x.ids[j] = x.ids[j], x.ids[i]
+	x.addrs[i], x.addrs[j] = x.addrs[j], x.addrs[i]
+}
+
+// 快照中除id以外的节点地址, 按选择策略选择(Config.BootstrapResponseLimit)
+func (snap *bootstrapSnapshot) addrsWithout(id peer.ID) []string {
+	candidates := make([]int, 0, len(snap.addrs))
+	for i := range snap.addrs {
+		if snap.ids[i] != id {
+			candidates = append(candidates, i)
+		}
+	}
+	selected := selectBootstrapIndexes(candidates)
+	maArray := make([]string, 0, len(selected))
+	for _, i := range selected {
+		maArray = append(maArray, snap.addrs[i]...)
+	}
+	return maArray
+}
+
+// 引导回复的节点地址, 不含请求节点
+func bootstrapResponseAddrs(requester peer.ID) []string {
+	return responseCache.get().addrsWithout(requester)
+}
+
+// 引导回复(1.0.0)的JSON数组, 不含请求节点
+// 请求节点不在缓存中(通常如此)且没有超过数量限制时直接使用缓存的JSON.
+func bootstrapResponseJSON(requester peer.ID) ([]byte, error) {
+	snap := responseCache.get()
+	if !snap.index[requester] && (bootstrapResponseLimit <= 0 || len(snap.addrs) <= bootstrapResponseLimit) {
+		return snap.jsonText, nil
+	}
+	return json.Marshal(snap.addrsWithout(requester))
+}
@@ -0,0 +1,222 @@
+package mp2p
+
+import (
+	"encoding/json"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 缓存节点数量
+const BENCH_PEERS = 1000
+
+func setupBenchPeers(b *testing.B) func() {
+	closeNode := newTestNode(b)
+	sm.Lock()
+	for i := 0; i < BENCH_PEERS; i++ {
+		id := randomPeerID(b).String()
+		peerMap[id] = strings.Join([]string{"/ip4/1.2.3.4/udp/4001/quic/ipfs/", id}, "")
+	}
+	sm.Unlock()
+	invalidateBootstrapCache()
+	return func() {
+		sm.Lock()
+		peerMap = make(map[string]string)
+		sm.Unlock()
+		invalidateBootstrapCache()
+		closeNode()
+	}
+}
+
+// 每次请求都锁定peerMap并编码(缓存前的做法)
+func BenchmarkBootstrapResponseUncached(b *testing.B) {
+	defer setupBenchPeers(b)()
+	requester := randomPeerID(b).String()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			var maArray []string
+			sm.RLock()
+			for k, v := range peerMap {
+				if k == requester || k == node.ID().String() {
+					continue
+				}
+				maArray = append(maArray, v)
+			}
+			_, _ = json.Marshal(filterAnnounceTexts(maArray))
+			sm.RUnlock()
+		}
+	})
+}
+
+func BenchmarkBootstrapResponseCached(b *testing.B) {
+	defer setupBenchPeers(b)()
+	requester := randomPeerID(b)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = bootstrapResponseJSON(requester)
+		}
+	})
+}
+
+// 引导请求的同时不断修改peerMap(记录请求节点, 刷新移除失去的节点)
+func BenchmarkBootstrapResponseCachedWithWrites(b *testing.B) {
+	defer setupBenchPeers(b)()
+	requester := randomPeerID(b)
+	writerId := randomPeerID(b).String()
+	writerAddr := strings.Join([]string{"/ip4/1.2.3.4/udp/4001/quic/ipfs/", writerId}, "")
+	done := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			sm.Lock()
+			peerMap[writerId] = writerAddr
+			sm.Unlock()
+			invalidateBootstrapCache()
+		}
+	}()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = bootstrapResponseJSON(requester)
+		}
+	})
+	b.StopTimer()
+	close(done)
+	<-writerDone
+}
+
+func TestBootstrapCacheInvalidate(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	fc, restoreClock := useFakeClock()
+	defer restoreClock()
+	responseCache = newBootstrapCache()
+	defer func() {
+		sm.Lock()
+		peerMap = make(map[string]string)
+		sm.Unlock()
+		invalidateBootstrapCache()
+	}()
+
+	id := randomPeerID(t).String()
+	addr := strings.Join([]string{"/ip4/1.2.3.4/tcp/4001/ipfs/", id}, "")
+	sm.Lock()
+	peerMap[id] = addr
+	sm.Unlock()
+	invalidateBootstrapCache()
+	fc.Advance(BOOTSTRAP_CACHE_INTERVAL)
+	if addrs := bootstrapResponseAddrs(randomPeerID(t)); len(addrs) != 1 || addrs[0] != addr {
+		t.Fatal("缓存应包含节点:", addrs)
+	}
+
+	//间隔内的变化不重建
+	sm.Lock()
+	delete(peerMap, id)
+	sm.Unlock()
+	invalidateBootstrapCache()
+	if addrs := bootstrapResponseAddrs(randomPeerID(t)); len(addrs) != 1 {
+		t.Fatal("间隔内应使用旧的缓存:", addrs)
+	}
+	fc.Advance(BOOTSTRAP_CACHE_INTERVAL)
+	if addrs := bootstrapResponseAddrs(randomPeerID(t)); len(addrs) != 0 {
+		t.Fatal("过期后应重建缓存:", addrs)
+	}
+	jsonText, _ := bootstrapResponseJSON(randomPeerID(t))
+	if string(jsonText) != "[]" {
+		t.Fatal("没有节点时应回复空数组:", string(jsonText))
+	}
+}
+
+func TestBootstrapSelection(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	fc, restoreClock := useFakeClock()
+	defer restoreClock()
+	responseCache = newBootstrapCache()
+	defer func() {
+		sm.Lock()
+		peerMap = make(map[string]string)
+		sm.Unlock()
+		knownLock.Lock()
+		knownPeers = make(map[peer.ID]*knownPeer)
+		knownLock.Unlock()
+		setBootstrapSelection("", 0, 0)
+	}()
+
+	//依次发现, 后发现的最近
+	var ids []peer.ID
+	addrOf := make(map[peer.ID]string)
+	for i := 0; i < 6; i++ {
+		id := randomPeerID(t)
+		ids = append(ids, id)
+		addrOf[id] = strings.Join([]string{"/ip4/1.2.3.4/tcp/4001/ipfs/", id.String()}, "")
+		sm.Lock()
+		peerMap[id.String()] = addrOf[id]
+		sm.Unlock()
+		learnPeer(id)
+		fc.Advance(time.Second)
+	}
+	sorted := append([]peer.ID(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var byID []string
+	for _, id := range sorted {
+		byID = append(byID, addrOf[id])
+	}
+	requester := randomPeerID(t)
+	rebuild := func() {
+		invalidateBootstrapCache()
+		fc.Advance(BOOTSTRAP_CACHE_INTERVAL)
+	}
+
+	//不限数量时按节点ID排序
+	setBootstrapSelection(BOOTSTRAP_SELECT_RANDOM, 0, 1)
+	rebuild()
+	all := bootstrapResponseAddrs(requester)
+	if !reflect.DeepEqual(all, byID) {
+		t.Fatal("应按节点ID回复所有节点:", all)
+	}
+
+	//相同种子的随机选择相同
+	setBootstrapSelection(BOOTSTRAP_SELECT_RANDOM, 3, 42)
+	rebuild()
+	first := [][]string{bootstrapResponseAddrs(requester), bootstrapResponseAddrs(requester)}
+	setBootstrapSelection(BOOTSTRAP_SELECT_RANDOM, 3, 42)
+	rebuild()
+	second := [][]string{bootstrapResponseAddrs(requester), bootstrapResponseAddrs(requester)}
+	if !reflect.DeepEqual(first, second) || len(first[0]) != 3 {
+		t.Fatal("相同种子应选择相同的节点:", first, second)
+	}
+
+	//轮流选择覆盖所有节点
+	setBootstrapSelection(BOOTSTRAP_SELECT_ROUND_ROBIN, 4, 0)
+	rebuild()
+	robin := append(bootstrapResponseAddrs(requester), bootstrapResponseAddrs(requester)...)
+	if !reflect.DeepEqual(robin[:6], byID) || !reflect.DeepEqual(robin[6:], byID[:2]) {
+		t.Fatal("应按节点ID轮流选择:", robin)
+	}
+	jsonText, _ := bootstrapResponseJSON(requester)
+	var decoded []string
+	_ = json.Unmarshal(jsonText, &decoded)
+	if len(decoded) != 4 {
+		t.Fatal("旧版本协议的回复同样受数量限制:", decoded)
+	}
+
+	//最近优先, 不含请求节点
+	setBootstrapSelection(BOOTSTRAP_SELECT_RECENT, 2, 0)
+	rebuild()
+	recent := bootstrapResponseAddrs(ids[5])
+	if !reflect.DeepEqual(recent, []string{addrOf[ids[4]], addrOf[ids[3]]}) {
+		t.Fatal("应回复最近发现的节点:", recent)
+	}
+}
@@ -0,0 +1,79 @@
+package mp2p
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 引导回复的节点选择策略, 回复节点数量受Config.BootstrapResponseLimit限制时决定回复哪些节点
+const (
+	BOOTSTRAP_SELECT_RANDOM      = "random"      //随机选择(默认), 设置Config.BootstrapSelectionSeed时序列可重现
+	BOOTSTRAP_SELECT_ROUND_ROBIN = "round-robin" //按节点ID顺序轮流选择, 连续的请求得到不同的节点
+	BOOTSTRAP_SELECT_RECENT      = "recent"      //最近发现或连接的节点优先
+)
+
+// 节点选择设置, 只在节点启动前修改
+var bootstrapSelection = BOOTSTRAP_SELECT_RANDOM
+var bootstrapResponseLimit int
+
+// 随机选择的随机数, rand.Rand不是并发安全的
+var selectRandLock sync.Mutex
+var selectRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// 轮流选择的位置, 原子操作
+var selectCursor uint64
+
+// 设置引导回复的节点选择, 只应在节点启动前调用
+// strategy为空时随机选择; limit不大于0时回复所有节点; seed为0时使用当前时间作为随机种子.
+// 同时标记引导回复缓存过期, 快照按策略排序.
+func setBootstrapSelection(strategy string, limit int, seed int64) {
+	if strategy == "" {
+		strategy = BOOTSTRAP_SELECT_RANDOM
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	bootstrapSelection = strategy
+	bootstrapResponseLimit = limit
+	selectRandLock.Lock()
+	selectRand = rand.New(rand.NewSource(seed))
+	selectRandLock.Unlock()
+	atomic.StoreUint64(&selectCursor, 0)
+	atomic.StoreInt32(&responseCache.dirty, 1)
+}
+
+// 按策略从可选的快照下标(candidates)中选择回复的节点
+// 快照中的节点已按策略排序(最近优先或节点ID), 没有超过数量限制时全部返回.
+func selectBootstrapIndexes(candidates []int) []int {
+	limit := bootstrapResponseLimit
+	if limit <= 0 || limit >= len(candidates) {
+		return candidates
+	}
+
+	switch bootstrapSelection {
+	case BOOTSTRAP_SELECT_RECENT:
+		return candidates[:limit]
+	case BOOTSTRAP_SELECT_ROUND_ROBIN:
+		start := atomic.AddUint64(&selectCursor, uint64(limit)) - uint64(limit)
+		selected := make([]int, limit)
+		for i := range selected {
+			selected[i] = candidates[(start+uint64(i))%uint64(len(candidates))]
+		}
+		return selected
+	}
+
+	//部分洗牌, 只交换前limit个
+	shuffled := append([]int(nil), candidates...)
+	selectRandLock.Lock()
+	for i := 0; i < limit; i++ {
+		j := i + selectRand.Intn(len(shuffled)-i)
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	selectRandLock.Unlock()
+	return shuffled[:limit]
+}
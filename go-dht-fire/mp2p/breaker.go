@@ -0,0 +1,231 @@
+package mp2p
+
+import (
+	"errors"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_BREAKER_FAILURES = 5               //连续拨号失败多少次后熔断
+	DEFAULT_BREAKER_COOLDOWN = time.Minute * 5 //熔断后多久允许一次试探拨号
+
+	DEFAULT_DIAL_BACKOFF_BASE = time.Second * 5 //首次拨号失败后的退避时间(同libp2p)
+	DEFAULT_DIAL_BACKOFF_COEF = time.Second     //退避系数, 退避时间为 base + coef * (失败次数-1)^2
+	DEFAULT_DIAL_BACKOFF_MAX  = time.Minute * 5 //最长退避时间
+
+	BREAKER_CLOSED    = "closed"    //正常拨号
+	BREAKER_OPEN      = "open"      //熔断, 不拨号
+	BREAKER_HALF_OPEN = "half-open" //冷却结束, 正在试探拨号
+)
+
+var ErrCircuitOpen = errors.New("节点地址连续拨号失败, 已熔断")
+var ErrDialBackoff = errors.New("节点地址拨号失败, 在退避期内")
+
+// 拨号熔断和退避
+// 节点(同一组地址)拨号失败后的退避期内不再拨号, 连续失败达到次数后熔断, 冷却期内不再拨号(引导交换, 汇合点, 重连等), 冷却结束后允许一次试探拨号:
+// 成功时恢复, 失败时重新熔断. 节点地址变化(例如重启后换了端口)或对方连接过来时恢复, 避免错过回来的节点.
+type dialBreaker struct {
+	addrs    string //拨号的地址, 排序后用逗号连接
+	failures int    //连续失败次数
+	state    string
+	openedAt time.Time
+	failedAt time.Time //最后一次失败的时间
+}
+
+// 熔断状态, 用于诊断
+type BreakerState struct {
+	Peer     string    `json:"peer"`
+	Addrs    []string  `json:"addrs"`
+	State    string    `json:"state"`    //BREAKER_CLOSED, BREAKER_OPEN或BREAKER_HALF_OPEN
+	Failures int       `json:"failures"` //连续失败次数
+	RetryAt  time.Time `json:"retry_at"` //熔断时允许试探拨号的时间, 未熔断时为退避结束的时间
+}
+
+var breakerLock sync.Mutex
+var breakers = make(map[peer.ID]*dialBreaker)
+var breakerFailures = DEFAULT_BREAKER_FAILURES
+var breakerCooldown = DEFAULT_BREAKER_COOLDOWN
+var backoffBase = DEFAULT_DIAL_BACKOFF_BASE
+var backoffCoef = DEFAULT_DIAL_BACKOFF_COEF
+var backoffMax = DEFAULT_DIAL_BACKOFF_MAX
+
+// 设置熔断参数并清空记录, 只应在节点启动前调用
+// failures为0时使用默认值, 小于0时不熔断; cooldown不大于0时使用默认值.
+func setDialBreaker(failures int, cooldown time.Duration) {
+	if failures == 0 {
+		failures = DEFAULT_BREAKER_FAILURES
+	}
+	if cooldown <= 0 {
+		cooldown = DEFAULT_BREAKER_COOLDOWN
+	}
+	breakerLock.Lock()
+	breakerFailures = failures
+	breakerCooldown = cooldown
+	breakers = make(map[peer.ID]*dialBreaker)
+	breakerLock.Unlock()
+}
+
+// 设置拨号退避, 只影响mp2p的拨号, 不修改libp2p的全局设置
+// base: 首次失败后的退避时间, 默认5秒
+// coef: 退避系数, 退避时间为 base + coef * (失败次数-1)^2, 默认1秒
+// max: 最长退避时间, 默认5分钟
+// 参数不大于0时使用默认值.
+func setDialBackoff(base, coef, max time.Duration) {
+	if base <= 0 {
+		base = DEFAULT_DIAL_BACKOFF_BASE
+	}
+	if coef <= 0 {
+		coef = DEFAULT_DIAL_BACKOFF_COEF
+	}
+	if max <= 0 {
+		max = DEFAULT_DIAL_BACKOFF_MAX
+	}
+	breakerLock.Lock()
+	backoffBase = base
+	backoffCoef = coef
+	backoffMax = max
+	breakerLock.Unlock()
+}
+
+// 连续失败failures次后的退避时间, 调用前需锁定breakerLock
+func dialBackoff(failures int) time.Duration {
+	n := time.Duration(failures - 1)
+	backoff := backoffBase + backoffCoef*n*n
+	if backoff > backoffMax || backoff < 0 {
+		backoff = backoffMax
+	}
+	return backoff
+}
+
+// 拨号的地址
+func breakerAddrs(ai peer.AddrInfo) string {
+	addrs := make([]string, 0, len(ai.Addrs))
+	for _, ma := range ai.Addrs {
+		addrs = append(addrs, ma.String())
+	}
+	sort.Strings(addrs)
+	return strings.Join(addrs, ",")
+}
+
+// 是否允许拨号, 退避期内返回ErrDialBackoff, 熔断时返回ErrCircuitOpen
+// 冷却结束时转为试探状态并允许这一次拨号, 试探结束前的其它拨号仍被拒绝.
+func allowDial(ai peer.AddrInfo) error {
+	breakerLock.Lock()
+	defer breakerLock.Unlock()
+	b, exists := breakers[ai.ID]
+	if !exists {
+		return nil
+	}
+	if addrs := breakerAddrs(ai); addrs != b.addrs {
+		//地址变化, 重新计数
+		delete(breakers, ai.ID)
+		return nil
+	}
+	switch b.state {
+	case BREAKER_CLOSED:
+		if clock.Now().Sub(b.failedAt) < dialBackoff(b.failures) {
+			return ErrDialBackoff
+		}
+	case BREAKER_OPEN:
+		if clock.Now().Sub(b.openedAt) < breakerCooldown {
+			return ErrCircuitOpen
+		}
+		b.state = BREAKER_HALF_OPEN
+		logMsg("breaker.probe", ai.ID.String(), b.failures)
+	case BREAKER_HALF_OPEN:
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// 记录拨号结果, 成功时恢复, 失败时退避, 失败达到次数或试探失败时熔断(breakerFailures小于0时不熔断)
+func recordDialResult(ai peer.AddrInfo, connected bool) {
+	if connected {
+		closeBreaker(ai.ID)
+		return
+	}
+
+	breakerLock.Lock()
+	defer breakerLock.Unlock()
+	addrs := breakerAddrs(ai)
+	b, exists := breakers[ai.ID]
+	if !exists || b.addrs != addrs {
+		b = &dialBreaker{addrs: addrs, state: BREAKER_CLOSED}
+		breakers[ai.ID] = b
+	}
+	b.failures++
+	b.failedAt = clock.Now()
+	if breakerFailures < 0 {
+		b.state = BREAKER_CLOSED
+		return
+	}
+	if b.state == BREAKER_HALF_OPEN || (b.state == BREAKER_CLOSED && b.failures >= breakerFailures) {
+		b.state = BREAKER_OPEN
+		b.openedAt = clock.Now()
+		logMsg("breaker.opened", ai.ID.String(), b.failures, breakerCooldown)
+	}
+}
+
+// 试探拨号因libp2p拨号退避没有进行, 恢复为熔断状态, 下次拨号时再试探
+func cancelProbe(id peer.ID) {
+	breakerLock.Lock()
+	defer breakerLock.Unlock()
+	if b, exists := breakers[id]; exists && b.state == BREAKER_HALF_OPEN {
+		b.state = BREAKER_OPEN
+	}
+}
+
+// 恢复节点的拨号, 连接成功(包括对方连接过来)时调用
+func closeBreaker(id peer.ID) {
+	breakerLock.Lock()
+	b, exists := breakers[id]
+	delete(breakers, id)
+	breakerLock.Unlock()
+	if exists && b.state != BREAKER_CLOSED {
+		logMsg("breaker.closed", id.String())
+	}
+}
+
+// 拨号熔断状态, 包括还没有熔断但有连续失败的节点. 熔断的在前
+func CircuitBreakers() []BreakerState {
+	breakerLock.Lock()
+	states := make([]BreakerState, 0, len(breakers))
+	for id, b := range breakers {
+		state := BreakerState{Peer: id.String(), State: b.state, Failures: b.failures}
+		if b.addrs != "" {
+			state.Addrs = strings.Split(b.addrs, ",")
+		}
+		if b.state != BREAKER_CLOSED {
+			state.RetryAt = b.openedAt.Add(breakerCooldown)
+		} else {
+			state.RetryAt = b.failedAt.Add(dialBackoff(b.failures))
+		}
+		states = append(states, state)
+	}
+	breakerLock.Unlock()
+
+	sort.Slice(states, func(i, j int) bool {
+		if (states[i].State == BREAKER_CLOSED) != (states[j].State == BREAKER_CLOSED) {
+			return states[j].State == BREAKER_CLOSED
+		}
+		return states[i].Peer < states[j].Peer
+	})
+	return states
+}
+
+// 熔断的节点数量
+func openBreakerCount() int {
+	breakerLock.Lock()
+	defer breakerLock.Unlock()
+	n := 0
+	for _, b := range breakers {
+		if b.state != BREAKER_CLOSED {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,119 @@
+package mp2p
+
+import (
+	"errors"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"testing"
+	"time"
+)
+
+func TestDialBreaker(t *testing.T) {
+	fc, restore := useFakeClock()
+	defer restore()
+	setDialBreaker(3, time.Minute)
+	defer setDialBreaker(0, 0)
+	setDialBackoff(time.Second, time.Second, time.Second*2)
+	defer setDialBackoff(0, 0, 0)
+
+	ma, _ := multiaddr.NewMultiaddr("/ip4/1.2.3.4/tcp/4001")
+	ai := peer.AddrInfo{ID: randomPeerID(t), Addrs: []multiaddr.Multiaddr{ma}}
+
+	//失败后退避, 退避时间随失败次数增加
+	recordDialResult(ai, false)
+	if e := allowDial(ai); !errors.Is(e, ErrDialBackoff) || !isDialBackoff(e) {
+		t.Fatal("失败后应退避:", e)
+	}
+	fc.Advance(time.Second)
+	if e := allowDial(ai); e != nil {
+		t.Fatal("退避结束后应允许拨号:", e)
+	}
+	recordDialResult(ai, false)
+	fc.Advance(time.Second)
+	if e := allowDial(ai); !errors.Is(e, ErrDialBackoff) {
+		t.Fatal("第二次失败后退避应更长:", e)
+	}
+	fc.Advance(time.Second)
+
+	//连续失败达到次数后熔断
+	if e := allowDial(ai); e != nil {
+		t.Fatal("熔断前应允许拨号:", e)
+	}
+	recordDialResult(ai, false)
+	if e := allowDial(ai); !errors.Is(e, ErrCircuitOpen) {
+		t.Fatal("连续失败后应熔断:", e)
+	}
+	if states := CircuitBreakers(); len(states) != 1 || states[0].State != BREAKER_OPEN || states[0].Failures != 3 || !states[0].RetryAt.Equal(clock.Now().Add(time.Minute)) {
+		t.Fatal("熔断状态错误:", states)
+	}
+
+	//冷却结束后只允许一次试探, 试探失败时重新熔断
+	fc.Advance(time.Minute)
+	if e := allowDial(ai); e != nil {
+		t.Fatal("冷却结束后应允许试探:", e)
+	}
+	if e := allowDial(ai); !errors.Is(e, ErrCircuitOpen) {
+		t.Fatal("试探期间不应再拨号:", e)
+	}
+	recordDialResult(ai, false)
+	if e := allowDial(ai); !errors.Is(e, ErrCircuitOpen) {
+		t.Fatal("试探失败后应重新熔断:", e)
+	}
+
+	//试探成功时恢复
+	fc.Advance(time.Minute)
+	if e := allowDial(ai); e != nil {
+		t.Fatal(e)
+	}
+	recordDialResult(ai, true)
+	if states := CircuitBreakers(); len(states) != 0 {
+		t.Fatal("试探成功后应恢复:", states)
+	}
+
+	//地址变化时重新计数, 不退避
+	for i := 0; i < 3; i++ {
+		recordDialResult(ai, false)
+	}
+	ma2, _ := multiaddr.NewMultiaddr("/ip4/1.2.3.4/tcp/4002")
+	if e := allowDial(peer.AddrInfo{ID: ai.ID, Addrs: []multiaddr.Multiaddr{ma2}}); e != nil {
+		t.Fatal("地址变化后应允许拨号:", e)
+	}
+
+	//不熔断, 仍然退避
+	setDialBreaker(-1, 0)
+	for i := 0; i < 5; i++ {
+		recordDialResult(ai, false)
+	}
+	if e := allowDial(ai); !errors.Is(e, ErrDialBackoff) {
+		t.Fatal("关闭熔断时仍应退避:", e)
+	}
+	fc.Advance(time.Second * 2)
+	if e := allowDial(ai); e != nil {
+		t.Fatal("关闭熔断时应允许拨号:", e)
+	}
+}
+
+func TestConnectBreaker(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	setDialBreaker(2, time.Minute)
+	defer setDialBreaker(0, 0)
+	//退避很短, 每次都拨号. libp2p的退避由mp2p清除
+	setDialBackoff(time.Nanosecond, time.Nanosecond, time.Nanosecond)
+	defer setDialBackoff(0, 0, 0)
+
+	ma, _ := multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/1")
+	ai := peer.AddrInfo{ID: randomPeerID(t), Addrs: []multiaddr.Multiaddr{ma}}
+	for i := 0; i < 2; i++ {
+		if e := connect(ai); e == nil || errors.Is(e, ErrCircuitOpen) {
+			t.Fatal("熔断前应拨号失败:", i, e)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if e := connect(ai); !errors.Is(e, ErrCircuitOpen) || !isDialBackoff(e) {
+		t.Fatal("熔断后不应拨号:", e)
+	}
+	if n := GetStatus().OpenBreakers; n != 1 {
+		t.Fatal("状态中的熔断数量错误:", n)
+	}
+}
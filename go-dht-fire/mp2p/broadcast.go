@@ -0,0 +1,145 @@
+package mp2p
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_BROADCAST_TIMEOUT   = time.Second * 5 //每个节点的发送超时时间
+	DEFAULT_BROADCAST_IN_FLIGHT = 16              //同时发送的节点数量
+)
+
+// 广播选项
+type BroadcastOptions struct {
+	Timeout  time.Duration //每个节点的发送超时时间(打开流和写入), 默认5秒
+	InFlight int           //同时发送的节点数量, 默认16
+}
+
+// 广播结果
+type BroadcastResult struct {
+	Peer     peer.ID
+	Err      error         //发送出错, 成功时为nil
+	Duration time.Duration //发送耗时
+}
+
+// 广播处理
+// msgID: 消息ID, 同一消息只会处理一次
+type BroadcastHandler func(from peer.ID, msgID string, data []byte)
+
+// 设置广播处理, 重复的消息(相同消息ID)会被丢弃
+func SetBroadcastHandler(proto protocol.ID, handler BroadcastHandler) {
+	setBroadcastHandler(proto, handler, false)
+}
+
+// 设置广播处理, verified为true时只处理签名正确的消息
+// 先验证再去重, 伪造的消息不会占用真实消息的ID.
+func setBroadcastHandler(proto protocol.ID, handler BroadcastHandler, verified bool) {
+	protocols.Register(proto, func(s network.Stream) {
+		defer s.Close()
+
+		text, e := readTextFormStream(s)
+		if e != nil {
+			logMsg("broadcast.read_failed", e)
+			_ = s.Reset()
+			return
+		}
+		var msg requestMessage
+		e = json.Unmarshal([]byte(text), &msg)
+		if e != nil {
+			logMsg("broadcast.invalid", e)
+			_ = s.Reset()
+			return
+		}
+		from := s.Conn().RemotePeer()
+		if verified {
+			from, e = verifyMessage(proto, msg)
+			if e != nil {
+				logMsg("broadcast.unverified", s.Conn().RemotePeer().String(), e)
+				_ = s.Reset()
+				return
+			}
+		}
+		if dropDuplicate(msg) {
+			logMsg("broadcast.duplicate", from.String(), msg.ID)
+			return
+		}
+		handler(from, msg.ID, msg.Data)
+	})
+}
+
+// 广播消息, 返回每个节点的结果(与ids顺序相同)
+// ids为空时发送给所有已连接节点. 每个节点在单独的协程中发送并有单独的超时, 慢节点不会拖慢其它节点;
+// 同时发送的节点数量有上限. 上下文结束时未开始发送的节点返回上下文的错误.
+func Broadcast(ctx context.Context, ids []peer.ID, proto protocol.ID, data []byte, opts *BroadcastOptions) []BroadcastResult {
+	return broadcast(ctx, ids, proto, requestMessage{ID: newMessageID(), Data: data}, opts)
+}
+
+// 广播消息, Broadcast和VerifiedBroadcast共用
+func broadcast(ctx context.Context, ids []peer.ID, proto protocol.ID, msg requestMessage, opts *BroadcastOptions) []BroadcastResult {
+	o := BroadcastOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DEFAULT_BROADCAST_TIMEOUT
+	}
+	if o.InFlight <= 0 {
+		o.InFlight = DEFAULT_BROADCAST_IN_FLIGHT
+	}
+	if len(ids) == 0 {
+		ids = node.Network().Peers()
+	}
+
+	//自己发出的消息不再处理
+	dropDuplicate(msg)
+
+	results := make([]BroadcastResult, len(ids))
+	sem := make(chan struct{}, o.InFlight)
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		results[i].Peer = id
+
+		select {
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(i int, id peer.ID) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			start := clock.Now()
+			results[i].Err = broadcastTo(ctx, id, proto, msg, o.Timeout)
+			results[i].Duration = clock.Now().Sub(start)
+		}(i, id)
+	}
+	wg.Wait()
+	return results
+}
+
+// 发送广播消息给一个节点
+func broadcastTo(ctx context.Context, id peer.ID, proto protocol.ID, msg requestMessage, timeout time.Duration) error {
+	sendCtx, sendCancel := context.WithTimeout(ctx, timeout)
+	defer sendCancel()
+
+	s, e := node.NewStream(sendCtx, id, proto)
+	if e != nil {
+		return e
+	}
+	_ = s.SetWriteDeadline(time.Now().Add(timeout))
+	e = writeJSONToStream(s, msg)
+	if e != nil {
+		_ = s.Reset()
+		return e
+	}
+	return s.Close()
+}
@@ -0,0 +1,102 @@
+package mp2p
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"testing"
+	"time"
+)
+
+func TestBroadcastResults(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+
+	received := make(chan string, 1)
+	var remotes []host.Host
+	for i := 0; i < 2; i++ {
+		remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if e != nil {
+			t.Fatal(e)
+		}
+		defer remote.Close()
+		node.Peerstore().AddAddrs(remote.ID(), remote.Addrs(), peerstore.TempAddrTTL)
+		remotes = append(remotes, remote)
+	}
+
+	//只有第一个节点支持协议
+	remotes[0].SetStreamHandler("/mp2p/test/broadcast", func(s network.Stream) {
+		text, _ := readTextFormStream(s)
+		var msg requestMessage
+		_ = json.Unmarshal([]byte(text), &msg)
+		received <- string(msg.Data)
+	})
+
+	results := Broadcast(context.Background(), []peer.ID{remotes[0].ID(), remotes[1].ID()}, "/mp2p/test/broadcast", []byte("你好"), &BroadcastOptions{Timeout: time.Second * 5, InFlight: 1})
+	if len(results) != 2 {
+		t.Fatal("结果数量错误:", len(results))
+	}
+	if results[0].Peer != remotes[0].ID() || results[0].Err != nil {
+		t.Fatal("第一个节点应发送成功:", results[0].Err)
+	}
+	if results[1].Err == nil {
+		t.Fatal("不支持协议的节点应返回错误")
+	}
+	select {
+	case data := <-received:
+		if data != "你好" {
+			t.Fatal("收到的数据错误:", data)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("没有收到广播")
+	}
+}
+
+// 收到的广播先去重再处理, 同一消息只处理一次
+func TestBroadcastHandlerDropDuplicate(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	seenMessages = newSeenCache(0, 0)
+	const proto = "/mp2p/test/broadcast-seen"
+
+	handled := make(chan string, 3)
+	SetBroadcastHandler(proto, func(from peer.ID, msgID string, data []byte) {
+		handled <- string(data)
+	})
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer remote.Close()
+	remote.Peerstore().AddAddrs(node.ID(), node.Addrs(), peerstore.TempAddrTTL)
+
+	//同一消息转发两次, 然后发送另一条消息
+	msg := requestMessage{ID: newMessageID(), Data: []byte("你好")}
+	for _, m := range []requestMessage{msg, msg, {ID: newMessageID(), Data: []byte("另一条")}} {
+		s, e := remote.NewStream(ctx, node.ID(), proto)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if e = writeJSONToStream(s, m); e != nil {
+			t.Fatal(e)
+		}
+		//等待处理关闭流, 保证按顺序处理
+		_, _ = readTextFormStream(s)
+		_ = s.Close()
+	}
+
+	for _, want := range []string{"你好", "另一条"} {
+		select {
+		case data := <-handled:
+			if data != want {
+				t.Fatal("重复的消息应丢弃:", data)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("没有处理广播:", want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package mp2p
+
+import (
+	"time"
+)
+
+// 时钟
+// 包内所有计时都通过时钟, 测试时可替换为假时钟, 无需真实等待.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+}
+
+// 真实时钟
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+var clock Clock = realClock{}
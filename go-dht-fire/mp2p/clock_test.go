@@ -0,0 +1,122 @@
+package mp2p
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// 假时钟, 调用Advance时才前进
+type fakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1600000000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), c: ch})
+	return ch
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// 前进d, 触发到期的等待
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	var waiters []fakeWaiter
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = waiters
+}
+
+// 等待有d后到期的等待者, 用于确认协程已经在等待假时钟
+func (c *fakeClock) waitForWaiter(d time.Duration) {
+	for {
+		c.lock.Lock()
+		at := c.now.Add(d)
+		for _, w := range c.waiters {
+			if w.at.Equal(at) {
+				c.lock.Unlock()
+				return
+			}
+		}
+		c.lock.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// 使用假时钟, 返回恢复函数
+func useFakeClock() (*fakeClock, func()) {
+	old := clock
+	c := newFakeClock()
+	clock = c
+	return c, func() {
+		clock = old
+	}
+}
+
+func TestFakeClockAfter(t *testing.T) {
+	c := newFakeClock()
+	ch := c.After(time.Minute)
+	c.Advance(time.Second * 59)
+	select {
+	case <-ch:
+		t.Fatal("未到时间不应触发")
+	default:
+	}
+	c.Advance(time.Second)
+	select {
+	case <-ch:
+	default:
+		t.Fatal("到时间应触发")
+	}
+}
+
+func TestSeenCacheTTLFakeClock(t *testing.T) {
+	fc, restore := useFakeClock()
+	defer restore()
+
+	c := newSeenCache(10, time.Minute)
+	if c.seen("a") {
+		t.Fatal("第一次不应见过")
+	}
+	fc.Advance(time.Second * 30)
+	if !c.seen("a") {
+		t.Fatal("TTL内应见过")
+	}
+	fc.Advance(time.Minute)
+	if c.seen("a") {
+		t.Fatal("过期后不应见过")
+	}
+}
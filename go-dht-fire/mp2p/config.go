@@ -0,0 +1,464 @@
+package mp2p
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/multiformats/go-multiaddr"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_KEY_DIR = "./config/rsa"
+
+	DHT_DEFAULT_PREFIX      = "/ipfs" //libp2p默认DHT协议前缀
+	DHT_DEFAULT_BUCKET_SIZE = 20      //libp2p默认DHT桶大小, 默认前缀必须使用
+	DHT_MAX_BUCKET_SIZE     = 100
+	DHT_MAX_CONCURRENCY     = 32
+)
+
+// 配置错误, 包含所有问题
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return strings.Join([]string{"配置错误: ", strings.Join(e.Problems, "; ")}, "")
+}
+
+// 配置
+// 使用DefaultConfig获取默认配置后再修改.
+type Config struct {
+	Port          string //端口, 0为随机
+	BootstrapAddr string //启发节点P2P地址
+	DualDHT       bool   //同时运行局域网和互联网DHT(同IPFS), 默认只运行一个DHT
+	EnableDHT     bool   //运行DHT, 默认开启. 关闭时只通过引导交换节点, 也不自动寻找中继(AutoRelay), 适合节点固定的小网络
+
+	// DHT协议前缀, 默认/ipfs(同IPFS公共DHT). 使用其它前缀时成为独立的DHT网络, 才能修改DHTBucketSize
+	DHTProtocolPrefix string
+	// DHT路由参数, 为0时使用libp2p默认值
+	// DHTBucketSize: 每个桶的节点数量(Kademlia的k), 默认20. 小网络可减小以减少查询, 但节点离开时路由更容易失效
+	// DHTConcurrency: 每次查询同时请求的节点数量(alpha), 默认3. 增大可加快查询, 但增加流量
+	// DHTResiliency: 查询结束前需要回复的最近节点数量(beta), 默认3. 增大结果更可靠, 但查询更慢
+	DHTBucketSize  int
+	DHTConcurrency int
+	DHTResiliency  int
+	KeyDir         string //密钥目录, 默认 ./config/rsa
+	KeyType        string //没有密钥时生成的密钥类型, rsa, ed25519, secp256k1或ecdsa, 默认ed25519. 已有的密钥不受影响
+
+	// 要求已有密钥, 没有密钥时启动失败而不是生成新密钥(新的节点ID), 默认自动生成
+	// 用于生产环境, 防止密钥目录挂载错误时节点身份悄悄改变. 不会写入密钥, 密钥目录可以只读.
+	RequireExistingKey bool
+
+	BootstrapAddrs []string //更多启发节点P2P地址, 与BootstrapAddr和BootstrapFile合并
+	BootstrapFile  string   //启发节点文件, 每行一个P2P地址(忽略空行和#注释)或JSON数组
+
+	BootstrapConcurrency int //同时引导的启发节点数量, 默认4
+	MinBootstrapPeers    int //引导成功多少个启发节点后继续启动, 其余的在后台引导, 默认1
+
+	BootstrapStreamRetries int //连接启发节点后打开引导流失败时的重试次数, 默认3, 小于0时不重试
+
+	// 引导回复的最大节点数量, 默认不限(回复所有缓存节点)
+	// 超过时按BootstrapSelection选择回复的节点, 节点多时可减小回复和请求节点的拨号.
+	BootstrapResponseLimit int
+	// 引导回复的节点选择策略, BOOTSTRAP_SELECT_RANDOM(默认), BOOTSTRAP_SELECT_ROUND_ROBIN或BOOTSTRAP_SELECT_RECENT
+	// 回复的节点按节点ID(最近优先时按最后发现或连接的时间)排序, 不受map遍历顺序影响.
+	BootstrapSelection     string
+	BootstrapSelectionSeed int64 //随机选择的种子, 设置后选择序列可重现(用于测试和复现问题), 默认使用当前时间
+
+	// 连接IPFS公共启发节点(dht.DefaultBootstrapPeers), 加入IPFS公共DHT
+	// 节点会对IPFS网络可见并处理其DHT请求, 只用于实验.
+	UseIPFSBootstrap bool
+
+	EnableNAT       bool   //NAT穿越(UPnP/NAT-PMP端口映射), 默认开启. 有公网IP的节点可关闭以加快启动
+	NATProtocol     string //优先使用的NAT协议, NAT_PROTOCOL_UPNP或NAT_PROTOCOL_NATPMP, 失败时尝试另一个. 默认使用先发现的
+	NATProtocolOnly bool   //只使用NATProtocol, 不尝试另一个协议
+
+	// NAT网关, 设置后不发现网关, 只使用该网关映射端口(模拟网络中也会映射)
+	// 用于测试续期, 端口变化和映射失败, 或使用自己实现的端口映射. 需开启EnableNAT, 默认使用go-nat发现的网关.
+	NATGateway NATGateway
+
+	// 端口映射描述和租期, 键为协议(tcp或udp), 没有设置的协议使用默认值
+	// 例如 {"udp": {Description: "mp2p quic", Lease: time.Hour}}. 续期间隔为最短租期的一半.
+	NATMappings map[string]NATMappingOptions
+
+	// NAT地址变化回调, 端口映射成功时对新地址调用(reachable为true)
+	// 续期时外部端口或公网IP变化, 续期失败, 停止时移除映射都会对失去的地址调用(reachable为false). 在NAT协程中调用, 不要阻塞.
+	OnNATChange func(addr multiaddr.Multiaddr, reachable bool)
+
+	// 宣告地址(NAT映射)变化时主动向已连接节点推送标识(identify-push), 默认开启
+	// 开启时NAT地址也加入节点地址, 通过标识协议告知其它节点.
+	IdentifyPush bool
+
+	// 监听地址, 默认监听所有IPv4地址的Port端口(TCP和QUIC)
+	// 多网卡时可指定具体IP, 例如 /ip4/192.168.1.2/udp/60000/quic , IP必须属于本机网卡.
+	ListenAddrs []string
+
+	// 端口被占用时改用随机端口并记录日志, 默认监听失败时退出
+	// NAT映射和宣告地址使用实际监听的端口. 适合多个程序共用的主机.
+	PortFallback bool
+
+	// Unix域套接字路径, 设置后同时监听该套接字, 用于同一主机的进程间通信
+	// 套接字文件权限为0600, 只有运行节点的用户可以连接. 停止时删除.
+	UnixSocketPath string
+
+	// 宣告地址过滤, 返回false的地址不宣告(节点地址, NAT地址, 引导回复中的节点地址)
+	// 默认不宣告回环, 链路本地和Unix域套接字地址. 例如可过滤docker网桥地址.
+	AnnounceFilter func(ma multiaddr.Multiaddr) bool
+
+	// 宣告IPv6链路本地(fe80::/10)和唯一本地(fc00::/7)地址, 默认不宣告(节点地址, NAT地址, 引导回复中的节点地址)
+	// 这些地址在其它网络不可达. 只在同一链路或站点内组网时开启, 过滤先于AnnounceFilter.
+	AnnounceIPv6Local bool
+
+	// 宣告地址, 设置后节点只宣告这些地址(节点地址, 引导请求, 状态), 不使用NAT映射和监听得到的地址
+	// 用于已知公网地址的部署, 例如云负载均衡或代理后面. 不经过宣告地址过滤, 可以带或不带 /p2p/<节点ID> .
+	AnnounceAddrs []string
+
+	// 观察地址阈值, 其它节点看到的自己的地址(引导回复和标识协议)至少被这么多个不同IP的节点报告后才加入宣告地址, 默认4(同libp2p)
+	// 防止单个节点报告错误的地址毒化宣告地址. 当前的候选和观察者数量见ObservedAddrs.
+	ObservedAddrThreshold int
+
+	Rendezvous         string        //汇合点, 设置后通过DHT宣告和查找同一汇合点的节点
+	RendezvousInterval time.Duration //重新宣告汇合点的间隔, 默认1分钟
+
+	// 拨号退避, 只影响mp2p的拨号(引导, 交换得到的节点, 重连等), 不修改libp2p的全局设置
+	DialBackoffBase time.Duration //拨号失败后的退避时间, 默认5秒
+	DialBackoffCoef time.Duration //退避系数, 退避时间为 base + coef * (失败次数-1)^2, 默认1秒
+	DialBackoffMax  time.Duration //最长退避时间, 默认5分钟
+
+	// 拨号熔断: 节点同一组地址连续拨号失败BreakerFailures次(默认5, 小于0时不熔断)后, BreakerCooldown(默认5分钟)内不再拨号
+	// 冷却结束后试探拨号一次, 成功时恢复, 失败时重新熔断. 地址变化或对方连接过来时恢复. 当前状态见CircuitBreakers.
+	BreakerFailures int
+	BreakerCooldown time.Duration
+
+	// 同时拨号的最大数量, 默认32, 小于0时不限. 超出的拨号(引导, 交换得到的节点, 重连等)排队等待
+	// 防止大量同时拨号占满家用路由器的NAT表.
+	MaxDials int
+
+	FilterPrivateAddrs bool //禁止拨号私有网段地址(互联网节点加固), 局域网测试时必须关闭
+	MaxConnsPerIP      int  //每个IP的最大进入连接数量, 默认不限
+	MaxStreamsPerPeer  int  //每个节点的最大并发进入流数量(mp2p协议), 超过时重置新的流, 默认64
+
+	MaxHandlers         int           //所有节点同时处理的进入流数量(mp2p协议), 超过时排队, 默认512
+	HandlerQueueTimeout time.Duration //处理已满时进入流的排队时间, 超时后重置流, 默认1秒
+
+	MaxReconnects int //受保护的节点意外断开后自动重连, 同时拨号重连的节点数量, 默认8
+
+	EventBufferSize int    //事件信道(Events)缓冲数量, 默认256
+	EventDropPolicy string //事件缓冲满时的丢弃策略, EVENT_DROP_NEWEST(默认)或EVENT_DROP_OLDEST, 发出事件从不阻塞
+
+	// 每个协议的流读写期限, 按协商的协议ID匹配
+	// 进入流(mp2p协议)在处理开始时设置, Request没有设置Timeout时使用. 引导协议默认读写各10秒, 其它协议的进入流默认不限.
+	// 例如文件传输协议设置较长的期限, 避免大文件被中断.
+	StreamDeadlines map[protocol.ID]StreamDeadline
+
+	// 指标导出, 节点启动后启动, 关闭节点时关闭. 各导出共用CollectMetrics的指标, 互不影响
+	// 例如OpenTelemetry导出(子模块otelmetrics). 默认不导出.
+	MetricsExporters []MetricsExporter
+
+	UserAgent string //标识协议中的节点代理, 默认 mp2p/<版本>
+	Language  string //日志语言, LANGUAGE_EN或LANGUAGE_ZH, 默认英文
+
+	// 日志格式, LOG_FORMAT_TEXT(默认, 使用标准库log)或LOG_FORMAT_JSON
+	// JSON每行一个对象, 包含时间, 级别(info, warn, fatal), 组件(键的前缀), 键, 消息, 节点ID(有时)和其余参数, 便于日志收集.
+	LogFormat string
+	// 日志文件, 设置后日志写入该文件而不是标准错误输出, 超过LogMaxSize字节或LogMaxAge时轮转为 <文件>.1 , <文件>.2 ...
+	LogFile       string
+	LogMaxSize    int64         //日志文件最大字节数, 默认10MB
+	LogMaxAge     time.Duration //日志文件最长使用时间, 默认不按时间轮转
+	LogMaxBackups int           //保留的旧日志文件数量, 默认5
+
+	BootstrapAddrTTL time.Duration //启发节点地址在节点存储中的保留时间, 默认24小时
+	GossipAddrTTL    time.Duration //引导和汇合点交换得到的节点地址在节点存储中的保留时间, 默认10分钟
+
+	LostPeerCycles int //节点连续多少次刷新不在DHT路由表中(且未连接)时视为失去, 从缓存中移除, 默认3
+
+	PeerFile string        //节点文件, 保存连接过的节点, 启动时重连. 为空时不保存
+	PeerTTL  time.Duration //连接失败的节点在节点文件中的保留时间, 默认24小时
+
+	SeenCacheSize int           //转发消息去重缓存数量, 默认10000
+	SeenCacheTTL  time.Duration //转发消息去重缓存时间, 默认2分钟
+
+	// mp2p记录的内存上限(字节, 估计值), 默认不限, 最小64KB. 用于手机和嵌入式设备
+	// 事件缓冲最多占1/8, 去重缓存最多占1/4(超过时减少EventBufferSize和SeenCacheSize), 其余给节点缓存, 已知节点和分数.
+	// 节点记录超过预算时移除未连接且不受保护的节点中分数最低的. 不包括libp2p的节点存储和DHT. 当前用量见Status.Memory.
+	MaxMemoryBytes int64
+
+	// 引导请求拦截, 发送引导请求(2.0.0)前调用, 可修改请求, 例如在Meta中加入认证令牌
+	RequestInterceptor func(req *BootstrapRequest)
+	// 引导回复拦截, 处理引导请求时回复前调用, 可修改回复. 返回错误时拒绝请求(重置流)且不缓存请求节点
+	// 旧版本协议(1.0.0)的请求同样经过拦截, 其Meta为空, 只修改回复的Peers.
+	ResponseInterceptor func(from peer.ID, req *BootstrapRequest, res *BootstrapResponse) error
+
+	Clock Clock //时钟, 默认使用真实时间, 测试时可替换
+
+	// 节点存储, 默认使用内存存储
+	// 可使用数据库存储(例如 go-libp2p-peerstore/pstoreds), 重启后保留节点数据. 由调用方创建和关闭.
+	Peerstore peerstore.Peerstore
+
+	// 模拟网络, 只用于测试. 设置后节点在模拟网络中创建, 不使用系统网络, 不做NAT穿越
+	// 监听地址只用于宣告, 需要用LinkMockHosts链接节点. UnixSocketPath, ListenAddrs中的传输和连接过滤不生效.
+	MockNet mocknet.Mocknet
+}
+
+// 默认配置
+func DefaultConfig() Config {
+	return Config{
+		Port:         "0",
+		KeyDir:       DEFAULT_KEY_DIR,
+		EnableDHT:    true,
+		EnableNAT:    true,
+		IdentifyPush: true,
+		PeerFile:     "./config/peers.json",
+	}
+}
+
+// 检查DHT参数范围
+func (c Config) validateDHT() []string {
+	var problems []string
+	defaultPrefix := c.DHTProtocolPrefix == "" || c.DHTProtocolPrefix == DHT_DEFAULT_PREFIX
+	if c.DHTProtocolPrefix != "" && !strings.HasPrefix(c.DHTProtocolPrefix, "/") {
+		problems = append(problems, fmt.Sprintf("DHT协议前缀必须以/开头: %s", c.DHTProtocolPrefix))
+	}
+	if c.UseIPFSBootstrap && !defaultPrefix {
+		problems = append(problems, "UseIPFSBootstrap需要使用默认DHT协议前缀")
+	}
+
+	bucketSize := DHT_DEFAULT_BUCKET_SIZE
+	if c.DHTBucketSize != 0 {
+		bucketSize = c.DHTBucketSize
+		if c.DHTBucketSize < 0 || c.DHTBucketSize > DHT_MAX_BUCKET_SIZE {
+			problems = append(problems, fmt.Sprintf("DHT桶大小应在1到%d之间: %d", DHT_MAX_BUCKET_SIZE, c.DHTBucketSize))
+		} else if defaultPrefix && c.DHTBucketSize != DHT_DEFAULT_BUCKET_SIZE {
+			problems = append(problems, fmt.Sprintf("默认DHT协议前缀只能使用桶大小%d, 请设置DHTProtocolPrefix", DHT_DEFAULT_BUCKET_SIZE))
+		}
+	}
+	if c.DHTConcurrency < 0 || c.DHTConcurrency > DHT_MAX_CONCURRENCY {
+		problems = append(problems, fmt.Sprintf("DHT查询并发应在1到%d之间: %d", DHT_MAX_CONCURRENCY, c.DHTConcurrency))
+	}
+	if c.DHTResiliency < 0 || c.DHTResiliency > bucketSize {
+		problems = append(problems, fmt.Sprintf("DHT查询回复数量应在1到桶大小%d之间: %d", bucketSize, c.DHTResiliency))
+	}
+	return problems
+}
+
+// 检查配置, 不监听端口也不连接网络
+// 检查端口范围, 解析所有地址, 确认密钥目录和套接字目录可写. 有问题时返回包含所有问题的ConfigError.
+func (c Config) Validate() error {
+	var problems []string
+
+	if c.Port != "" {
+		port, e := strconv.Atoi(c.Port)
+		if e != nil || port < 0 || port > 65535 {
+			problems = append(problems, fmt.Sprintf("端口错误: %s", c.Port))
+		}
+	}
+
+	addrs, e := bootstrapAddrs(c)
+	if e != nil {
+		problems = append(problems, e.Error())
+	}
+	for _, addr := range addrs {
+		_, e = textToAddrInfo(addr)
+		if e != nil {
+			problems = append(problems, fmt.Sprintf("启发节点地址错误 %s: %v", addr, e))
+		}
+	}
+
+	for _, addr := range c.ListenAddrs {
+		_, e = multiaddr.NewMultiaddr(addr)
+		if e != nil {
+			problems = append(problems, fmt.Sprintf("监听地址错误 %s: %v", addr, e))
+		}
+	}
+	for _, addr := range c.AnnounceAddrs {
+		_, e = parseAnnounceAddr(addr)
+		if e != nil {
+			problems = append(problems, fmt.Sprintf("宣告地址错误 %s: %v", addr, e))
+		}
+	}
+
+	switch c.NATProtocol {
+	case "", NAT_PROTOCOL_UPNP, NAT_PROTOCOL_NATPMP:
+	default:
+		problems = append(problems, fmt.Sprintf("NAT协议错误: %s", c.NATProtocol))
+	}
+	if !c.EnableDHT && (c.DualDHT || c.Rendezvous != "" || c.UseIPFSBootstrap) {
+		problems = append(problems, "DualDHT, Rendezvous和UseIPFSBootstrap需要启用DHT")
+	}
+	problems = append(problems, c.validateDHT()...)
+	if _, e := ParseKeyType(c.KeyType); e != nil {
+		problems = append(problems, e.Error())
+	}
+	switch c.BootstrapSelection {
+	case "", BOOTSTRAP_SELECT_RANDOM, BOOTSTRAP_SELECT_ROUND_ROBIN, BOOTSTRAP_SELECT_RECENT:
+	default:
+		problems = append(problems, fmt.Sprintf("引导节点选择策略错误: %s", c.BootstrapSelection))
+	}
+	if c.BootstrapResponseLimit < 0 {
+		problems = append(problems, fmt.Sprintf("引导回复节点数量错误: %d", c.BootstrapResponseLimit))
+	}
+	switch c.EventDropPolicy {
+	case "", EVENT_DROP_NEWEST, EVENT_DROP_OLDEST:
+	default:
+		problems = append(problems, fmt.Sprintf("事件丢弃策略错误: %s", c.EventDropPolicy))
+	}
+	switch c.LogFormat {
+	case "", LOG_FORMAT_TEXT, LOG_FORMAT_JSON:
+	default:
+		problems = append(problems, fmt.Sprintf("日志格式错误: %s", c.LogFormat))
+	}
+	if c.LogFile != "" {
+		e = checkWritableDir(filepath.Dir(c.LogFile))
+		if e != nil {
+			problems = append(problems, fmt.Sprintf("日志目录不可写 %s: %v", c.LogFile, e))
+		}
+	}
+	if c.ObservedAddrThreshold < 0 {
+		problems = append(problems, fmt.Sprintf("观察地址阈值错误: %d", c.ObservedAddrThreshold))
+	}
+	if c.MaxMemoryBytes < 0 || (c.MaxMemoryBytes > 0 && c.MaxMemoryBytes < MIN_MEMORY_BYTES) {
+		problems = append(problems, fmt.Sprintf("内存上限应不小于%d字节: %d", MIN_MEMORY_BYTES, c.MaxMemoryBytes))
+	}
+	if c.EventBufferSize < 0 {
+		problems = append(problems, fmt.Sprintf("事件缓冲数量错误: %d", c.EventBufferSize))
+	}
+	if c.BreakerCooldown < 0 {
+		problems = append(problems, fmt.Sprintf("熔断冷却时间错误: %s", c.BreakerCooldown))
+	}
+	if c.NATProtocolOnly && c.NATProtocol == "" {
+		problems = append(problems, "NATProtocolOnly需要设置NATProtocol")
+	}
+	for proto, d := range c.StreamDeadlines {
+		if d.Read < 0 || d.Write < 0 {
+			problems = append(problems, fmt.Sprintf("%s流期限错误: %s, %s", proto, d.Read, d.Write))
+		}
+	}
+	for protocol, o := range c.NATMappings {
+		if protocol != "tcp" && protocol != "udp" {
+			problems = append(problems, fmt.Sprintf("端口映射协议错误: %s", protocol))
+		}
+		if o.Lease < 0 {
+			problems = append(problems, fmt.Sprintf("%s端口映射租期错误: %s", protocol, o.Lease))
+		}
+	}
+
+	//要求已有密钥时不会写入密钥, 密钥目录可以只读挂载
+	keyDir, e := cleanKeyDir(c.KeyDir)
+	if e != nil {
+		problems = append(problems, e.Error())
+	} else if e = checkWritableDir(keyDir); e != nil && !c.RequireExistingKey {
+		problems = append(problems, fmt.Sprintf("密钥目录不可写 %s: %v", keyDir, e))
+	}
+
+	if c.UnixSocketPath != "" {
+		e = checkWritableDir(filepath.Dir(c.UnixSocketPath))
+		if e != nil {
+			problems = append(problems, fmt.Sprintf("套接字目录不可写 %s: %v", c.UnixSocketPath, e))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// 检查目录可写, 目录不存在时检查最近的上级目录(不创建目录)
+func checkWritableDir(dir string) error {
+	dir = filepath.Clean(dir)
+	for {
+		info, e := os.Stat(dir)
+		if e == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("不是目录: %s", dir)
+			}
+			break
+		}
+		if !os.IsNotExist(e) {
+			return e
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return e
+		}
+		dir = parent
+	}
+
+	f, e := ioutil.TempFile(dir, ".mp2p-check-")
+	if e != nil {
+		return e
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
+// 获取所有启发节点地址, 合并BootstrapAddr, BootstrapAddrs和BootstrapFile, 去掉重复
+func bootstrapAddrs(c Config) ([]string, error) {
+	var addrs []string
+	if c.BootstrapAddr != "" {
+		addrs = append(addrs, c.BootstrapAddr)
+	}
+	addrs = append(addrs, c.BootstrapAddrs...)
+	if c.BootstrapFile != "" {
+		fileAddrs, e := readBootstrapFile(c.BootstrapFile)
+		if e != nil {
+			return nil, e
+		}
+		addrs = append(addrs, fileAddrs...)
+	}
+
+	var result []string
+	exists := make(map[string]bool)
+	for _, addr := range addrs {
+		if exists[addr] {
+			continue
+		}
+		exists[addr] = true
+		result = append(result, addr)
+	}
+	return result, nil
+}
+
+// 读取启发节点文件
+// 文件内容为JSON数组, 或每行一个地址(忽略空行和#注释).
+func readBootstrapFile(path string) ([]string, error) {
+	data, e := ioutil.ReadFile(path)
+	if os.IsNotExist(e) {
+		return nil, fmt.Errorf("启发节点文件不存在: %s", path)
+	}
+	if e != nil {
+		return nil, e
+	}
+
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		var addrs []string
+		e = json.Unmarshal(data, &addrs)
+		if e != nil {
+			return nil, fmt.Errorf("启发节点文件格式错误 %s: %w", path, e)
+		}
+		return addrs, nil
+	}
+
+	var addrs []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		addrs = append(addrs, line)
+	}
+	return addrs, scanner.Err()
+}
@@ -0,0 +1,117 @@
+package mp2p
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBootstrapAddrsFromFile(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mp2p")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	a := "/ip4/1.2.3.4/udp/60000/quic/ipfs/QmXDunpuNNS93eCEv66UnAzuMBgdENZY7MSE3TuhXNtEjv"
+	b := "/ip4/5.6.7.8/udp/60000/quic/ipfs/QmXDunpuNNS93eCEv66UnAzuMBgdENZY7MSE3TuhXNtEjv"
+
+	textPath := filepath.Join(dir, "bootstrap.txt")
+	_ = ioutil.WriteFile(textPath, []byte(strings.Join([]string{"# 启发节点", a, "", "  " + b + "  "}, "\n")), 0644)
+	addrs, e := bootstrapAddrs(Config{BootstrapAddr: a, BootstrapFile: textPath})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(addrs) != 2 || addrs[0] != a || addrs[1] != b {
+		t.Fatal("地址错误:", addrs)
+	}
+
+	jsonPath := filepath.Join(dir, "bootstrap.json")
+	_ = ioutil.WriteFile(jsonPath, []byte(`["`+a+`","`+b+`"]`), 0644)
+	addrs, e = bootstrapAddrs(Config{BootstrapFile: jsonPath})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(addrs) != 2 {
+		t.Fatal("地址错误:", addrs)
+	}
+
+	_, e = bootstrapAddrs(Config{BootstrapFile: filepath.Join(dir, "none")})
+	if e == nil {
+		t.Fatal("文件不存在时应返回错误")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mp2p")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	c := DefaultConfig()
+	c.KeyDir = filepath.Join(dir, "rsa")
+	e = c.Validate()
+	if e != nil {
+		t.Fatal("默认配置应正确:", e)
+	}
+	if _, e = os.Stat(c.KeyDir); !os.IsNotExist(e) {
+		t.Fatal("检查配置不应创建密钥目录")
+	}
+
+	c.Port = "70000"
+	c.BootstrapAddr = "/ip4/1.2.3.4/udp/60000/quic"
+	c.ListenAddrs = []string{"/ip4/1.2.3.4/udp/abc"}
+	c.NATProtocol = "pcp"
+	e = c.Validate()
+	var configErr *ConfigError
+	if !errors.As(e, &configErr) {
+		t.Fatal("应返回ConfigError:", e)
+	}
+	if len(configErr.Problems) != 4 {
+		t.Fatal("问题数量错误:", configErr.Problems)
+	}
+}
+
+// 要求已有密钥时不检查密钥目录可写
+func TestValidateReadOnlyKeyDir(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mp2p")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	//上级是文件, 任何用户(包括root)都不能写入
+	if e = ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0600); e != nil {
+		t.Fatal(e)
+	}
+
+	c := DefaultConfig()
+	c.KeyDir = filepath.Join(dir, "file", "rsa")
+	var configErr *ConfigError
+	if e = c.Validate(); !errors.As(e, &configErr) || len(configErr.Problems) != 1 {
+		t.Fatal("密钥目录不可写时应出错:", e)
+	}
+	c.RequireExistingKey = true
+	if e = c.Validate(); e != nil {
+		t.Fatal("要求已有密钥时不应检查可写:", e)
+	}
+}
+
+func TestValidateDHT(t *testing.T) {
+	c := Config{DHTBucketSize: 8}
+	if len(c.validateDHT()) != 1 {
+		t.Fatal("默认协议前缀不能修改桶大小")
+	}
+	c.DHTProtocolPrefix = "/myapp"
+	if problems := c.validateDHT(); len(problems) != 0 {
+		t.Fatal("独立DHT可以修改桶大小:", problems)
+	}
+	c.DHTConcurrency = 100
+	c.DHTResiliency = 9
+	if len(c.validateDHT()) != 2 {
+		t.Fatal("并发和回复数量超出范围应报错")
+	}
+}
@@ -0,0 +1,238 @@
+package mp2p
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CONFIG_ENV_PREFIX = "MP2P_" //环境变量覆盖配置文件的前缀, 例如 MP2P_PORT, MP2P_BOOTSTRAP_ADDRS
+)
+
+var ErrConfigFile = errors.New("配置文件错误")
+
+// 配置文件中的时间, 使用Go的时间格式, 例如"10s", "5m", "1h30m"
+type configDuration time.Duration
+
+func (d *configDuration) set(text string) error {
+	v, e := time.ParseDuration(text)
+	if e != nil {
+		return e
+	}
+	*d = configDuration(v)
+	return nil
+}
+
+func (d *configDuration) UnmarshalJSON(data []byte) error {
+	var text string
+	if e := json.Unmarshal(data, &text); e != nil {
+		return fmt.Errorf("时间应为字符串, 例如\"10s\": %s", data)
+	}
+	return d.set(text)
+}
+
+func (d *configDuration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var text string
+	if e := unmarshal(&text); e != nil {
+		return e
+	}
+	return d.set(text)
+}
+
+// 配置文件, 字段名为Config字段的蛇形命名, YAML和JSON相同
+// 只包含可以写成文本的配置, 回调, 接口(例如AnnounceFilter, NATGateway, Peerstore)和按协议的设置需在代码中设置.
+type fileConfig struct {
+	Port          string `yaml:"port" json:"port"`
+	BootstrapAddr string `yaml:"bootstrap_addr" json:"bootstrap_addr"`
+	DualDHT       bool   `yaml:"dual_dht" json:"dual_dht"`
+	EnableDHT     bool   `yaml:"enable_dht" json:"enable_dht"`
+
+	DHTProtocolPrefix  string `yaml:"dht_protocol_prefix" json:"dht_protocol_prefix"`
+	DHTBucketSize      int    `yaml:"dht_bucket_size" json:"dht_bucket_size"`
+	DHTConcurrency     int    `yaml:"dht_concurrency" json:"dht_concurrency"`
+	DHTResiliency      int    `yaml:"dht_resiliency" json:"dht_resiliency"`
+	KeyDir             string `yaml:"key_dir" json:"key_dir"`
+	KeyType            string `yaml:"key_type" json:"key_type"`
+	RequireExistingKey bool   `yaml:"require_existing_key" json:"require_existing_key"`
+
+	BootstrapAddrs         []string `yaml:"bootstrap_addrs" json:"bootstrap_addrs"`
+	BootstrapFile          string   `yaml:"bootstrap_file" json:"bootstrap_file"`
+	BootstrapConcurrency   int      `yaml:"bootstrap_concurrency" json:"bootstrap_concurrency"`
+	MinBootstrapPeers      int      `yaml:"min_bootstrap_peers" json:"min_bootstrap_peers"`
+	BootstrapStreamRetries int      `yaml:"bootstrap_stream_retries" json:"bootstrap_stream_retries"`
+	BootstrapResponseLimit int      `yaml:"bootstrap_response_limit" json:"bootstrap_response_limit"`
+	BootstrapSelection     string   `yaml:"bootstrap_selection" json:"bootstrap_selection"`
+	BootstrapSelectionSeed int64    `yaml:"bootstrap_selection_seed" json:"bootstrap_selection_seed"`
+	UseIPFSBootstrap       bool     `yaml:"use_ipfs_bootstrap" json:"use_ipfs_bootstrap"`
+
+	EnableNAT       bool   `yaml:"enable_nat" json:"enable_nat"`
+	NATProtocol     string `yaml:"nat_protocol" json:"nat_protocol"`
+	NATProtocolOnly bool   `yaml:"nat_protocol_only" json:"nat_protocol_only"`
+	IdentifyPush    bool   `yaml:"identify_push" json:"identify_push"`
+
+	ListenAddrs           []string `yaml:"listen_addrs" json:"listen_addrs"`
+	PortFallback          bool     `yaml:"port_fallback" json:"port_fallback"`
+	UnixSocketPath        string   `yaml:"unix_socket_path" json:"unix_socket_path"`
+	AnnounceIPv6Local     bool     `yaml:"announce_ipv6_local" json:"announce_ipv6_local"`
+	AnnounceAddrs         []string `yaml:"announce_addrs" json:"announce_addrs"`
+	ObservedAddrThreshold int      `yaml:"observed_addr_threshold" json:"observed_addr_threshold"`
+
+	Rendezvous         string         `yaml:"rendezvous" json:"rendezvous"`
+	RendezvousInterval configDuration `yaml:"rendezvous_interval" json:"rendezvous_interval"`
+
+	DialBackoffBase configDuration `yaml:"dial_backoff_base" json:"dial_backoff_base"`
+	DialBackoffCoef configDuration `yaml:"dial_backoff_coef" json:"dial_backoff_coef"`
+	DialBackoffMax  configDuration `yaml:"dial_backoff_max" json:"dial_backoff_max"`
+	BreakerFailures int            `yaml:"breaker_failures" json:"breaker_failures"`
+	BreakerCooldown configDuration `yaml:"breaker_cooldown" json:"breaker_cooldown"`
+	MaxDials        int            `yaml:"max_dials" json:"max_dials"`
+
+	FilterPrivateAddrs  bool           `yaml:"filter_private_addrs" json:"filter_private_addrs"`
+	MaxConnsPerIP       int            `yaml:"max_conns_per_ip" json:"max_conns_per_ip"`
+	MaxStreamsPerPeer   int            `yaml:"max_streams_per_peer" json:"max_streams_per_peer"`
+	MaxHandlers         int            `yaml:"max_handlers" json:"max_handlers"`
+	HandlerQueueTimeout configDuration `yaml:"handler_queue_timeout" json:"handler_queue_timeout"`
+	MaxReconnects       int            `yaml:"max_reconnects" json:"max_reconnects"`
+
+	EventBufferSize int    `yaml:"event_buffer_size" json:"event_buffer_size"`
+	EventDropPolicy string `yaml:"event_drop_policy" json:"event_drop_policy"`
+
+	UserAgent     string         `yaml:"user_agent" json:"user_agent"`
+	Language      string         `yaml:"language" json:"language"`
+	LogFormat     string         `yaml:"log_format" json:"log_format"`
+	LogFile       string         `yaml:"log_file" json:"log_file"`
+	LogMaxSize    int64          `yaml:"log_max_size" json:"log_max_size"`
+	LogMaxAge     configDuration `yaml:"log_max_age" json:"log_max_age"`
+	LogMaxBackups int            `yaml:"log_max_backups" json:"log_max_backups"`
+
+	BootstrapAddrTTL configDuration `yaml:"bootstrap_addr_ttl" json:"bootstrap_addr_ttl"`
+	GossipAddrTTL    configDuration `yaml:"gossip_addr_ttl" json:"gossip_addr_ttl"`
+	LostPeerCycles   int            `yaml:"lost_peer_cycles" json:"lost_peer_cycles"`
+	PeerFile         string         `yaml:"peer_file" json:"peer_file"`
+	PeerTTL          configDuration `yaml:"peer_ttl" json:"peer_ttl"`
+	SeenCacheSize    int            `yaml:"seen_cache_size" json:"seen_cache_size"`
+	SeenCacheTTL     configDuration `yaml:"seen_cache_ttl" json:"seen_cache_ttl"`
+	MaxMemoryBytes   int64          `yaml:"max_memory_bytes" json:"max_memory_bytes"`
+}
+
+// 在配置文件和Config之间复制同名字段, toFile为true时从Config复制到配置文件
+func copyConfigFields(fc *fileConfig, c *Config, toFile bool) {
+	fv := reflect.ValueOf(fc).Elem()
+	cv := reflect.ValueOf(c).Elem()
+	for i := 0; i < fv.NumField(); i++ {
+		from, to := cv.FieldByName(fv.Type().Field(i).Name), fv.Field(i)
+		if !toFile {
+			from, to = to, from
+		}
+		//时间字段类型不同, 按纳秒复制
+		if from.Type() != to.Type() {
+			to.SetInt(from.Int())
+			continue
+		}
+		to.Set(from)
+	}
+}
+
+// 从YAML或JSON文件加载配置, 按扩展名区分(.yaml, .yml或.json), 没有写的字段使用DefaultConfig的值
+// 字段名为Config字段的蛇形命名(例如 bootstrap_addrs), 时间使用"10s"这样的格式. 未知字段和类型错误都会出错, 防止拼写错误被忽略.
+// 环境变量 MP2P_<字段名大写> 覆盖配置文件, 例如 MP2P_PORT=4001 , 列表用逗号分隔.
+// 只检查格式, 配置是否正确由Validate(InitWithConfig也会调用)检查.
+func LoadConfig(path string) (Config, error) {
+	c := DefaultConfig()
+	data, e := ioutil.ReadFile(path)
+	if e != nil {
+		return c, fmt.Errorf("%w: %v", ErrConfigFile, e)
+	}
+
+	var fc fileConfig
+	copyConfigFields(&fc, &c, true)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		e = yaml.UnmarshalStrict(data, &fc)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		e = decoder.Decode(&fc)
+		if e == nil && decoder.More() {
+			e = errors.New("JSON之后还有多余的内容")
+		}
+	default:
+		e = fmt.Errorf("不支持的格式 %s, 应为.yaml, .yml或.json", filepath.Ext(path))
+	}
+	if e != nil {
+		return c, fmt.Errorf("%w %s: %v", ErrConfigFile, path, e)
+	}
+
+	e = applyConfigEnv(&fc, os.LookupEnv)
+	if e != nil {
+		return c, e
+	}
+	copyConfigFields(&fc, &c, false)
+	return c, nil
+}
+
+// 使用环境变量覆盖配置文件, 有问题时返回包含所有问题的ConfigError
+func applyConfigEnv(fc *fileConfig, lookup func(key string) (string, bool)) error {
+	var problems []string
+	v := reflect.ValueOf(fc).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		key := strings.Join([]string{CONFIG_ENV_PREFIX, strings.ToUpper(name)}, "")
+		text, exists := lookup(key)
+		if !exists {
+			continue
+		}
+		e := setConfigField(v.Field(i), strings.TrimSpace(text))
+		if e != nil {
+			problems = append(problems, fmt.Sprintf("环境变量%s错误: %v", key, e))
+		}
+	}
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// 解析环境变量的值并设置字段
+func setConfigField(field reflect.Value, text string) error {
+	if d, ok := field.Addr().Interface().(*configDuration); ok {
+		return d.set(text)
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(text)
+	case reflect.Bool:
+		v, e := strconv.ParseBool(text)
+		if e != nil {
+			return e
+		}
+		field.SetBool(v)
+	case reflect.Int, reflect.Int64:
+		v, e := strconv.ParseInt(text, 10, 64)
+		if e != nil {
+			return e
+		}
+		field.SetInt(v)
+	case reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("不支持的类型 %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package mp2p
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mp2p")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, text string) string {
+		path := filepath.Join(dir, name)
+		if e := ioutil.WriteFile(path, []byte(text), 0644); e != nil {
+			t.Fatal(e)
+		}
+		return path
+	}
+	a := "/ip4/1.2.3.4/udp/60000/quic/ipfs/QmXDunpuNNS93eCEv66UnAzuMBgdENZY7MSE3TuhXNtEjv"
+
+	//没有写的字段使用默认值
+	c, e := LoadConfig(write("node.yaml", strings.Join([]string{
+		"# 节点配置",
+		"port: \"4001\"",
+		"key_dir: /var/lib/mp2p/key",
+		"bootstrap_addrs:",
+		"  - " + a,
+		"enable_nat: false",
+		"max_dials: 16",
+		"breaker_cooldown: 1m30s",
+	}, "\n")))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if c.Port != "4001" || c.KeyDir != "/var/lib/mp2p/key" || !reflect.DeepEqual(c.BootstrapAddrs, []string{a}) {
+		t.Fatal("YAML配置错误:", c)
+	}
+	if c.EnableNAT || c.MaxDials != 16 || c.BreakerCooldown != time.Second*90 || !c.EnableDHT || c.PeerFile != DefaultConfig().PeerFile {
+		t.Fatal("YAML配置错误:", c)
+	}
+
+	c, e = LoadConfig(write("node.json", `{"port": "4002", "listen_addrs": ["/ip4/0.0.0.0/tcp/4002"], "seen_cache_ttl": "5m"}`))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if c.Port != "4002" || len(c.ListenAddrs) != 1 || c.SeenCacheTTL != time.Minute*5 || !c.EnableNAT {
+		t.Fatal("JSON配置错误:", c)
+	}
+
+	//未知字段, 类型错误和格式错误
+	for name, text := range map[string]string{
+		"typo.yaml":     "prot: \"4001\"",
+		"typo.json":     `{"prot": "4001"}`,
+		"type.yaml":     "max_dials: many",
+		"duration.yaml": "peer_ttl: 1day",
+		"duration.json": `{"peer_ttl": 60}`,
+		"extra.json":    `{"port": "4001"} {}`,
+		"node.toml":     `port = "4001"`,
+	} {
+		if _, e = LoadConfig(write(name, text)); !errors.Is(e, ErrConfigFile) {
+			t.Fatal(name, "应该出错:", e)
+		}
+	}
+	if _, e = LoadConfig(filepath.Join(dir, "missing.yaml")); !errors.Is(e, ErrConfigFile) {
+		t.Fatal("文件不存在时应该出错:", e)
+	}
+
+	//环境变量覆盖配置文件
+	_ = os.Setenv("MP2P_PORT", "4003")
+	defer os.Unsetenv("MP2P_PORT")
+	c, e = LoadConfig(filepath.Join(dir, "node.yaml"))
+	if e != nil || c.Port != "4003" || c.KeyDir != "/var/lib/mp2p/key" {
+		t.Fatal("环境变量应覆盖配置文件:", c.Port, e)
+	}
+}
+
+func TestConfigEnv(t *testing.T) {
+	env := map[string]string{
+		"MP2P_ENABLE_NAT":       "false",
+		"MP2P_BOOTSTRAP_ADDRS":  "/ip4/1.2.3.4/tcp/1, /ip4/5.6.7.8/tcp/2,",
+		"MP2P_MAX_MEMORY_BYTES": "1048576",
+		"MP2P_PEER_TTL":         "2h",
+	}
+	lookup := func(key string) (string, bool) {
+		v, exists := env[key]
+		return v, exists
+	}
+	fc := fileConfig{EnableNAT: true}
+	if e := applyConfigEnv(&fc, lookup); e != nil {
+		t.Fatal(e)
+	}
+	if fc.EnableNAT || !reflect.DeepEqual(fc.BootstrapAddrs, []string{"/ip4/1.2.3.4/tcp/1", "/ip4/5.6.7.8/tcp/2"}) || fc.MaxMemoryBytes != 1048576 || time.Duration(fc.PeerTTL) != time.Hour*2 {
+		t.Fatal("环境变量覆盖错误:", fc)
+	}
+
+	//列出所有错误
+	env = map[string]string{"MP2P_ENABLE_NAT": "maybe", "MP2P_MAX_DIALS": "many"}
+	var ce *ConfigError
+	if e := applyConfigEnv(&fc, lookup); !errors.As(e, &ce) || len(ce.Problems) != 2 {
+		t.Fatal("应列出所有环境变量错误:", e)
+	}
+}
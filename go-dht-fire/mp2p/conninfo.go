@@ -0,0 +1,94 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/multiformats/go-multiaddr"
+	"path"
+	"reflect"
+	"strings"
+)
+
+// 连接协商结果
+type ConnInfo struct {
+	Transport string `json:"transport"` //传输, quic, tcp, ws, wss, unix或relay
+	Security  string `json:"security"`  //安全协议, tls, secio或noise, 未知时为空
+	Muxer     string `json:"muxer"`     //多路复用, yamux, mplex或quic, 未知时为空
+}
+
+// 获取连接的传输, 安全协议和多路复用
+// 传输由远程地址判断. 当前libp2p版本没有公开安全协议和多路复用, 从swarm连接内部的类型推断, 推断不出时为空.
+func connInfo(c network.Conn) ConnInfo {
+	info := ConnInfo{Transport: maTransport(c.RemoteMultiaddr())}
+	if info.Transport == "quic" {
+		//QUIC自带TLS和多路复用
+		info.Security = "tls"
+		info.Muxer = "quic"
+		return info
+	}
+
+	//swarm.Conn.conn为升级后的连接, 其中嵌入了安全连接和多路复用连接
+	v := reflect.ValueOf(c)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return info
+	}
+	upgraded := v.FieldByName("conn")
+	if !upgraded.IsValid() || upgraded.Kind() != reflect.Interface || upgraded.IsNil() {
+		return info
+	}
+	upgraded = upgraded.Elem()
+	if upgraded.Kind() == reflect.Ptr {
+		upgraded = upgraded.Elem()
+	}
+	if upgraded.Kind() != reflect.Struct {
+		return info
+	}
+	info.Security = layerName(upgraded.FieldByName("ConnSecurity"))
+	info.Muxer = layerName(upgraded.FieldByName("MuxedConn"))
+	return info
+}
+
+// 地址的传输名称
+func maTransport(ma multiaddr.Multiaddr) string {
+	if ma == nil {
+		return ""
+	}
+	names := []struct {
+		code int
+		name string
+	}{
+		{multiaddr.P_CIRCUIT, "relay"},
+		{multiaddr.P_QUIC, "quic"},
+		{multiaddr.P_WSS, "wss"},
+		{multiaddr.P_WS, "ws"},
+		{multiaddr.P_UNIX, "unix"},
+		{multiaddr.P_TCP, "tcp"},
+		{multiaddr.P_UDP, "udp"},
+	}
+	for _, n := range names {
+		if _, e := ma.ValueForProtocol(n.code); e == nil {
+			return n.name
+		}
+	}
+	return ""
+}
+
+// 根据实现的包名得到协议名称, 例如 github.com/libp2p/go-libp2p-tls 为 tls
+func layerName(v reflect.Value) string {
+	if !v.IsValid() || v.Kind() != reflect.Interface || v.IsNil() {
+		return ""
+	}
+	t := v.Elem().Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	pkg := path.Base(t.PkgPath())
+	for _, name := range []string{"tls", "secio", "noise", "yamux", "mplex"} {
+		if strings.HasSuffix(pkg, name) {
+			return name
+		}
+	}
+	return pkg
+}
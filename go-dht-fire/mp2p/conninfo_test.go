@@ -0,0 +1,35 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"testing"
+)
+
+func TestConnInfo(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer remote.Close()
+
+	e = node.Connect(ctx, peer.AddrInfo{ID: remote.ID(), Addrs: remote.Addrs()})
+	if e != nil {
+		t.Fatal(e)
+	}
+	conns := node.Network().ConnsToPeer(remote.ID())
+	if len(conns) == 0 {
+		t.Fatal("应该已连接")
+	}
+	info := connInfo(conns[0])
+	if info.Transport != "tcp" {
+		t.Fatal("传输应为tcp:", info)
+	}
+	//libp2p默认优先使用secio和yamux
+	if info.Security == "" || info.Muxer == "" {
+		t.Fatal("应能推断出安全协议和多路复用:", info)
+	}
+}
@@ -0,0 +1,65 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"time"
+)
+
+const (
+	DEFAULT_BOOTSTRAP_DEADLINE = time.Second * 10 //引导协议进入流的默认读写期限
+)
+
+// 流的读写期限, 0为不限
+type StreamDeadline struct {
+	Read  time.Duration //读取期限
+	Write time.Duration //写入期限
+}
+
+// 内置协议的默认期限, 可被Config.StreamDeadlines覆盖
+var defaultStreamDeadlines = map[protocol.ID]StreamDeadline{
+	PROTOCOL_BOOTSTRAP_V2: {Read: DEFAULT_BOOTSTRAP_DEADLINE, Write: DEFAULT_BOOTSTRAP_DEADLINE},
+	PROTOCOL_BOOTSTRAP_V1: {Read: DEFAULT_BOOTSTRAP_DEADLINE, Write: DEFAULT_BOOTSTRAP_DEADLINE},
+	PROTOCOL_BOOTSTRAP:    {Read: DEFAULT_BOOTSTRAP_DEADLINE, Write: DEFAULT_BOOTSTRAP_DEADLINE},
+	PROTOCOL_ECHO:         {Read: DEFAULT_REQUEST_TIMEOUT, Write: DEFAULT_REQUEST_TIMEOUT},
+}
+
+// 获取协议的读写期限, 没有配置时返回false
+func streamDeadline(proto protocol.ID) (StreamDeadline, bool) {
+	if d, exists := config.StreamDeadlines[proto]; exists {
+		return d, true
+	}
+	d, exists := defaultStreamDeadlines[proto]
+	return d, exists
+}
+
+// 按协商的协议设置流的读写期限
+func applyStreamDeadline(s network.Stream) {
+	d, exists := streamDeadline(s.Protocol())
+	if !exists {
+		return
+	}
+	now := time.Now()
+	if d.Read > 0 {
+		_ = s.SetReadDeadline(now.Add(d.Read))
+	}
+	if d.Write > 0 {
+		_ = s.SetWriteDeadline(now.Add(d.Write))
+	}
+}
+
+// 请求的读写期限
+// timeout大于0时(RequestOptions.Timeout)读写都使用它, 否则使用协议配置的期限, 未配置或为0的使用DEFAULT_REQUEST_TIMEOUT.
+func requestDeadline(proto protocol.ID, timeout time.Duration) StreamDeadline {
+	if timeout > 0 {
+		return StreamDeadline{Read: timeout, Write: timeout}
+	}
+	d, _ := streamDeadline(proto)
+	if d.Read <= 0 {
+		d.Read = DEFAULT_REQUEST_TIMEOUT
+	}
+	if d.Write <= 0 {
+		d.Write = DEFAULT_REQUEST_TIMEOUT
+	}
+	return d
+}
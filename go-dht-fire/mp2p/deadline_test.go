@@ -0,0 +1,94 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStreamDeadline(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	config = Config{StreamDeadlines: map[protocol.ID]StreamDeadline{
+		"/mp2p/test/fast": {Read: time.Millisecond * 200},
+	}}
+	defer func() {
+		config = Config{}
+	}()
+
+	//对方只发送1字节(流协商是延迟的, 写入后才会调用处理), 有期限的协议读取超时, 没有期限的协议一直等待
+	//处理开始前流限制会读取配置, 结束前等待两个处理都已开始, 之后才能恢复配置
+	results := make(chan error, 2)
+	started := make(chan struct{}, 2)
+	handler := func(s network.Stream) {
+		started <- struct{}{}
+		_, e := io.ReadFull(s, make([]byte, 2))
+		results <- e
+		_ = s.Reset()
+	}
+	protocols.Register("/mp2p/test/fast", handler)
+	protocols.Register("/mp2p/test/slow", handler)
+
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer remote.Close()
+	remote.Peerstore().AddAddrs(node.ID(), node.Addrs(), peerstore.TempAddrTTL)
+
+	for _, proto := range []protocol.ID{"/mp2p/test/fast", "/mp2p/test/slow"} {
+		s, e := remote.NewStream(ctx, node.ID(), proto)
+		if e != nil {
+			t.Fatal(e)
+		}
+		defer s.Close()
+		_, e = s.Write([]byte{1})
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	select {
+	case e := <-results:
+		if netErr, ok := e.(net.Error); !ok || !netErr.Timeout() {
+			t.Fatal("应读取超时:", e)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("设置了期限的流应超时")
+	}
+	select {
+	case e := <-results:
+		t.Fatal("没有期限的流不应超时:", e)
+	case <-time.After(time.Millisecond * 500):
+	}
+	for i := 0; i < 2; i++ {
+		<-started
+	}
+}
+
+func TestRequestDeadline(t *testing.T) {
+	config = Config{StreamDeadlines: map[protocol.ID]StreamDeadline{
+		"/mp2p/test/file": {Read: time.Minute},
+	}}
+	defer func() {
+		config = Config{}
+	}()
+
+	if d := requestDeadline("/mp2p/test/file", time.Second); d.Read != time.Second || d.Write != time.Second {
+		t.Fatal("请求选项的超时优先:", d)
+	}
+	if d := requestDeadline("/mp2p/test/file", 0); d.Read != time.Minute || d.Write != DEFAULT_REQUEST_TIMEOUT {
+		t.Fatal("应使用协议配置的期限:", d)
+	}
+	if d := requestDeadline("/mp2p/test/other", 0); d.Read != DEFAULT_REQUEST_TIMEOUT || d.Write != DEFAULT_REQUEST_TIMEOUT {
+		t.Fatal("没有配置时应使用默认超时:", d)
+	}
+	if d, _ := streamDeadline(PROTOCOL_BOOTSTRAP_V2); d.Read != DEFAULT_BOOTSTRAP_DEADLINE {
+		t.Fatal("引导协议应有默认期限:", d)
+	}
+}
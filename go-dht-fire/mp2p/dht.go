@@ -0,0 +1,161 @@
+package mp2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p-kad-dht/dual"
+	"sync"
+)
+
+var ErrDHTStopped = errors.New("DHT已停止")
+
+// DHT生命周期
+// DHT和它的后台协程(刷新路由表, 汇合点)使用单独的上下文和WaitGroup, 可以独立于节点启动和停止.
+var dhtLock sync.RWMutex
+var dhtCtx context.Context
+var dhtCancel context.CancelFunc
+var dhtGroup sync.WaitGroup
+
+// 节点的路由, 转发给当前的DHT
+// 路由节点在创建时绑定路由, DHT重新启动后仍经过这里使用新的DHT.
+// 同时实现节点路由和内容路由, AutoRelay需要内容路由.
+type dhtRouting struct{}
+
+func (dhtRouting) FindPeer(ctx context.Context, id peer.ID) (peer.AddrInfo, error) {
+	wan, lan := currentDHT()
+	if lan != nil {
+		return lan.FindPeer(ctx, id)
+	}
+	if wan == nil {
+		return peer.AddrInfo{}, dhtError()
+	}
+	return wan.FindPeer(ctx, id)
+}
+
+// 内容路由, AutoRelay通过它发现中继节点. DHT停止时返回错误
+func (dhtRouting) Provide(ctx context.Context, key cid.Cid, announce bool) error {
+	wan, lan := currentDHT()
+	if lan != nil {
+		return lan.Provide(ctx, key, announce)
+	}
+	if wan == nil {
+		return dhtError()
+	}
+	return wan.Provide(ctx, key, announce)
+}
+
+// 查找内容的提供者, DHT停止时返回关闭的通道
+func (dhtRouting) FindProvidersAsync(ctx context.Context, key cid.Cid, count int) <-chan peer.AddrInfo {
+	wan, lan := currentDHT()
+	if lan != nil {
+		return lan.FindProvidersAsync(ctx, key, count)
+	}
+	if wan == nil {
+		ch := make(chan peer.AddrInfo)
+		close(ch)
+		return ch
+	}
+	return wan.FindProvidersAsync(ctx, key, count)
+}
+
+// 当前的DHT, 停止时都为nil
+// 双DHT模式时wan为互联网DHT, 另外返回双DHT.
+func currentDHT() (*dht.IpfsDHT, *dual.DHT) {
+	dhtLock.RLock()
+	defer dhtLock.RUnlock()
+	return mDHT, dualDHT
+}
+
+// DHT不可用的原因
+func dhtError() error {
+	if !config.EnableDHT {
+		return ErrDHTDisabled
+	}
+	return ErrDHTStopped
+}
+
+// 创建DHT, 不启动后台协程. 已创建时返回false
+func createDHT() (bool, error) {
+	if !config.EnableDHT {
+		return false, ErrDHTDisabled
+	}
+	dhtLock.Lock()
+	defer dhtLock.Unlock()
+	if mDHT != nil {
+		return false, nil
+	}
+	dhtCtx, dhtCancel = context.WithCancel(ctx)
+	e := newDHT(dhtCtx, basicHost)
+	if e != nil {
+		dhtCancel()
+		return false, e
+	}
+	return true, nil
+}
+
+// 在DHT协程组中运行
+func goDHT(f func(ctx context.Context)) {
+	dhtLock.RLock()
+	c := dhtCtx
+	dhtLock.RUnlock()
+	dhtGroup.Add(1)
+	go func() {
+		defer dhtGroup.Done()
+		f(c)
+	}()
+}
+
+// 启动DHT的后台协程: 定时刷新路由表, 设置了汇合点时通过汇合点发现节点
+func startDHTLoops() {
+	goDHT(refreshLoop)
+	if config.Rendezvous != "" {
+		goDHT(func(ctx context.Context) {
+			rendezvous(ctx, config.Rendezvous, config.RendezvousInterval)
+		})
+	}
+}
+
+// 启动DHT和后台协程, 已启动时直接返回nil
+// 启用DHT时节点启动时已自动启动, 用于StopDHT之后重新启动. 重新启动的DHT从已连接的节点填充路由表.
+// 没有启用DHT(Config.EnableDHT)时返回ErrDHTDisabled.
+func StartDHT() error {
+	created, e := createDHT()
+	if e != nil || !created {
+		return e
+	}
+	startDHTLoops()
+	logMsg("dht.started")
+	return nil
+}
+
+// 停止DHT, 等待后台协程退出后关闭DHT, 节点和连接不受影响
+// 停止期间DHT相关功能(RoutingTable, ClosestPeers等)返回nil或ErrDHTStopped. 没有启动时直接返回nil.
+func StopDHT() error {
+	dhtLock.Lock()
+	if mDHT == nil {
+		dhtLock.Unlock()
+		return nil
+	}
+	dhtCancel()
+	wan, lan := mDHT, dualDHT
+	mDHT, dualDHT = nil, nil
+	dhtLock.Unlock()
+
+	dhtGroup.Wait()
+
+	var err error
+	if lan != nil {
+		err = lan.Close()
+	} else {
+		err = wan.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("关闭DHT出错: %w", err)
+	}
+	logMsg("dht.stopped")
+	return nil
+}
@@ -0,0 +1,60 @@
+package mp2p
+
+import (
+	"context"
+	"errors"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"testing"
+)
+
+func TestStartStopDHT(t *testing.T) {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	config = Config{EnableDHT: true}
+	defer func() {
+		config = Config{}
+	}()
+
+	mn := mocknet.New(ctx)
+	prKey, e := generateKey(crypto.Ed25519)
+	if e != nil {
+		t.Fatal(e)
+	}
+	node, e = newMockHost(mn, prKey, "/ip4/127.0.0.1/tcp/4001")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node.Close()
+
+	for i := 0; i < 2; i++ {
+		if e = StartDHT(); e != nil {
+			t.Fatal(e)
+		}
+		if e = StartDHT(); e != nil {
+			t.Fatal("重复启动应直接返回:", e)
+		}
+		if RoutingTable() == nil {
+			t.Fatal("启动后应有路由表")
+		}
+
+		if e = StopDHT(); e != nil {
+			t.Fatal(e)
+		}
+		if RoutingTable() != nil {
+			t.Fatal("停止后不应有路由表")
+		}
+		if _, e = ClosestPeers(context.Background(), "key", 1); !errors.Is(e, ErrDHTStopped) {
+			t.Fatal("停止后应返回ErrDHTStopped:", e)
+		}
+	}
+	if e = StopDHT(); e != nil {
+		t.Fatal("没有启动时停止应直接返回:", e)
+	}
+
+	config.EnableDHT = false
+	if e = StartDHT(); !errors.Is(e, ErrDHTDisabled) {
+		t.Fatal("没有启用DHT时应返回ErrDHTDisabled:", e)
+	}
+}
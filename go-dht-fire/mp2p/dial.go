@@ -0,0 +1,128 @@
+package mp2p
+
+import (
+	"context"
+	"errors"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	swarm "github.com/libp2p/go-libp2p-swarm"
+	"time"
+)
+
+const (
+	DEFAULT_BOOTSTRAP_ADDR_TTL = time.Hour * 24   //启发节点地址在节点存储中的保留时间
+	DEFAULT_GOSSIP_ADDR_TTL    = time.Minute * 10 //交换得到的节点地址在节点存储中的保留时间
+	DEFAULT_MAX_DIALS          = 32               //同时拨号的最大数量
+)
+
+var ErrDialSelf = errors.New("不能连接自己")
+
+// 拨号信号量, 限制同时拨号的数量(引导, 交换得到的节点, 重连等), 为nil时不限
+// 大量同时拨号会占满家用路由器的NAT表, 超出的拨号排队等待.
+var dialSem = make(chan struct{}, DEFAULT_MAX_DIALS)
+
+// 设置同时拨号的最大数量, 只应在节点启动前调用
+// 为0时使用默认值, 小于0时不限.
+func setMaxDials(max int) {
+	if max == 0 {
+		max = DEFAULT_MAX_DIALS
+	}
+	if max < 0 {
+		dialSem = nil
+		return
+	}
+	dialSem = make(chan struct{}, max)
+}
+
+// 拨号, 超过同时拨号的最大数量时排队, 排队时上下文结束返回上下文错误
+// 已连接的节点不拨号, 无需排队.
+func dialNode(dialCtx context.Context, ai peer.AddrInfo) error {
+	sem := dialSem
+	if sem != nil && node.Network().Connectedness(ai.ID) != network.Connected {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+		case <-dialCtx.Done():
+			return dialCtx.Err()
+		}
+		//排队期间上下文可能已经结束
+		if e := dialCtx.Err(); e != nil {
+			return e
+		}
+	}
+	return node.Connect(dialCtx, ai)
+}
+
+// 启发节点地址保留时间
+func bootstrapAddrTTL() time.Duration {
+	if config.BootstrapAddrTTL > 0 {
+		return config.BootstrapAddrTTL
+	}
+	return DEFAULT_BOOTSTRAP_ADDR_TTL
+}
+
+// 交换得到的节点地址保留时间
+func gossipAddrTTL() time.Duration {
+	if config.GossipAddrTTL > 0 {
+		return config.GossipAddrTTL
+	}
+	return DEFAULT_GOSSIP_ADDR_TTL
+}
+
+// 将节点地址加入节点存储, 并记录为已知节点
+// 连接成功时libp2p会延长已连接地址的保留时间, 这里的ttl决定断开或者未连接时地址保留多久.
+func addAddrs(ai peer.AddrInfo, ttl time.Duration) {
+	if ai.ID == node.ID() || len(ai.Addrs) == 0 {
+		return
+	}
+	learnPeer(ai.ID)
+	node.Peerstore().AddAddrs(ai.ID, ai.Addrs, ttl)
+}
+
+// 是否因节点所有地址都在退避期(mp2p或libp2p的拨号退避, 熔断)而未拨号
+func isDialBackoff(e error) bool {
+	return errors.Is(e, ErrDialBackoff) || errors.Is(e, swarm.ErrDialBackoff) || errors.Is(e, ErrCircuitOpen)
+}
+
+// 清除节点在swarm中的拨号退避, 是否拨号由mp2p的退避决定
+func clearSwarmBackoff(id peer.ID) {
+	if s, ok := node.Network().(*swarm.Swarm); ok {
+		s.Backoff().Clear(id)
+	}
+}
+
+// 连接节点, 并记录连接结果用于节点评分
+// 节点在退避期时不会拨号, 返回ErrDialBackoff; 连续失败熔断时返回ErrCircuitOpen. 调用方可用isDialBackoff判断后跳过.
+// 连接自己时返回ErrDialSelf.
+func connect(ai peer.AddrInfo) error {
+	return connectContext(ctx, ai)
+}
+
+// 使用指定上下文连接节点, 同connect
+func connectContext(dialCtx context.Context, ai peer.AddrInfo) error {
+	if ai.ID == node.ID() {
+		return ErrDialSelf
+	}
+	e := allowDial(ai)
+	if e != nil {
+		return e
+	}
+	clearSwarmBackoff(ai.ID)
+
+	start := clock.Now()
+	markDialStart(ai.ID)
+	e = dialNode(dialCtx, ai)
+	if e != nil {
+		markDialEnd(ai.ID, false)
+	}
+	if isDialBackoff(e) {
+		cancelProbe(ai.ID)
+	} else {
+		recordDialResult(ai, e == nil)
+		recordConnect(ai.ID, e == nil, clock.Now().Sub(start))
+		if e != nil {
+			markDialFailed(ai.ID, e)
+		}
+	}
+	return e
+}
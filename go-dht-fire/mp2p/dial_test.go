@@ -0,0 +1,171 @@
+package mp2p
+
+import (
+	"context"
+	"errors"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 生成随机节点ID
+func randomPeerID(t testing.TB) peer.ID {
+	_, puKey, e := crypto.GenerateEd25519Key(nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	id, e := peer.IDFromPublicKey(puKey)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return id
+}
+
+// 创建测试节点(只监听本机TCP), 设置为当前节点, 返回关闭函数
+func newTestNode(t testing.TB) func() {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(context.Background())
+
+	var e error
+	node, e = libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		cancel()
+		t.Fatal(e)
+	}
+	protocols = NewProtocols()
+	protocols.Install(node)
+	return func() {
+		_ = node.Close()
+		cancel()
+	}
+}
+
+func TestConnectUnreachablePeerBackoff(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+
+	var e error
+
+	setDialBackoff(time.Minute, 0, 0)
+	defer setDialBackoff(0, 0, 0)
+	defer setDialBreaker(0, 0)
+
+	//永远无法连接的节点
+	ma, _ := multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/1")
+	ai := peer.AddrInfo{ID: randomPeerID(t), Addrs: []multiaddr.Multiaddr{ma}}
+
+	e = connect(ai)
+	if e == nil || isDialBackoff(e) {
+		t.Fatal("首次连接应该拨号失败:", e)
+	}
+
+	e = connect(ai)
+	if !errors.Is(e, ErrDialBackoff) {
+		t.Fatal("再次连接应该处于退避期:", e)
+	}
+}
+
+func TestConnectSelf(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+
+	var e error
+
+	e = connect(peer.AddrInfo{ID: node.ID(), Addrs: node.Addrs()})
+	if e != ErrDialSelf {
+		t.Fatal("期望ErrDialSelf:", e)
+	}
+
+	//自己的地址被反馈回来时忽略
+	selfAddrs, e := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: node.ID(), Addrs: node.Addrs()})
+	if e != nil {
+		t.Fatal(e)
+	}
+	connectPeers([]string{selfAddrs[0].String()})
+	sm.RLock()
+	_, exists := peerMap[node.ID().String()]
+	sm.RUnlock()
+	if exists {
+		t.Fatal("不应缓存自己")
+	}
+}
+
+func TestMaxDials(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	setMaxDials(2)
+	defer setMaxDials(0)
+	defer setDialBreaker(0, 0)
+
+	//接受连接但不握手, 拨号一直等待
+	listener, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer listener.Close()
+	accepted := make(chan net.Conn, 10)
+	go func() {
+		for {
+			c, e := listener.Accept()
+			if e != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+	ma, _ := manet.FromNetAddr(listener.Addr())
+
+	dialCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- connectContext(dialCtx, peer.AddrInfo{ID: randomPeerID(t), Addrs: []multiaddr.Multiaddr{ma}})
+		}()
+	}
+
+	//同时只有两个拨号, 其余排队
+	var conns []net.Conn
+	for len(conns) < 2 {
+		conns = append(conns, <-accepted)
+	}
+	select {
+	case <-accepted:
+		t.Fatal("同时拨号不应超过最大数量")
+	case <-time.After(time.Millisecond * 300):
+	}
+	if n := len(dialSem); n != 2 {
+		t.Fatal("应有两个拨号:", n)
+	}
+
+	//上下文结束时排队的拨号返回上下文错误
+	cancel()
+	wg.Wait()
+	close(errs)
+	canceled := 0
+	for e := range errs {
+		if e == nil {
+			t.Fatal("拨号不应成功")
+		}
+		if errors.Is(e, context.Canceled) {
+			canceled++
+		}
+	}
+	if canceled < 3 {
+		t.Fatal("排队的拨号应返回上下文错误:", canceled)
+	}
+	if n := len(dialSem); n != 0 {
+		t.Fatal("拨号结束后应释放:", n)
+	}
+	for _, c := range conns {
+		c.Close()
+	}
+}
@@ -0,0 +1,50 @@
+package mp2p
+
+import (
+	"sync"
+)
+
+// 发现暂停状态
+// 暂停时刷新路由表不再拨号新节点, 汇合点不再宣告和查找. 已有连接, 协议处理和受保护节点的重连不受影响.
+var discoveryLock sync.Mutex
+var discoveryPaused bool
+var discoveryResumed = make(chan struct{})
+
+// 暂停发现新节点, 用于维护或实验期间保持网络拓扑不变
+// 收到的引导请求和对方主动建立的连接仍然接受. 已暂停时忽略.
+func PauseDiscovery() {
+	discoveryLock.Lock()
+	defer discoveryLock.Unlock()
+	if discoveryPaused {
+		return
+	}
+	discoveryPaused = true
+	logMsg("discovery.paused")
+}
+
+// 恢复发现新节点, 立即唤醒刷新和汇合点协程. 没有暂停时忽略
+func ResumeDiscovery() {
+	discoveryLock.Lock()
+	defer discoveryLock.Unlock()
+	if !discoveryPaused {
+		return
+	}
+	discoveryPaused = false
+	close(discoveryResumed)
+	discoveryResumed = make(chan struct{})
+	logMsg("discovery.resumed")
+}
+
+// 是否暂停了发现
+func DiscoveryPaused() bool {
+	discoveryLock.Lock()
+	defer discoveryLock.Unlock()
+	return discoveryPaused
+}
+
+// 恢复发现时关闭的信道, 用于协程等待时提前唤醒
+func discoveryResumedChan() <-chan struct{} {
+	discoveryLock.Lock()
+	defer discoveryLock.Unlock()
+	return discoveryResumed
+}
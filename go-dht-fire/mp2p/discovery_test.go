@@ -0,0 +1,38 @@
+package mp2p
+
+import (
+	"testing"
+)
+
+func TestPauseDiscovery(t *testing.T) {
+	defer ResumeDiscovery()
+
+	resumed := discoveryResumedChan()
+	PauseDiscovery()
+	PauseDiscovery()
+	if !DiscoveryPaused() {
+		t.Fatal("应已暂停")
+	}
+	select {
+	case <-resumed:
+		t.Fatal("暂停时不应唤醒")
+	default:
+	}
+
+	ResumeDiscovery()
+	if DiscoveryPaused() {
+		t.Fatal("应已恢复")
+	}
+	select {
+	case <-resumed:
+	default:
+		t.Fatal("恢复时应唤醒等待的协程")
+	}
+	//重复恢复不应关闭新的信道
+	ResumeDiscovery()
+	select {
+	case <-discoveryResumedChan():
+		t.Fatal("没有暂停时不应唤醒")
+	default:
+	}
+}
@@ -0,0 +1,56 @@
+package mp2p
+
+import (
+	"context"
+	"sync"
+)
+
+// 排空状态
+// 排空后不再接受新的流, 正在执行的处理继续直到完成.
+var drainLock sync.RWMutex
+var draining bool
+var inflight = &sync.WaitGroup{}
+
+// 重置排空状态, 节点启动时调用
+func resetDrain() {
+	drainLock.Lock()
+	draining = false
+	inflight = &sync.WaitGroup{}
+	drainLock.Unlock()
+}
+
+// 开始一个处理, 排空中返回nil. 处理结束后调用返回的WaitGroup的Done
+func beginHandler() *sync.WaitGroup {
+	drainLock.RLock()
+	defer drainLock.RUnlock()
+	if draining {
+		return nil
+	}
+	inflight.Add(1)
+	return inflight
+}
+
+// 排空节点, 用于无损重启
+// 移除mp2p的协议处理(新的流会收到协议不支持的错误), 等待正在执行的处理完成后返回nil, 之后调用Stop关闭节点.
+// ctx结束时返回ctx.Err(), 此时仍有处理在执行. 排空后不能恢复, 需要重新启动节点.
+func Drain(ctx context.Context) error {
+	drainLock.Lock()
+	draining = true
+	wg := inflight
+	drainLock.Unlock()
+
+	logMsg("drain.started", protocols.Uninstall())
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		logMsg("drain.done")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
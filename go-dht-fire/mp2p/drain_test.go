@@ -0,0 +1,67 @@
+package mp2p
+
+import (
+	"context"
+	"errors"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	resetDrain()
+	defer resetDrain()
+
+	//处理阻塞直到放行
+	started := make(chan struct{})
+	release := make(chan struct{})
+	SetChannelHandler("drain", func(s network.Stream) {
+		close(started)
+		<-release
+		_, _ = s.Write([]byte("ok\n"))
+		_ = s.Close()
+	})
+
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer remote.Close()
+	remote.Peerstore().AddAddrs(node.ID(), node.Addrs(), peerstore.TempAddrTTL)
+
+	s, e := remote.NewStream(ctx, node.ID(), ChannelProtocol("drain"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, _ = s.Write([]byte("a"))
+	<-started
+
+	//处理没有完成时超时
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	e = Drain(drainCtx)
+	drainCancel()
+	if !errors.Is(e, context.DeadlineExceeded) {
+		t.Fatal("处理未完成时应超时:", e)
+	}
+
+	//新的流不再被接受
+	if _, e = remote.NewStream(ctx, node.ID(), ChannelProtocol("drain")); e == nil {
+		t.Fatal("排空后新的流应出错")
+	}
+
+	//正在执行的处理完成
+	close(release)
+	text, e := readTextFormStream(s)
+	if e != nil || text != "ok" {
+		t.Fatal("正在执行的处理应完成:", text, e)
+	}
+	drainCtx, drainCancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer drainCancel()
+	if e = Drain(drainCtx); e != nil {
+		t.Fatal("处理完成后排空应成功:", e)
+	}
+}
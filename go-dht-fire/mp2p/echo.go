@@ -0,0 +1,69 @@
+package mp2p
+
+import (
+	"context"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+const (
+	PROTOCOL_ECHO = "/mp2p/echo/1.0.0" //回显协议, 原样返回收到的数据, 用于诊断数据收发
+)
+
+// 处理回显流, 原样写回收到的数据直到对方关闭写入, 最多MAX_MESSAGE_SIZE字节
+func handleEchoStream(s network.Stream) {
+	n, e := io.Copy(s, io.LimitReader(s, MAX_MESSAGE_SIZE))
+	if e != nil {
+		logMsg("echo.failed", s.Conn().RemotePeer().String(), e)
+		_ = s.Reset()
+		return
+	}
+	logMsg("echo.done", s.Conn().RemotePeer().String(), n)
+	_ = s.Close()
+}
+
+// 回显, 向节点发送数据并返回对方写回的数据
+// 用于确认两个节点之间的双向数据传输, 而不只是连接建立. 数据最多MAX_MESSAGE_SIZE字节.
+// 读写期限同Request(Config.StreamDeadlines中PROTOCOL_ECHO的设置, 默认10秒). 返回的数据与发送的不同时返回错误.
+func Echo(ctx context.Context, id peer.ID, payload []byte) ([]byte, error) {
+	if len(payload) > MAX_MESSAGE_SIZE {
+		return nil, fmt.Errorf("回显数据超过%d字节: %d", MAX_MESSAGE_SIZE, len(payload))
+	}
+	deadline := requestDeadline(PROTOCOL_ECHO, 0)
+	streamCtx, streamCancel := context.WithTimeout(ctx, deadline.Write)
+	defer streamCancel()
+
+	s, e := node.NewStream(streamCtx, id, PROTOCOL_ECHO)
+	if e != nil {
+		return nil, e
+	}
+	//边写边读, 数据较多时对方写回会在读取前填满流的缓冲
+	written := make(chan error, 1)
+	go func() {
+		_ = s.SetWriteDeadline(time.Now().Add(deadline.Write))
+		_, e := s.Write(payload)
+		if e == nil {
+			//关闭写入, 对方读到结尾后写回并关闭
+			e = s.Close()
+		}
+		written <- e
+	}()
+
+	_ = s.SetReadDeadline(time.Now().Add(deadline.Read))
+	data, e := ioutil.ReadAll(io.LimitReader(s, MAX_MESSAGE_SIZE))
+	if e == nil {
+		e = <-written
+	}
+	if e != nil {
+		_ = s.Reset()
+		return nil, e
+	}
+	if string(data) != string(payload) {
+		return data, fmt.Errorf("回显数据不一致: 发送%d字节, 收到%d字节", len(payload), len(data))
+	}
+	return data, nil
+}
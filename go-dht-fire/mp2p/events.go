@@ -0,0 +1,136 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/multiformats/go-multiaddr"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	EVENT_BUFFER_SIZE = 256 //默认事件信道缓冲数量
+
+	EVENT_DROP_NEWEST = "newest" //缓冲满时丢弃新事件(默认), 已缓冲的事件保持顺序
+	EVENT_DROP_OLDEST = "oldest" //缓冲满时丢弃最旧的事件, 保留最近的状态
+)
+
+// 事件类型
+type EventType int
+
+const (
+	EVENT_PEER_CONNECTED      EventType = iota + 1 //节点已连接
+	EVENT_PEER_DISCONNECTED                        //节点已断开
+	EVENT_BOOTSTRAP_COMPLETED                      //引导完成
+	EVENT_STREAM_OPENED                            //流已打开
+	EVENT_NAT_MAPPED                               //NAT端口已映射
+	EVENT_NAT_CHANGED                              //NAT外部端口或公网IP变化
+	EVENT_PEER_UNREACHABLE                         //从未连接成功的已知节点所有地址拨号失败
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EVENT_PEER_CONNECTED:
+		return "peer-connected"
+	case EVENT_PEER_DISCONNECTED:
+		return "peer-disconnected"
+	case EVENT_BOOTSTRAP_COMPLETED:
+		return "bootstrap-completed"
+	case EVENT_STREAM_OPENED:
+		return "stream-opened"
+	case EVENT_NAT_MAPPED:
+		return "nat-mapped"
+	case EVENT_NAT_CHANGED:
+		return "nat-changed"
+	case EVENT_PEER_UNREACHABLE:
+		return "peer-unreachable"
+	}
+	return "unknown"
+}
+
+// 网络事件
+// 根据Type使用对应字段, 其余字段为零值.
+type Event struct {
+	Type     EventType
+	Time     time.Time
+	Peer     peer.ID             //节点事件, 流事件, 引导完成(启发节点), 无法连接
+	Addr     multiaddr.Multiaddr //节点事件(远程地址), NAT事件(NAT地址)
+	Protocol protocol.ID         //流事件
+	Err      error               //引导完成(引导失败时不为nil), 无法连接(拨号错误)
+}
+
+var eventChan = make(chan Event, EVENT_BUFFER_SIZE)
+var eventDropOldest bool
+var droppedEvents uint64
+
+// 设置事件缓冲数量和丢弃策略, 只应在节点启动前调用
+// 缓冲数量不变时保留原信道, 启动前已获取的信道仍然有效.
+func setEventBuffer(size int, policy string) {
+	if size <= 0 {
+		size = EVENT_BUFFER_SIZE
+	}
+	if size != cap(eventChan) {
+		eventChan = make(chan Event, size)
+	}
+	eventDropOldest = policy == EVENT_DROP_OLDEST
+}
+
+// 获取事件信道
+// 信道缓冲Config.EventBufferSize个事件(默认EVENT_BUFFER_SIZE). 发出事件从不阻塞, 读取慢的订阅者不会拖慢网络:
+// 缓冲满时按Config.EventDropPolicy丢弃新事件(EVENT_DROP_NEWEST, 默认)或最旧的事件(EVENT_DROP_OLDEST)并计数,
+// 丢弃数量见DroppedEvents和Status.DroppedEvents. 需要完整事件时应及时读取, 或根据丢弃数量重新查询状态.
+// 修改了缓冲数量时需在节点启动后获取.
+func Events() <-chan Event {
+	return eventChan
+}
+
+// 获取因缓冲满而丢弃的事件数量
+func DroppedEvents() uint64 {
+	return atomic.LoadUint64(&droppedEvents)
+}
+
+// 发出事件
+func emit(ev Event) {
+	ev.Time = clock.Now()
+	for {
+		select {
+		case eventChan <- ev:
+			return
+		default:
+		}
+		if !eventDropOldest {
+			atomic.AddUint64(&droppedEvents, 1)
+			return
+		}
+		//丢弃最旧的事件后重试, 订阅者同时读取时可能不需要丢弃
+		select {
+		case <-eventChan:
+			atomic.AddUint64(&droppedEvents, 1)
+		default:
+		}
+	}
+}
+
+// 网络通知, 发出节点和流事件
+func eventNotifiee() network.Notifiee {
+	return &network.NotifyBundle{
+		ConnectedF: func(n network.Network, c network.Conn) {
+			markConnected(c.RemotePeer())
+			closeBreaker(c.RemotePeer())
+			if c.Stat().Direction == network.DirOutbound {
+				markDialEnd(c.RemotePeer(), true)
+			}
+			info := connInfo(c)
+			logMsg("conn.opened", c.RemotePeer().String(), c.Stat().Direction, info.Transport, info.Security, info.Muxer)
+			emit(Event{Type: EVENT_PEER_CONNECTED, Peer: c.RemotePeer(), Addr: c.RemoteMultiaddr()})
+		},
+		DisconnectedF: func(n network.Network, c network.Conn) {
+			emit(Event{Type: EVENT_PEER_DISCONNECTED, Peer: c.RemotePeer(), Addr: c.RemoteMultiaddr()})
+			startReconnect(c.RemotePeer())
+		},
+		OpenedStreamF: func(n network.Network, s network.Stream) {
+			emit(Event{Type: EVENT_STREAM_OPENED, Peer: s.Conn().RemotePeer(), Protocol: s.Protocol()})
+		},
+	}
+}
@@ -0,0 +1,33 @@
+package mp2p
+
+import (
+	"testing"
+)
+
+func TestEventDropPolicy(t *testing.T) {
+	oldChan, oldDropped := eventChan, droppedEvents
+	defer func() {
+		eventChan, droppedEvents, eventDropOldest = oldChan, oldDropped, false
+	}()
+
+	for _, policy := range []string{EVENT_DROP_NEWEST, EVENT_DROP_OLDEST} {
+		eventChan = nil
+		droppedEvents = 0
+		setEventBuffer(2, policy)
+		for i := 1; i <= 3; i++ {
+			emit(Event{Type: EventType(i)})
+		}
+		if DroppedEvents() != 1 || len(eventChan) != 2 {
+			t.Fatal(policy, "丢弃数量错误:", DroppedEvents(), len(eventChan))
+		}
+
+		first, second := (<-eventChan).Type, (<-eventChan).Type
+		want := [2]EventType{1, 2}
+		if policy == EVENT_DROP_OLDEST {
+			want = [2]EventType{2, 3}
+		}
+		if [2]EventType{first, second} != want {
+			t.Fatal(policy, "保留的事件错误:", first, second)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/control"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// 连接过滤
+type connGater struct {
+	filterPrivate bool                  //禁止拨号私有网段地址
+	maxConnsPerIP int                   //每个IP的最大进入连接数量, 0为不限
+	conns         func() []network.Conn //获取现有连接
+}
+
+func newConnGater(c Config) *connGater {
+	return &connGater{
+		filterPrivate: c.FilterPrivateAddrs,
+		maxConnsPerIP: c.MaxConnsPerIP,
+		conns: func() []network.Conn {
+			if node == nil {
+				return nil
+			}
+			return node.Network().Conns()
+		},
+	}
+}
+
+func (g *connGater) InterceptPeerDial(p peer.ID) bool {
+	return true
+}
+
+// 开启FilterPrivateAddrs时禁止拨号私有网段(10.0.0.0/8, 172.16.0.0/12, 192.168.0.0/16, 100.64.0.0/10, fc00::/7)
+func (g *connGater) InterceptAddrDial(id peer.ID, ma multiaddr.Multiaddr) bool {
+	if g.filterPrivate {
+		ip := maIP(ma)
+		if ip != nil && isPrivateIP(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// 设置了MaxConnsPerIP时, 同一IP的进入连接达到上限后拒绝新连接
+func (g *connGater) InterceptAccept(addrs network.ConnMultiaddrs) bool {
+	if g.maxConnsPerIP <= 0 {
+		return true
+	}
+	ip := maIP(addrs.RemoteMultiaddr())
+	if ip == nil {
+		return true
+	}
+
+	count := 0
+	for _, conn := range g.conns() {
+		if conn.Stat().Direction != network.DirInbound {
+			continue
+		}
+		connIP := maIP(conn.RemoteMultiaddr())
+		if connIP != nil && connIP.Equal(ip) {
+			count++
+		}
+	}
+	if count >= g.maxConnsPerIP {
+		logMsg("gater.ip_limit", ip.String(), count)
+		return false
+	}
+	return true
+}
+
+func (g *connGater) InterceptSecured(dir network.Direction, id peer.ID, addrs network.ConnMultiaddrs) bool {
+	return true
+}
+
+func (g *connGater) InterceptUpgraded(conn network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
@@ -0,0 +1,81 @@
+package mp2p
+
+import (
+	"context"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"testing"
+)
+
+func TestConnGaterFilterPrivateAddrs(t *testing.T) {
+	tests := []struct {
+		addr  string
+		allow bool
+	}{
+		{"/ip4/10.1.2.3/udp/60000/quic", false},    //10.0.0.0/8
+		{"/ip4/172.16.0.1/udp/60000/quic", false},  //172.16.0.0/12
+		{"/ip4/172.31.255.254/tcp/60000", false},   //172.16.0.0/12
+		{"/ip4/192.168.1.2/udp/60000/quic", false}, //192.168.0.0/16
+		{"/ip4/100.64.0.1/udp/60000/quic", false},  //100.64.0.0/10
+		{"/ip4/100.127.255.254/tcp/60000", false},  //100.64.0.0/10
+		{"/ip4/172.32.0.1/udp/60000/quic", true},   //172.16.0.0/12之外
+		{"/ip4/100.128.0.1/udp/60000/quic", true},  //100.64.0.0/10之外
+		{"/ip4/8.8.8.8/udp/60000/quic", true},      //公网
+		{"/dns4/example.com/tcp/60000", true},      //没有IP
+	}
+
+	g := &connGater{filterPrivate: true}
+	for _, test := range tests {
+		ma, e := multiaddr.NewMultiaddr(test.addr)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if g.InterceptAddrDial("", ma) != test.allow {
+			t.Error("过滤结果错误:", test.addr, "期望允许:", test.allow)
+		}
+	}
+
+	//关闭过滤时全部允许(局域网测试)
+	g = &connGater{}
+	for _, test := range tests {
+		ma, _ := multiaddr.NewMultiaddr(test.addr)
+		if !g.InterceptAddrDial("", ma) {
+			t.Error("关闭过滤时应允许:", test.addr)
+		}
+	}
+}
+
+func TestConnGaterMaxConnsPerIP(t *testing.T) {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	server, e := libp2p.New(ctx,
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		libp2p.ConnectionGater(newConnGater(Config{MaxConnsPerIP: 2})),
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer server.Close()
+	node = server
+
+	//同一IP的多个节点依次连接
+	var connected int
+	for i := 0; i < 4; i++ {
+		client, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if e != nil {
+			t.Fatal(e)
+		}
+		defer client.Close()
+
+		e = client.Connect(ctx, peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()})
+		if e == nil {
+			connected++
+		}
+	}
+	if connected != 2 {
+		t.Fatal("同一IP的连接数量应限制为2, 实际:", connected)
+	}
+}
@@ -0,0 +1,120 @@
+package mp2p
+
+import (
+	"errors"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/multiformats/go-multiaddr"
+	"strings"
+)
+
+var ErrNotIdentified = errors.New("还没有和节点交换标识")
+
+// 配置的宣告地址(Config.AnnounceAddrs), 不含节点ID
+var announceAddrs []multiaddr.Multiaddr
+
+// 解析宣告地址, 去掉结尾的 /p2p/<节点ID>
+func parseAnnounceAddr(text string) (multiaddr.Multiaddr, error) {
+	ma, e := multiaddr.NewMultiaddr(text)
+	if e != nil {
+		return nil, e
+	}
+	transport, id := peer.SplitAddr(ma)
+	if transport == nil {
+		return nil, fmt.Errorf("没有传输地址")
+	}
+	if id != "" && node != nil && id != node.ID() {
+		return nil, fmt.Errorf("节点ID不是自己: %s", id)
+	}
+	return transport, nil
+}
+
+// 设置宣告地址, 格式错误的地址忽略(启动前已检查)
+func setAnnounceAddrs(texts []string) {
+	announceAddrs = nil
+	for _, text := range texts {
+		ma, e := parseAnnounceAddr(text)
+		if e == nil {
+			announceAddrs = append(announceAddrs, ma)
+		}
+	}
+}
+
+// 配置的宣告地址(P2P地址)
+func announceP2pAddrs() []string {
+	addrs := make([]string, 0, len(announceAddrs))
+	for _, ma := range announceAddrs {
+		addrs = append(addrs, strings.Join([]string{ma.String(), "/p2p/", node.ID().String()}, ""))
+	}
+	return addrs
+}
+
+// 节点地址工厂, 在监听地址之后加入NAT映射地址和达到阈值的观察地址
+// 标识协议使用节点地址, 其它节点因此能在标识交换中得到NAT地址. 配置了宣告地址时只使用宣告地址.
+// 监听地址经过IPv6作用域过滤, 不宣告IPv6链路本地和唯一本地地址(Config.AnnounceIPv6Local).
+func natAddrsFactory(listenAddrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+	if len(announceAddrs) > 0 {
+		return append([]multiaddr.Multiaddr(nil), announceAddrs...)
+	}
+	var addrs []multiaddr.Multiaddr
+	exists := make(map[string]bool)
+	for _, ma := range listenAddrs {
+		if announceIPv6Scope(ma) {
+			exists[ma.String()] = true
+			addrs = append(addrs, ma)
+		}
+	}
+	for _, text := range natAdvertisedAddrs() {
+		ma, e := multiaddr.NewMultiaddr(text)
+		if e != nil {
+			continue
+		}
+		ai, e := peer.AddrInfoFromP2pAddr(ma)
+		if e != nil {
+			continue
+		}
+		for _, ma := range ai.Addrs {
+			if !exists[ma.String()] {
+				exists[ma.String()] = true
+				addrs = append(addrs, ma)
+			}
+		}
+	}
+	for _, ma := range promotedObservedAddrs() {
+		if !exists[ma.String()] {
+			exists[ma.String()] = true
+			addrs = append(addrs, ma)
+		}
+	}
+	return addrs
+}
+
+// 宣告地址变化时通知节点重新计算地址, 地址变化时libp2p会向已连接节点推送标识(identify-push)
+// 关闭Config.IdentifyPush时不通知, 其它节点在重新连接时才能得到新地址.
+func signalAddrsChanged() {
+	if !config.IdentifyPush || basicHost == nil {
+		return
+	}
+	if h, ok := basicHost.(interface{ SignalAddressChange() }); ok {
+		logMsg("identify.push")
+		h.SignalAddressChange()
+	}
+}
+
+// 节点支持的协议, 来自标识交换后节点存储中的协议记录
+// 发送请求前可据此判断对方是否支持协议, 避免打开注定协商失败的流. 还没有交换标识(没有协议记录)时返回ErrNotIdentified.
+func PeerProtocols(id peer.ID) ([]protocol.ID, error) {
+	texts, e := node.Peerstore().GetProtocols(id)
+	if e != nil {
+		return nil, e
+	}
+	if len(texts) == 0 {
+		return nil, ErrNotIdentified
+	}
+	protocols := make([]protocol.ID, len(texts))
+	for i, text := range texts {
+		protocols[i] = protocol.ID(text)
+	}
+	return protocols, nil
+}
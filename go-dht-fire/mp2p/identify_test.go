@@ -0,0 +1,72 @@
+package mp2p
+
+import (
+	"errors"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"testing"
+	"time"
+)
+
+func TestPeerProtocols(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+
+	if _, e := PeerProtocols(randomPeerID(t)); !errors.Is(e, ErrNotIdentified) {
+		t.Fatal("没有标识的节点应返回ErrNotIdentified:", e)
+	}
+
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer remote.Close()
+	remote.SetStreamHandler("/mp2p/test/feature", func(s network.Stream) {
+		_ = s.Close()
+	})
+	e = node.Connect(ctx, peer.AddrInfo{ID: remote.ID(), Addrs: remote.Addrs()})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	//标识交换在连接后异步完成
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		protocols, e := PeerProtocols(remote.ID())
+		if e == nil {
+			for _, proto := range protocols {
+				if proto == "/mp2p/test/feature" {
+					return
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("应包含对方支持的协议:", protocols, e)
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+}
+
+func TestAnnounceAddrs(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	defer setAnnounceAddrs(nil)
+
+	self := node.ID().String()
+	setAnnounceAddrs([]string{"/ip4/1.2.3.4/udp/4001/quic", "/ip4/1.2.3.4/tcp/4001/p2p/" + self})
+	addrs := natAddrsFactory(node.Network().ListenAddresses())
+	if len(addrs) != 2 || addrs[0].String() != "/ip4/1.2.3.4/udp/4001/quic" || addrs[1].String() != "/ip4/1.2.3.4/tcp/4001" {
+		t.Fatal("节点地址应只有宣告地址:", addrs)
+	}
+	advertised := advertisedAddrs()
+	if len(advertised) != 2 || advertised[0] != "/ip4/1.2.3.4/udp/4001/quic/p2p/"+self {
+		t.Fatal("宣告地址错误:", advertised)
+	}
+
+	for _, text := range []string{"not-a-multiaddr", "/p2p/" + self, "/ip4/1.2.3.4/tcp/4001/p2p/" + randomPeerID(t).String()} {
+		if _, e := parseAnnounceAddr(text); e == nil {
+			t.Fatal("宣告地址应出错:", text)
+		}
+	}
+}
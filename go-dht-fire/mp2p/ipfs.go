@@ -0,0 +1,40 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/peer"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"sync"
+)
+
+// 连接IPFS公共启发节点, 加入IPFS公共DHT, 返回连接成功的数量
+// IPFS启发节点不支持引导协议, 只连接不交换节点地址, 节点发现完全依靠DHT.
+// 注意: DHT使用默认协议前缀(/ipfs/kad/1.0.0)才能加入公共DHT, 此时节点对IPFS网络可见, 也会处理IPFS网络的DHT请求.
+func connectIPFSBootstrap() int {
+	ais, e := peer.AddrInfosFromP2pAddrs(dht.DefaultBootstrapPeers...)
+	if e != nil {
+		logMsg("ipfs.addrs_invalid", e)
+		return 0
+	}
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	count := 0
+	for _, ai := range ais {
+		wg.Add(1)
+		go func(ai peer.AddrInfo) {
+			defer wg.Done()
+			addAddrs(ai, bootstrapAddrTTL())
+			e := connect(ai)
+			if e != nil {
+				logMsg("ipfs.connect_failed", ai.ID.String(), e)
+				return
+			}
+			logMsg("ipfs.connected", ai.ID.String())
+			lock.Lock()
+			count++
+			lock.Unlock()
+		}(ai)
+	}
+	wg.Wait()
+	return count
+}
@@ -0,0 +1,132 @@
+package mp2p
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	RSA_KEY_BITS     = 2048      //RSA密钥长度
+	DEFAULT_KEY_TYPE = "ed25519" //默认生成的密钥类型
+)
+
+var (
+	ErrKeyDirEscape = errors.New("密钥目录超出工作目录, 请使用绝对路径")
+	ErrKeyMissing   = errors.New("没有密钥")
+)
+
+// 整理密钥目录路径, 为空时使用DEFAULT_KEY_DIR
+// 统一分隔符(Windows下/和\都可使用), 去掉多余的分隔符, .和.. . 相对路径整理后仍在工作目录之外(以..开头)时返回ErrKeyDirEscape.
+func cleanKeyDir(dir string) (string, error) {
+	if dir == "" {
+		dir = DEFAULT_KEY_DIR
+	}
+	dir = filepath.Clean(filepath.FromSlash(dir))
+	if !filepath.IsAbs(dir) && (dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator))) {
+		return "", fmt.Errorf("%w: %s", ErrKeyDirEscape, dir)
+	}
+	return dir, nil
+}
+
+// 密钥类型名称
+var keyTypes = map[string]int{
+	"rsa":       crypto.RSA,
+	"ed25519":   crypto.Ed25519,
+	"secp256k1": crypto.Secp256k1,
+	"ecdsa":     crypto.ECDSA,
+}
+
+// 解析密钥类型名称(rsa, ed25519, secp256k1或ecdsa), 为空时使用DEFAULT_KEY_TYPE
+func ParseKeyType(name string) (int, error) {
+	if name == "" {
+		name = DEFAULT_KEY_TYPE
+	}
+	keyType, exists := keyTypes[strings.ToLower(name)]
+	if !exists {
+		return 0, fmt.Errorf("密钥类型错误: %s", name)
+	}
+	return keyType, nil
+}
+
+// 生成密钥, keyType为crypto.RSA, crypto.Ed25519, crypto.Secp256k1或crypto.ECDSA
+func generateKey(keyType int) (crypto.PrivKey, error) {
+	bits := -1
+	if keyType == crypto.RSA {
+		bits = RSA_KEY_BITS
+	}
+	prKey, _, e := crypto.GenerateKeyPairWithReader(keyType, bits, rand.Reader)
+	if e != nil {
+		return nil, fmt.Errorf("生成密钥出错: %w", e)
+	}
+	return prKey, nil
+}
+
+// 更换密钥, 用于迁移节点身份(例如从RSA换为Ed25519)
+// 生成新密钥, 旧私钥改名为 private-<旧节点ID> 保存在同一目录, 不会删除. 新旧私钥都只允许所有者读写(0600). 返回新旧节点ID, 以便更新使用旧ID的启发节点地址.
+// 节点重启后使用新密钥, 其它节点缓存的旧地址将失效.
+func RotateKey(dir string, newType int) (oldID, newID peer.ID, err error) {
+	dir, e := cleanKeyDir(dir)
+	if e != nil {
+		return "", "", e
+	}
+	privatePath := filepath.Join(dir, "private")
+	publicPath := filepath.Join(dir, "public")
+
+	privateKeyBytes, e := ioutil.ReadFile(privatePath)
+	if e != nil {
+		return "", "", fmt.Errorf("读取私钥出错: %w", e)
+	}
+	oldKey, e := crypto.UnmarshalPrivateKey(privateKeyBytes)
+	if e != nil {
+		return "", "", fmt.Errorf("读取私钥出错: %w", e)
+	}
+	oldID, e = peer.IDFromPrivateKey(oldKey)
+	if e != nil {
+		return "", "", e
+	}
+
+	newKey, e := generateKey(newType)
+	if e != nil {
+		return "", "", e
+	}
+	newID, e = peer.IDFromPrivateKey(newKey)
+	if e != nil {
+		return "", "", e
+	}
+	newKeyBytes, e := crypto.MarshalPrivateKey(newKey)
+	if e != nil {
+		return "", "", e
+	}
+
+	//保存旧密钥
+	archivePath := filepath.Join(dir, "private-"+oldID.String())
+	e = os.Rename(privatePath, archivePath)
+	if e != nil {
+		return "", "", fmt.Errorf("保存旧私钥出错: %w", e)
+	}
+	//旧私钥可能是以前用0644写入的, 保存后只允许所有者读写
+	e = os.Chmod(archivePath, 0600)
+	if e != nil {
+		_ = os.Rename(archivePath, privatePath)
+		return "", "", fmt.Errorf("保存旧私钥出错: %w", e)
+	}
+	if _, e = os.Stat(publicPath); e == nil {
+		_ = os.Rename(publicPath, filepath.Join(dir, "public-"+oldID.String()))
+	}
+
+	e = ioutil.WriteFile(privatePath, newKeyBytes, 0600)
+	if e != nil {
+		//恢复旧密钥
+		_ = os.Rename(archivePath, privatePath)
+		return "", "", fmt.Errorf("存储新私钥出错: %w", e)
+	}
+	logMsg("key.rotated", oldID.String(), newID.String())
+	return oldID, newID, nil
+}
@@ -0,0 +1,202 @@
+package mp2p
+
+import (
+	"errors"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestRotateKey(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mp2p")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	dir = filepath.Join(dir, "rsa")
+
+	prKey, _, _ := rsaKey(dir, crypto.Ed25519, false)
+	id, _ := peer.IDFromPrivateKey(prKey)
+	//以前的版本用0644写入私钥
+	if e = os.Chmod(filepath.Join(dir, "private"), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	oldID, newID, e := RotateKey(dir, crypto.Secp256k1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if oldID != id || newID == id {
+		t.Fatal("节点ID错误:", id, oldID, newID)
+	}
+	if _, e = os.Stat(filepath.Join(dir, "private-"+oldID.String())); e != nil {
+		t.Fatal("旧私钥应保留:", e)
+	}
+	if runtime.GOOS != "windows" {
+		for _, name := range []string{"private", "private-" + oldID.String()} {
+			info, e := os.Stat(filepath.Join(dir, name))
+			if e != nil || info.Mode().Perm() != 0600 {
+				t.Fatal("私钥应只允许所有者读写:", name, info.Mode(), e)
+			}
+		}
+	}
+
+	newKey, _, _ := rsaKey(dir, crypto.Ed25519, false)
+	if newKey.Type() != crypto.Secp256k1 {
+		t.Fatal("新密钥类型错误:", newKey.Type())
+	}
+	loadedID, _ := peer.IDFromPrivateKey(newKey)
+	if loadedID != newID {
+		t.Fatal("应使用新密钥:", loadedID, newID)
+	}
+}
+
+func TestRequireExistingKey(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mp2p")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	dir = filepath.Join(dir, "rsa")
+
+	_, _, e = rsaKey(dir, crypto.Ed25519, true)
+	if !errors.Is(e, ErrKeyMissing) {
+		t.Fatal("没有密钥时应出错:", e)
+	}
+	if _, e = os.Stat(dir); !os.IsNotExist(e) {
+		t.Fatal("不应创建密钥文件夹:", e)
+	}
+
+	if e = os.Mkdir(dir, 0755); e != nil {
+		t.Fatal(e)
+	}
+	_, _, e = rsaKey(dir, crypto.Ed25519, true)
+	if !errors.Is(e, ErrKeyMissing) {
+		t.Fatal("空文件夹应出错:", e)
+	}
+	os.Remove(dir)
+
+	prKey, _, _ := rsaKey(dir, crypto.Ed25519, false)
+	loadedKey, _, e := rsaKey(dir, crypto.Ed25519, true)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !loadedKey.Equals(prKey) {
+		t.Fatal("应读取已有密钥")
+	}
+}
+
+// 目录存在但没有私钥(如容器挂载了空卷)时生成密钥
+func TestEmptyKeyDir(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mp2p")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	prKey, _, e := rsaKey(dir, crypto.Ed25519, false)
+	if e != nil || prKey == nil {
+		t.Fatal("空文件夹应生成密钥:", e)
+	}
+	info, e := os.Stat(filepath.Join(dir, "private"))
+	if e != nil {
+		t.Fatal("应存储私钥:", e)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Fatal("私钥应只允许所有者读写:", info.Mode())
+	}
+	loadedKey, _, e := rsaKey(dir, crypto.Ed25519, false)
+	if e != nil || !loadedKey.Equals(prKey) {
+		t.Fatal("应读取生成的密钥:", e)
+	}
+}
+
+// 目录存在但不能写入时返回错误, 不能使用每次启动都不同的临时身份
+func TestKeyDirUnwritable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows不支持只读目录权限")
+	}
+	dir, e := ioutil.TempDir("", "mp2p")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	if e = os.Chmod(dir, 0500); e != nil {
+		t.Fatal(e)
+	}
+	defer os.Chmod(dir, 0700)
+	//root不受目录权限限制
+	if f, e := os.Create(filepath.Join(dir, "probe")); e == nil {
+		_ = f.Close()
+		t.Skip("目录仍可写入(root), 跳过")
+	}
+
+	prKey, _, e := rsaKey(dir, crypto.Ed25519, false)
+	if e == nil || prKey != nil {
+		t.Fatal("不能存储私钥时应出错:", e)
+	}
+	if _, e = os.Stat(filepath.Join(dir, "private")); !os.IsNotExist(e) {
+		t.Fatal("不应有私钥文件:", e)
+	}
+}
+
+func TestSecp256k1Key(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mp2p")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	dir = filepath.Join(dir, "rsa")
+
+	keyType, e := ParseKeyType("SECP256K1")
+	if e != nil || keyType != crypto.Secp256k1 {
+		t.Fatal("解析密钥类型错误:", keyType, e)
+	}
+	if _, e = ParseKeyType("dsa"); e == nil {
+		t.Fatal("未知密钥类型应出错")
+	}
+
+	prKey, _, _ := rsaKey(dir, keyType, false)
+	if prKey.Type() != crypto.Secp256k1 {
+		t.Fatal("密钥类型错误:", prKey.Type())
+	}
+	id, _ := peer.IDFromPrivateKey(prKey)
+
+	//重新加载得到同一身份, 配置的类型不影响已有密钥
+	loadedKey, _, _ := rsaKey(dir, crypto.RSA, false)
+	if !loadedKey.Equals(prKey) {
+		t.Fatal("重新加载的密钥不同")
+	}
+	loadedID, _ := peer.IDFromPrivateKey(loadedKey)
+	if loadedID != id {
+		t.Fatal("节点ID错误:", loadedID, id)
+	}
+	puKey, e := id.ExtractPublicKey()
+	if e != nil || !puKey.Equals(prKey.GetPublic()) {
+		t.Fatal("节点ID中的公钥错误:", e)
+	}
+}
+
+func TestCleanKeyDir(t *testing.T) {
+	for dir, want := range map[string]string{
+		"":                    filepath.FromSlash("config/rsa"),
+		"./config/rsa/":       filepath.FromSlash("config/rsa"),
+		"config//rsa/../key":  filepath.FromSlash("config/key"),
+		"/var/lib/mp2p/../k/": filepath.FromSlash("/var/lib/k"),
+		"/../k":               filepath.FromSlash("/k"),
+	} {
+		cleaned, e := cleanKeyDir(dir)
+		if e != nil || cleaned != want {
+			t.Fatal("整理路径错误:", dir, cleaned, e)
+		}
+	}
+	for _, dir := range []string{"..", "../rsa", "config/../../rsa"} {
+		if _, e := cleanKeyDir(dir); !errors.Is(e, ErrKeyDirEscape) {
+			t.Fatal("超出工作目录应出错:", dir, e)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package mp2p
+
+import (
+	"errors"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/event"
+	"github.com/multiformats/go-multiaddr"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoListenAddrs = errors.New("等待监听地址超时")
+
+// 获取监听地址
+// 没有设置Config.ListenAddrs时监听所有IPv4地址的指定端口.
+// 指定了具体IP的地址会检查该IP是否属于本机网卡.
+func listenAddrs(c Config) ([]string, error) {
+	if len(c.ListenAddrs) == 0 {
+		return []string{
+			strings.Join([]string{"/ip4/0.0.0.0/tcp/", c.Port}, ""),          //监听IPv4
+			strings.Join([]string{"/ip4/0.0.0.0/udp/", c.Port, "/quic"}, ""), //监听IPv4
+			//strings.Join([]string{"/ip6/::/udp/", c.Port, "/quic"}, ""),      //监听IPv6
+		}, nil
+	}
+
+	for _, text := range c.ListenAddrs {
+		ma, e := multiaddr.NewMultiaddr(text)
+		if e != nil {
+			return nil, fmt.Errorf("监听地址格式错误 %s: %w", text, e)
+		}
+		ip := maIP(ma)
+		if ip == nil || ip.IsUnspecified() {
+			continue
+		}
+		e = checkInterfaceIP(ip)
+		if e != nil {
+			return nil, e
+		}
+	}
+
+	return c.ListenAddrs, nil
+}
+
+// 传输监听地址
+type transportAddr struct {
+	Protocol string              //端口协议, udp或tcp
+	IP       net.IP              //监听IP, 0.0.0.0表示所有网卡
+	Port     int                 //监听端口
+	Suffix   multiaddr.Multiaddr //端口之后的部分, 例如/quic, 没有时为nil
+}
+
+// 生成该传输的P2P地址
+func (t transportAddr) p2pAddr(ip net.IP, port int) string {
+	ipProtocol := "/ip4/"
+	if ip.To4() == nil {
+		ipProtocol = "/ip6/"
+	}
+	suffix := ""
+	if t.Suffix != nil {
+		suffix = t.Suffix.String()
+	}
+	return strings.Join([]string{ipProtocol, ip.String(), "/", t.Protocol, "/", strconv.Itoa(port), suffix, "/ipfs/", node.ID().String()}, "")
+}
+
+// 获取各传输的监听地址(QUIC在前)
+// 没有TCP或UDP监听地址时返回错误.
+func transportListenAddrs(addrs []string) ([]transportAddr, error) {
+	var transports []transportAddr
+	for _, text := range addrs {
+		ma, e := multiaddr.NewMultiaddr(text)
+		if e != nil {
+			continue
+		}
+		ip := maIP(ma)
+		if ip == nil {
+			continue
+		}
+		components := multiaddr.Split(ma)
+		if len(components) < 2 {
+			continue
+		}
+		protocol := components[1].Protocols()[0]
+		if protocol.Code != multiaddr.P_UDP && protocol.Code != multiaddr.P_TCP {
+			continue
+		}
+		portText, e := components[1].ValueForProtocol(protocol.Code)
+		if e != nil {
+			continue
+		}
+		port, e := strconv.Atoi(portText)
+		if e != nil {
+			continue
+		}
+		t := transportAddr{Protocol: protocol.Name, IP: ip, Port: port}
+		if len(components) > 2 {
+			t.Suffix = multiaddr.Join(components[2:]...)
+		}
+		transports = append(transports, t)
+	}
+	if len(transports) == 0 {
+		return nil, fmt.Errorf("没有TCP或UDP监听地址")
+	}
+
+	sort.SliceStable(transports, func(i, j int) bool {
+		return transports[i].isQuic() && !transports[j].isQuic()
+	})
+	return transports, nil
+}
+
+// 端口被占用时改为随机端口(0), 用于Config.PortFallback
+// 只检查TCP和UDP端口, 检查后到节点监听之间端口仍可能被占用.
+func fallbackListenAddrs(addrs []string) []string {
+	result := make([]string, 0, len(addrs))
+	for _, text := range addrs {
+		result = append(result, fallbackListenAddr(text))
+	}
+	return result
+}
+
+func fallbackListenAddr(text string) string {
+	ma, e := multiaddr.NewMultiaddr(text)
+	if e != nil {
+		return text
+	}
+	ip := maIP(ma)
+	components := multiaddr.Split(ma)
+	if ip == nil || len(components) < 2 {
+		return text
+	}
+	protocol := components[1].Protocols()[0]
+	if protocol.Code != multiaddr.P_UDP && protocol.Code != multiaddr.P_TCP {
+		return text
+	}
+	portText, e := components[1].ValueForProtocol(protocol.Code)
+	if e != nil || portText == "0" || portAvailable(protocol.Name, ip, portText) {
+		return text
+	}
+
+	random, e := multiaddr.NewComponent(protocol.Name, "0")
+	if e != nil {
+		return text
+	}
+	components[1] = random
+	fallback := multiaddr.Join(components...).String()
+	logMsg("listen.port_fallback", text, fallback)
+	return fallback
+}
+
+// 端口是否可以监听
+func portAvailable(protocol string, ip net.IP, port string) bool {
+	address := net.JoinHostPort(ip.String(), port)
+	if protocol == "udp" {
+		conn, e := net.ListenPacket("udp", address)
+		if e != nil {
+			return false
+		}
+		_ = conn.Close()
+		return true
+	}
+	listener, e := net.Listen("tcp", address)
+	if e != nil {
+		return false
+	}
+	_ = listener.Close()
+	return true
+}
+
+// 使用实际监听的端口更新随机端口(0)的传输, 使NAT映射和宣告地址使用实际端口
+// listenAddrs为节点的监听地址(未展开0.0.0.0), 与传输的协议, IP和后缀都相同时使用其端口.
+func boundTransports(transports []transportAddr, listenAddrs []multiaddr.Multiaddr) []transportAddr {
+	bound, _ := transportListenAddrs(maStrings(listenAddrs))
+	result := make([]transportAddr, 0, len(transports))
+	for _, t := range transports {
+		if t.Port == 0 {
+			for _, b := range bound {
+				if b.Protocol == t.Protocol && b.IP.Equal(t.IP) && b.isQuic() == t.isQuic() && b.Port != 0 {
+					t.Port = b.Port
+					break
+				}
+			}
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+// 地址转为文本
+func maStrings(mas []multiaddr.Multiaddr) []string {
+	texts := make([]string, 0, len(mas))
+	for _, ma := range mas {
+		texts = append(texts, ma.String())
+	}
+	return texts
+}
+
+// 是否为QUIC传输
+func (t transportAddr) isQuic() bool {
+	if t.Suffix == nil {
+		return false
+	}
+	_, e := t.Suffix.ValueForProtocol(multiaddr.P_QUIC)
+	return e == nil
+}
+
+// 获取地址中的IP, 没有时返回nil
+func maIP(ma multiaddr.Multiaddr) net.IP {
+	text, e := ma.ValueForProtocol(multiaddr.P_IP4)
+	if e != nil {
+		text, e = ma.ValueForProtocol(multiaddr.P_IP6)
+		if e != nil {
+			return nil
+		}
+	}
+	return net.ParseIP(text)
+}
+
+// 检查IP是否属于本机网卡
+func checkInterfaceIP(ip net.IP) error {
+	addrs, e := net.InterfaceAddrs()
+	if e != nil {
+		return e
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if ok && ipNet.IP.Equal(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("IP %s 不属于任何网卡", ip)
+}
+
+// 等待节点开始监听, 返回节点地址
+// 节点刚创建时地址可能为空, 此时计算和宣告的地址不可用. 超时返回ErrNoListenAddrs.
+func waitListenAddrs(timeout time.Duration) ([]multiaddr.Multiaddr, error) {
+	sub, e := node.EventBus().Subscribe(new(event.EvtLocalAddressesUpdated))
+	if e != nil {
+		return nil, e
+	}
+	defer sub.Close()
+
+	if addrs := node.Addrs(); len(addrs) > 0 {
+		return addrs, nil
+	}
+	timeoutChan := clock.After(timeout)
+	for {
+		select {
+		case <-sub.Out():
+			if addrs := node.Addrs(); len(addrs) > 0 {
+				return addrs, nil
+			}
+		case <-timeoutChan:
+			return nil, ErrNoListenAddrs
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// IPv6唯一本地地址(ULA), 只在站点内可达
+var ipv6UniqueLocal = &net.IPNet{IP: net.ParseIP("fc00::"), Mask: net.CIDRMask(7, 128)}
+
+// 是否为IPv6链路本地(fe80::/10)或唯一本地(fc00::/7)地址
+func isIPv6Local(ip net.IP) bool {
+	if ip == nil || ip.To4() != nil {
+		return false
+	}
+	return ip.IsLinkLocalUnicast() || ipv6UniqueLocal.Contains(ip)
+}
+
+// IPv6作用域过滤, 开启Config.AnnounceIPv6Local前不宣告IPv6链路本地和唯一本地地址
+// 这些地址在其它网络不可达, 宣告后其它节点会浪费时间拨号.
+func announceIPv6Scope(ma multiaddr.Multiaddr) bool {
+	return config.AnnounceIPv6Local || !isIPv6Local(maIP(ma))
+}
+
+// 默认宣告地址过滤, 不宣告回环, IPv4链路本地和Unix域套接字地址
+// IPv6链路本地地址由announceIPv6Scope处理.
+func defaultAnnounceFilter(ma multiaddr.Multiaddr) bool {
+	if _, e := ma.ValueForProtocol(multiaddr.P_UNIX); e == nil {
+		return false
+	}
+	ip := maIP(ma)
+	if ip == nil {
+		return true
+	}
+	return !ip.IsLoopback() && !(ip.To4() != nil && ip.IsLinkLocalUnicast())
+}
+
+// 是否宣告地址, 先经过IPv6作用域过滤, 再使用Config.AnnounceFilter, 没有设置时使用默认过滤
+func shouldAnnounce(ma multiaddr.Multiaddr) bool {
+	if !announceIPv6Scope(ma) {
+		return false
+	}
+	if config.AnnounceFilter != nil {
+		return config.AnnounceFilter(ma)
+	}
+	return defaultAnnounceFilter(ma)
+}
+
+// 过滤宣告地址
+func filterAnnounceAddrs(addrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+	var result []multiaddr.Multiaddr
+	for _, ma := range addrs {
+		if shouldAnnounce(ma) {
+			result = append(result, ma)
+		}
+	}
+	return result
+}
+
+// 过滤宣告地址(文本), 格式错误的地址也会丢弃
+func filterAnnounceTexts(addrs []string) []string {
+	var result []string
+	for _, addr := range addrs {
+		ma, e := multiaddr.NewMultiaddr(addr)
+		if e != nil || !shouldAnnounce(ma) {
+			continue
+		}
+		result = append(result, addr)
+	}
+	return result
+}
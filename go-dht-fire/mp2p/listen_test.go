@@ -0,0 +1,116 @@
+package mp2p
+
+import (
+	"github.com/multiformats/go-multiaddr"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitListenAddrs(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+
+	addrs, e := waitListenAddrs(time.Second * 5)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(addrs) == 0 {
+		t.Fatal("引导前节点地址不应为空")
+	}
+}
+
+func TestDefaultAnnounceFilter(t *testing.T) {
+	addrs := []string{
+		"/ip4/127.0.0.1/udp/60000/quic",
+		"/ip4/169.254.1.2/tcp/60000",
+		"/ip6/fe80::1/tcp/60000",
+		"/unix/tmp/mp2p.sock",
+		"/ip4/192.168.1.2/udp/60000/quic",
+		"/ip4/1.2.3.4/tcp/60000",
+		"格式错误",
+	}
+	result := filterAnnounceTexts(addrs)
+	if len(result) != 2 || result[0] != addrs[4] || result[1] != addrs[5] {
+		t.Fatal("过滤结果错误:", result)
+	}
+}
+
+func TestPortFallback(t *testing.T) {
+	listener, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer listener.Close()
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+
+	addrs := fallbackListenAddrs([]string{
+		strings.Join([]string{"/ip4/127.0.0.1/tcp/", port}, ""),
+		"/ip4/127.0.0.1/udp/0/quic",
+	})
+	if addrs[0] != "/ip4/127.0.0.1/tcp/0" || addrs[1] != "/ip4/127.0.0.1/udp/0/quic" {
+		t.Fatal("被占用的端口应改为随机端口:", addrs)
+	}
+
+	transports, e := transportListenAddrs([]string{"/ip4/0.0.0.0/tcp/0", "/ip4/0.0.0.0/udp/0/quic"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	tcpAddr, _ := multiaddr.NewMultiaddr("/ip4/0.0.0.0/tcp/4321")
+	quicAddr, _ := multiaddr.NewMultiaddr("/ip4/0.0.0.0/udp/4322/quic")
+	transports = boundTransports(transports, []multiaddr.Multiaddr{tcpAddr, quicAddr})
+	for _, tr := range transports {
+		if (tr.isQuic() && tr.Port != 4322) || (!tr.isQuic() && tr.Port != 4321) {
+			t.Fatal("应使用实际监听的端口:", transports)
+		}
+	}
+}
+
+func TestIPv6AnnounceScope(t *testing.T) {
+	defer func() {
+		config = Config{}
+	}()
+	addrs := []string{
+		"/ip6/fe80::1c2d:3eff:fe4f:5a6b/tcp/60000",
+		"/ip6/febf::1/udp/60000/quic",
+		"/ip6/fd12:3456:789a::1/tcp/60000",
+		"/ip6/fc00::1/tcp/60000",
+		"/ip6/2001:db8::1/udp/60000/quic",
+		"/ip6/fec0::1/tcp/60000",
+		"/ip4/192.168.1.2/tcp/60000",
+	}
+	var mas []multiaddr.Multiaddr
+	for _, addr := range addrs {
+		ma, _ := multiaddr.NewMultiaddr(addr)
+		mas = append(mas, ma)
+	}
+
+	//默认不宣告链路本地和唯一本地地址, 节点地址工厂同样过滤
+	config = Config{}
+	if result := filterAnnounceTexts(addrs); !reflect.DeepEqual(result, addrs[4:]) {
+		t.Fatal("默认过滤结果错误:", result)
+	}
+	if result := natAddrsFactory(mas); len(result) != 3 || result[0].String() != addrs[4] {
+		t.Fatal("节点地址工厂过滤结果错误:", result)
+	}
+
+	//自定义过滤不影响IPv6作用域过滤
+	config = Config{AnnounceFilter: func(ma multiaddr.Multiaddr) bool {
+		return true
+	}}
+	if result := filterAnnounceTexts(addrs); !reflect.DeepEqual(result, addrs[4:]) {
+		t.Fatal("自定义过滤时仍应过滤IPv6本地地址:", result)
+	}
+
+	//开启后宣告
+	config = Config{AnnounceIPv6Local: true}
+	if result := filterAnnounceTexts(addrs); !reflect.DeepEqual(result, addrs) {
+		t.Fatal("开启后应宣告IPv6本地地址:", result)
+	}
+	if result := natAddrsFactory(mas); len(result) != len(addrs) {
+		t.Fatal("开启后节点地址工厂应宣告IPv6本地地址:", result)
+	}
+}
@@ -0,0 +1,232 @@
+package mp2p
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LOG_FORMAT_TEXT = "text" //文本日志(默认), 格式为 时间 [键] 消息 参数...
+	LOG_FORMAT_JSON = "json" //JSON日志, 每行一个对象
+
+	DEFAULT_LOG_MAX_SIZE    = 10 * 1024 * 1024 //日志文件默认最大字节数
+	DEFAULT_LOG_MAX_BACKUPS = 5                //默认保留的旧日志文件数量
+)
+
+// JSON日志行
+type logLine struct {
+	Time      string   `json:"time"`           //RFC3339时间(毫秒)
+	Level     string   `json:"level"`          //info, warn或fatal
+	Component string   `json:"component"`      //键的前缀, 例如 node, nat, dht
+	Key       string   `json:"key"`            //消息键
+	Msg       string   `json:"msg"`            //消息文本(按日志语言)
+	Peer      string   `json:"peer,omitempty"` //参数中的第一个节点ID
+	Args      []string `json:"args,omitempty"` //其余参数
+}
+
+// 日志输出, 为nil时使用标准库log(文本格式)
+var logLock sync.Mutex
+var logFormat = LOG_FORMAT_TEXT
+var logWriter io.Writer
+var logFile *rotatingFile
+
+// 设置日志格式和日志文件, 节点启动时调用
+func setLogOutput(c Config) error {
+	e := closeLogOutput()
+	if e != nil {
+		return e
+	}
+	logLock.Lock()
+	defer logLock.Unlock()
+	logFormat = LOG_FORMAT_TEXT
+	if c.LogFormat == LOG_FORMAT_JSON {
+		logFormat = LOG_FORMAT_JSON
+	}
+	if c.LogFile == "" {
+		if logFormat == LOG_FORMAT_JSON {
+			logWriter = os.Stderr
+		}
+		return nil
+	}
+	logFile, e = openRotatingFile(c.LogFile, c.LogMaxSize, c.LogMaxAge, c.LogMaxBackups)
+	if e != nil {
+		return fmt.Errorf("打开日志文件出错: %w", e)
+	}
+	logWriter = logFile
+	return nil
+}
+
+// 关闭日志文件, 之后的日志输出到标准库log
+func closeLogOutput() error {
+	logLock.Lock()
+	defer logLock.Unlock()
+	logWriter = nil
+	if logFile == nil {
+		return nil
+	}
+	e := logFile.Close()
+	logFile = nil
+	return e
+}
+
+// 日志级别, 按键判断: 出错, 无效和不一致为warn, 其余为info
+func logLevel(key string) string {
+	for _, word := range []string{"failed", "invalid", "mismatch", "error"} {
+		if strings.Contains(key, word) {
+			return "warn"
+		}
+	}
+	return "info"
+}
+
+// 格式化一行日志
+func formatLog(level, key string, args []interface{}) []byte {
+	if logFormat != LOG_FORMAT_JSON {
+		text := fmt.Sprintln(append([]interface{}{"[" + key + "]", message(key)}, args...)...)
+		return []byte(clock.Now().Format("2006/01/02 15:04:05 ") + text)
+	}
+
+	line := logLine{
+		Time:      clock.Now().Format("2006-01-02T15:04:05.000Z07:00"),
+		Level:     level,
+		Component: strings.SplitN(key, ".", 2)[0],
+		Key:       key,
+		Msg:       message(key),
+	}
+	for _, arg := range args {
+		if line.Peer == "" {
+			if id, ok := argPeerID(arg); ok {
+				line.Peer = id
+				continue
+			}
+		}
+		line.Args = append(line.Args, fmt.Sprint(arg))
+	}
+	text, _ := json.Marshal(line)
+	return append(text, '\n')
+}
+
+// 参数是否为节点ID, 包括节点ID的文本
+func argPeerID(arg interface{}) (string, bool) {
+	switch v := arg.(type) {
+	case peer.ID:
+		return v.String(), true
+	case string:
+		if _, e := peer.Decode(v); e == nil {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// 输出日志
+func writeLog(level, key string, args []interface{}) {
+	logLock.Lock()
+	defer logLock.Unlock()
+	if logWriter == nil {
+		log.Println(append([]interface{}{"[" + key + "]", message(key)}, args...)...)
+		return
+	}
+	_, _ = logWriter.Write(formatLog(level, key, args))
+}
+
+// 按大小和时间轮转的日志文件
+// 超过maxSize字节或打开超过maxAge时把文件改名为 <路径>.1 (已有的旧文件依次加1), 只保留maxBackups个旧文件.
+type rotatingFile struct {
+	lock       sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	file       *os.File
+	size       int64
+	opened     time.Time
+}
+
+// 打开日志文件, 已存在时追加. maxSize和maxBackups不大于0时使用默认值, maxAge为0时不按时间轮转
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	if maxSize <= 0 {
+		maxSize = DEFAULT_LOG_MAX_SIZE
+	}
+	if maxBackups <= 0 {
+		maxBackups = DEFAULT_LOG_MAX_BACKUPS
+	}
+	f := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	e := f.open()
+	if e != nil {
+		return nil, e
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, e := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if e != nil {
+		return e
+	}
+	info, e := file.Stat()
+	if e != nil {
+		_ = file.Close()
+		return e
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = clock.Now()
+	return nil
+}
+
+// 轮转, 旧文件依次改名, 超出数量的删除
+func (f *rotatingFile) rotate() error {
+	e := f.file.Close()
+	f.file = nil
+	if e != nil {
+		return e
+	}
+	_ = os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxBackups))
+	for i := f.maxBackups - 1; i > 0; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	e = os.Rename(f.path, f.path+".1")
+	if e != nil {
+		//改名失败时继续写入原文件
+		_ = f.open()
+		return e
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	expired := f.maxAge > 0 && clock.Now().Sub(f.opened) >= f.maxAge
+	if f.size > 0 && (f.size+int64(len(p)) > f.maxSize || expired) {
+		e := f.rotate()
+		if e != nil {
+			return 0, fmt.Errorf("轮转日志文件出错: %w", e)
+		}
+	}
+	n, e := f.file.Write(p)
+	f.size += int64(n)
+	return n, e
+}
+
+func (f *rotatingFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	e := f.file.Close()
+	f.file = nil
+	return e
+}
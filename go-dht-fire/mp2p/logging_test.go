@@ -0,0 +1,72 @@
+package mp2p
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJSONLog(t *testing.T) {
+	var buf bytes.Buffer
+	logFormat, logWriter = LOG_FORMAT_JSON, &buf
+	defer func() {
+		logFormat, logWriter = LOG_FORMAT_TEXT, nil
+	}()
+
+	id := randomPeerID(t)
+	logMsg("reconnect.failed", id.String(), 2, "拨号出错")
+	var line logLine
+	if e := json.Unmarshal(buf.Bytes(), &line); e != nil {
+		t.Fatal(e, buf.String())
+	}
+	if line.Level != "warn" || line.Component != "reconnect" || line.Key != "reconnect.failed" || line.Peer != id.String() {
+		t.Fatal("日志字段错误:", buf.String())
+	}
+	if len(line.Args) != 2 || line.Args[0] != "2" || line.Time == "" {
+		t.Fatal("日志参数错误:", buf.String())
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	fc, restore := useFakeClock()
+	defer restore()
+	dir, e := ioutil.TempDir("", "mp2p")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dht.log")
+
+	f, e := openRotatingFile(path, 10, time.Hour, 2)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer f.Close()
+	for _, text := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		if _, e = f.Write([]byte(text)); e != nil {
+			t.Fatal(e)
+		}
+	}
+	//按大小轮转, 只保留2个旧文件
+	for name, want := range map[string]string{path: "dddddd\n", path + ".1": "cccccc\n", path + ".2": "bbbbbb\n"} {
+		data, _ := ioutil.ReadFile(name)
+		if string(data) != want {
+			t.Fatal("轮转错误:", name, string(data))
+		}
+	}
+	if _, e = os.Stat(path + ".3"); !os.IsNotExist(e) {
+		t.Fatal("不应保留更多旧文件")
+	}
+
+	//按时间轮转
+	fc.Advance(time.Hour)
+	_, _ = f.Write([]byte("e\n"))
+	data, _ := ioutil.ReadFile(path + ".1")
+	if string(data) != "dddddd\n" {
+		t.Fatal("应按时间轮转:", string(data))
+	}
+}
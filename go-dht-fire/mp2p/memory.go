@@ -0,0 +1,200 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/peer"
+	"sort"
+	"sync/atomic"
+)
+
+const (
+	MIN_MEMORY_BYTES = 64 * 1024 //Config.MaxMemoryBytes的最小值
+
+	PEER_ENTRY_BYTES  = 96  //节点缓存, 已知节点和分数中每条记录的估计字节数(不含地址文本)
+	SEEN_ENTRY_BYTES  = 160 //每条已见消息的估计字节数
+	EVENT_ENTRY_BYTES = 128 //每个事件缓冲的估计字节数
+
+	MIN_SEEN_CACHE_SIZE   = 100 //限制内存时去重缓存的最小数量
+	MIN_EVENT_BUFFER_SIZE = 16  //限制内存时事件缓冲的最小数量
+)
+
+// mp2p自身记录占用的内存(估计值, 字节)
+// 不包括libp2p的节点存储, DHT路由表和连接.
+type MemoryUsage struct {
+	Peers  int64 `json:"peers"`           //节点缓存, 已知节点和分数
+	Seen   int64 `json:"seen"`            //转发消息去重缓存
+	Events int64 `json:"events"`          //事件缓冲(按容量)
+	Total  int64 `json:"total"`           //合计
+	Limit  int64 `json:"limit,omitempty"` //上限(Config.MaxMemoryBytes), 0为不限
+}
+
+// 内存上限, 0为不限. 原子操作
+var memoryLimit int64
+
+// 设置内存上限, 只应在节点启动前调用
+// 事件缓冲最多占1/8, 去重缓存最多占1/4, 其余给节点记录.
+func setMemoryLimit(limit int64) {
+	if limit < 0 {
+		limit = 0
+	}
+	atomic.StoreInt64(&memoryLimit, limit)
+}
+
+// 按内存上限限制去重缓存数量, size不大于0时为默认值
+func limitSeenCacheSize(size int) int {
+	if size <= 0 {
+		size = DEFAULT_SEEN_CACHE_SIZE
+	}
+	limit := atomic.LoadInt64(&memoryLimit)
+	if limit == 0 {
+		return size
+	}
+	max := int(limit / 4 / SEEN_ENTRY_BYTES)
+	if max < MIN_SEEN_CACHE_SIZE {
+		max = MIN_SEEN_CACHE_SIZE
+	}
+	if size > max {
+		return max
+	}
+	return size
+}
+
+// 按内存上限限制事件缓冲数量, size不大于0时为默认值
+func limitEventBufferSize(size int) int {
+	if size <= 0 {
+		size = EVENT_BUFFER_SIZE
+	}
+	limit := atomic.LoadInt64(&memoryLimit)
+	if limit == 0 {
+		return size
+	}
+	max := int(limit / 8 / EVENT_ENTRY_BYTES)
+	if max < MIN_EVENT_BUFFER_SIZE {
+		max = MIN_EVENT_BUFFER_SIZE
+	}
+	if size > max {
+		return max
+	}
+	return size
+}
+
+// 节点记录的内存预算, 0为不限
+func peerMemoryBudget() int64 {
+	limit := atomic.LoadInt64(&memoryLimit)
+	if limit == 0 {
+		return 0
+	}
+	return limit - int64(seenMessages.size)*SEEN_ENTRY_BYTES - int64(cap(eventChan))*EVENT_ENTRY_BYTES
+}
+
+// 每个节点记录占用的内存
+func peerMemory() map[peer.ID]int64 {
+	usage := make(map[peer.ID]int64)
+	sm.RLock()
+	for id, addr := range peerMap {
+		if pid, e := peer.Decode(id); e == nil {
+			usage[pid] += int64(len(id)+len(addr)) + PEER_ENTRY_BYTES
+		}
+	}
+	for id, relays := range relayMap {
+		if pid, e := peer.Decode(id); e == nil {
+			for _, addr := range relays {
+				usage[pid] += int64(len(addr))
+			}
+		}
+	}
+	sm.RUnlock()
+	knownLock.Lock()
+	for id := range knownPeers {
+		usage[id] += PEER_ENTRY_BYTES
+	}
+	knownLock.Unlock()
+	scoreLock.RLock()
+	for id := range scoreMap {
+		usage[id] += PEER_ENTRY_BYTES
+	}
+	scoreLock.RUnlock()
+	return usage
+}
+
+// 节点记录超过预算时移除价值最低的节点: 未连接且不受保护的节点中分数最低的先移除
+// 从节点缓存, 已知节点, 分数和拨号熔断中一起移除. 不能持有sm时调用.
+func trimPeers() {
+	budget := peerMemoryBudget()
+	if budget <= 0 || node == nil {
+		return
+	}
+	usage := peerMemory()
+	var total int64
+	for _, n := range usage {
+		total += n
+	}
+	if total <= budget {
+		return
+	}
+
+	candidates := make([]peer.ID, 0, len(usage))
+	scores := make(map[peer.ID]float64)
+	for id := range usage {
+		if id == node.ID() || IsConnected(id) || IsProtected(id) {
+			continue
+		}
+		candidates = append(candidates, id)
+		scores[id] = PeerScore(id)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if scores[candidates[i]] != scores[candidates[j]] {
+			return scores[candidates[i]] < scores[candidates[j]]
+		}
+		return candidates[i] < candidates[j]
+	})
+
+	var evicted []peer.ID
+	for _, id := range candidates {
+		if total <= budget {
+			break
+		}
+		total -= usage[id]
+		evicted = append(evicted, id)
+	}
+	if len(evicted) == 0 {
+		return
+	}
+
+	sm.Lock()
+	for _, id := range evicted {
+		delete(peerMap, id.String())
+		delete(relayMap, id.String())
+	}
+	sm.Unlock()
+	knownLock.Lock()
+	for _, id := range evicted {
+		delete(knownPeers, id)
+	}
+	knownLock.Unlock()
+	scoreLock.Lock()
+	for _, id := range evicted {
+		delete(scoreMap, id)
+	}
+	scoreLock.Unlock()
+	breakerLock.Lock()
+	for _, id := range evicted {
+		delete(breakers, id)
+	}
+	breakerLock.Unlock()
+	atomic.StoreInt32(&responseCache.dirty, 1)
+	logMsg("memory.peers_evicted", len(evicted), total)
+}
+
+// 获取mp2p记录占用的内存(估计值)
+func GetMemoryUsage() MemoryUsage {
+	usage := MemoryUsage{
+		Seen:   int64(seenMessages.len()) * SEEN_ENTRY_BYTES,
+		Events: int64(cap(eventChan)) * EVENT_ENTRY_BYTES,
+		Limit:  atomic.LoadInt64(&memoryLimit),
+	}
+	for _, n := range peerMemory() {
+		usage.Peers += n
+	}
+	usage.Total = usage.Peers + usage.Seen + usage.Events
+	return usage
+}
@@ -0,0 +1,63 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/peer"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxMemoryTrimPeers(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	oldSeen, oldEvents := seenMessages, eventChan
+	defer func() {
+		setMemoryLimit(0)
+		seenMessages, eventChan = oldSeen, oldEvents
+		sm.Lock()
+		peerMap = make(map[string]string)
+		sm.Unlock()
+		knownLock.Lock()
+		knownPeers = make(map[peer.ID]*knownPeer)
+		knownLock.Unlock()
+		scoreLock.Lock()
+		scoreMap = make(map[peer.ID]*peerScore)
+		scoreLock.Unlock()
+	}()
+
+	setMemoryLimit(MIN_MEMORY_BYTES)
+	seenMessages = newSeenCache(limitSeenCacheSize(0), 0)
+	setEventBuffer(limitEventBufferSize(0), "")
+	if seenMessages.size >= DEFAULT_SEEN_CACHE_SIZE || cap(eventChan) >= EVENT_BUFFER_SIZE {
+		t.Fatal("应按内存上限减少缓存数量:", seenMessages.size, cap(eventChan))
+	}
+
+	//分数高的和受保护的节点应保留
+	var ids []peer.ID
+	sm.Lock()
+	for i := 0; i < 300; i++ {
+		id := randomPeerID(t)
+		ids = append(ids, id)
+		peerMap[id.String()] = strings.Join([]string{"/ip4/1.2.3.4/udp/4001/quic/ipfs/", id.String()}, "")
+	}
+	sm.Unlock()
+	good, protected := ids[0], ids[1]
+	recordConnect(good, true, time.Millisecond)
+	recordConnect(protected, false, 0)
+	Protect(protected, "test")
+	defer Unprotect(protected, "test")
+
+	invalidateBootstrapCache()
+	usage := GetMemoryUsage()
+	if usage.Peers > peerMemoryBudget() || usage.Total > MIN_MEMORY_BYTES || usage.Limit != MIN_MEMORY_BYTES {
+		t.Fatal("内存用量超过上限:", usage)
+	}
+	sm.RLock()
+	_, goodExists := peerMap[good.String()]
+	_, protectedExists := peerMap[protected.String()]
+	remaining := len(peerMap)
+	sm.RUnlock()
+	if !goodExists || !protectedExists || remaining == len(ids) {
+		t.Fatal("应移除分数低的节点:", goodExists, protectedExists, remaining)
+	}
+}
@@ -0,0 +1,173 @@
+package mp2p
+
+import (
+	"os"
+	"strings"
+)
+
+const (
+	LANGUAGE_EN = "en"
+	LANGUAGE_ZH = "zh"
+)
+
+// 日志消息
+// 键为稳定的英文ID, 日志中总是带有键, 便于日志工具解析. 新增日志时在这里添加英文和中文.
+var messages = map[string]map[string]string{
+	"conn.opened":                 {LANGUAGE_EN: "connection opened (peer, direction, transport, security, muxer):", LANGUAGE_ZH: "连接已建立(节点, 方向, 传输, 安全协议, 多路复用):"},
+	"gater.ip_limit":              {LANGUAGE_EN: "connections from IP reached limit, rejecting:", LANGUAGE_ZH: "IP连接数量已达上限, 拒绝连接:"},
+	"ipfs.addrs_invalid":          {LANGUAGE_EN: "invalid IPFS bootstrap addresses:", LANGUAGE_ZH: "IPFS启发节点地址错误:"},
+	"ipfs.connect_failed":         {LANGUAGE_EN: "failed to connect IPFS bootstrap peer:", LANGUAGE_ZH: "连接IPFS启发节点出错:"},
+	"ipfs.connected":              {LANGUAGE_EN: "connected IPFS bootstrap peer:", LANGUAGE_ZH: "已连IPFS启发节点:"},
+	"ipfs.connected_count":        {LANGUAGE_EN: "connected IPFS bootstrap peers:", LANGUAGE_ZH: "已连IPFS启发节点数量:"},
+	"key.dir":                     {LANGUAGE_EN: "key directory:", LANGUAGE_ZH: "密钥文件夹路径:"},
+	"key.dir_invalid":             {LANGUAGE_EN: "invalid key directory:", LANGUAGE_ZH: "密钥目录错误:"},
+	"key.mkdir_failed":            {LANGUAGE_EN: "failed to create key directory:", LANGUAGE_ZH: "创建密钥文件夹出错:"},
+	"key.read_private_failed":     {LANGUAGE_EN: "failed to read private key:", LANGUAGE_ZH: "读取私钥出错:"},
+	"key.write_private_failed":    {LANGUAGE_EN: "failed to store private key:", LANGUAGE_ZH: "存储私钥出错:"},
+	"key.public_mismatch":         {LANGUAGE_EN: "public key file does not match the private key, using the derived public key:", LANGUAGE_ZH: "公钥文件与私钥不一致, 使用私钥推导的公钥:"},
+	"key.generate_failed":         {LANGUAGE_EN: "failed to generate key:", LANGUAGE_ZH: "生成密钥出错:"},
+	"key.rotated":                 {LANGUAGE_EN: "key rotated, old and new peer ID:", LANGUAGE_ZH: "已更换密钥, 旧和新节点ID:"},
+	"bootstrap.stream_opened":     {LANGUAGE_EN: "bootstrap stream opened:", LANGUAGE_ZH: "流处:"},
+	"bootstrap.stream_opened_v2":  {LANGUAGE_EN: "bootstrap stream (2.0.0) opened:", LANGUAGE_ZH: "流处(2.0.0):"},
+	"bootstrap.connected_count":   {LANGUAGE_EN: "bootstrap peers connected (connected, total):", LANGUAGE_ZH: "已引导的启发节点(成功, 总数):"},
+	"bootstrap.read_failed":       {LANGUAGE_EN: "failed to read bootstrap request:", LANGUAGE_ZH: "读取引导请求出错:"},
+	"bootstrap.request_received":  {LANGUAGE_EN: "bootstrap request received:", LANGUAGE_ZH: "流处收到数据:"},
+	"bootstrap.addrs_received":    {LANGUAGE_EN: "bootstrap addresses received:", LANGUAGE_ZH: "流处收到地址:"},
+	"bootstrap.request_invalid":   {LANGUAGE_EN: "invalid bootstrap request:", LANGUAGE_ZH: "引导请求格式错误:"},
+	"bootstrap.encode_failed":     {LANGUAGE_EN: "failed to encode bootstrap response:", LANGUAGE_ZH: "引导回复编码出错:"},
+	"bootstrap.write_failed":      {LANGUAGE_EN: "failed to write bootstrap response:", LANGUAGE_ZH: "发送引导回复出错:"},
+	"bootstrap.rejected":          {LANGUAGE_EN: "bootstrap request rejected by interceptor:", LANGUAGE_ZH: "引导请求被拦截:"},
+	"bootstrap.stream_done":       {LANGUAGE_EN: "bootstrap stream done", LANGUAGE_ZH: "流处完毕"},
+	"bootstrap.connected":         {LANGUAGE_EN: "connected bootstrap peer", LANGUAGE_ZH: "已连启发节点"},
+	"bootstrap.reset_failed":      {LANGUAGE_EN: "failed to reset bootstrap stream:", LANGUAGE_ZH: "关闭启发流出错:"},
+	"bootstrap.stream_retry":      {LANGUAGE_EN: "failed to open bootstrap stream, retrying (peer, attempt, error):", LANGUAGE_ZH: "打开引导流出错, 重试(节点, 次数, 错误):"},
+	"bootstrap.protocol":          {LANGUAGE_EN: "bootstrap protocol:", LANGUAGE_ZH: "引导协议:"},
+	"bootstrap.response_received": {LANGUAGE_EN: "bootstrap response received:", LANGUAGE_ZH: "启发收到数据:"},
+	"bootstrap.failed":            {LANGUAGE_EN: "bootstrap failed:", LANGUAGE_ZH: "引导出错:"},
+	"peers.too_many":              {LANGUAGE_EN: "too many peer addresses, limit and received:", LANGUAGE_ZH: "节点地址过多, 上限和收到数量:"},
+	"peers.addr_invalid":          {LANGUAGE_EN: "invalid peer address:", LANGUAGE_ZH: "节点地址错误:"},
+	"peers.connect_failed":        {LANGUAGE_EN: "failed to connect peer:", LANGUAGE_ZH: "连接节点出错:"},
+	"peers.connected":             {LANGUAGE_EN: "connected peer:", LANGUAGE_ZH: "已连节点:"},
+	"peers.unreachable":           {LANGUAGE_EN: "known peer unreachable, all dial attempts failed:", LANGUAGE_ZH: "已知节点无法连接, 所有地址拨号失败:"},
+	"node.starting":               {LANGUAGE_EN: "starting node:", LANGUAGE_ZH: "启动节点:"},
+	"node.config_invalid":         {LANGUAGE_EN: "invalid configuration:", LANGUAGE_ZH: "配置错误:"},
+	"node.bootstrap_addrs_failed": {LANGUAGE_EN: "failed to read bootstrap addresses:", LANGUAGE_ZH: "读取启发节点地址出错:"},
+	"node.listen_addrs_failed":    {LANGUAGE_EN: "invalid listen addresses:", LANGUAGE_ZH: "监听地址错误:"},
+	"node.log_failed":             {LANGUAGE_EN: "failed to open log output:", LANGUAGE_ZH: "打开日志输出出错:"},
+	"node.key_failed":             {LANGUAGE_EN: "failed to load key:", LANGUAGE_ZH: "读取密钥出错:"},
+	"node.create_failed":          {LANGUAGE_EN: "failed to create node:", LANGUAGE_ZH: "创建节点出错:"},
+	"node.listen_failed":          {LANGUAGE_EN: "failed to listen:", LANGUAGE_ZH: "监听出错:"},
+	"node.addrs_invalid":          {LANGUAGE_EN: "invalid node addresses:", LANGUAGE_ZH: "节点地址错误:"},
+	"listen.port_fallback":        {LANGUAGE_EN: "port in use, falling back to a random port:", LANGUAGE_ZH: "端口被占用, 改用随机端口:"},
+	"relay.connected_direct":      {LANGUAGE_EN: "connected directly:", LANGUAGE_ZH: "已直接连接节点:"},
+	"relay.connected_relay":       {LANGUAGE_EN: "connected via relay:", LANGUAGE_ZH: "已通过中继连接节点:"},
+	"relay.fallback":              {LANGUAGE_EN: "direct dial failed, trying relays:", LANGUAGE_ZH: "直连失败, 尝试通过中继连接:"},
+	"relay.addrs":                 {LANGUAGE_EN: "relay addresses changed:", LANGUAGE_ZH: "中继地址变化:"},
+	"relay.watch_failed":          {LANGUAGE_EN: "failed to watch relay addresses:", LANGUAGE_ZH: "监视中继地址出错:"},
+	"node.addrs":                  {LANGUAGE_EN: "node addresses:", LANGUAGE_ZH: "节点地址:"},
+	"observed.promoted":           {LANGUAGE_EN: "observed address reached threshold, advertising (address, observers):", LANGUAGE_ZH: "观察地址达到阈值, 加入宣告地址(地址, 观察者数量):"},
+	"echo.done":                   {LANGUAGE_EN: "echoed (peer, bytes):", LANGUAGE_ZH: "已回显(节点, 字节数):"},
+	"echo.failed":                 {LANGUAGE_EN: "echo failed:", LANGUAGE_ZH: "回显出错:"},
+	"memory.peers_evicted":        {LANGUAGE_EN: "peer records over memory budget, evicted (count, remaining bytes):", LANGUAGE_ZH: "节点记录超过内存预算, 已移除(数量, 剩余字节):"},
+	"attach.opened":               {LANGUAGE_EN: "attached (peer, protocol):", LANGUAGE_ZH: "已订阅(节点, 协议):"},
+	"attach.ended":                {LANGUAGE_EN: "attachment closed by peer (peer, protocol):", LANGUAGE_ZH: "对方关闭了订阅(节点, 协议):"},
+	"attach.read_failed":          {LANGUAGE_EN: "failed to read attachment (peer, error):", LANGUAGE_ZH: "读取订阅出错(节点, 错误):"},
+	"metrics.start_failed":        {LANGUAGE_EN: "failed to start metrics exporter:", LANGUAGE_ZH: "启动指标导出出错:"},
+	"discovery.paused":            {LANGUAGE_EN: "discovery paused", LANGUAGE_ZH: "已暂停发现节点"},
+	"discovery.resumed":           {LANGUAGE_EN: "discovery resumed", LANGUAGE_ZH: "已恢复发现节点"},
+	"drain.started":               {LANGUAGE_EN: "draining, removed protocol handlers:", LANGUAGE_ZH: "开始排空, 已移除协议处理数量:"},
+	"drain.done":                  {LANGUAGE_EN: "drained, all stream handlers finished", LANGUAGE_ZH: "排空完成, 所有流处理已结束"},
+	"node.signal":                 {LANGUAGE_EN: "signal received, stopping...", LANGUAGE_ZH: "收到信号, 关闭..."},
+	"node.stop_failed":            {LANGUAGE_EN: "failed to stop node:", LANGUAGE_ZH: "关闭节点出错:"},
+	"dht.started":                 {LANGUAGE_EN: "DHT started", LANGUAGE_ZH: "DHT已启动"},
+	"dht.stopped":                 {LANGUAGE_EN: "DHT stopped", LANGUAGE_ZH: "DHT已停止"},
+	"dht.peer":                    {LANGUAGE_EN: "DHT peer:", LANGUAGE_ZH: "DHT节点:"},
+	"dht.peer_found":              {LANGUAGE_EN: "found DHT peer:", LANGUAGE_ZH: "发现节点:"},
+	"dht.peer_lost":               {LANGUAGE_EN: "lost DHT peer:", LANGUAGE_ZH: "失去节点:"},
+	"dht.lan_peer":                {LANGUAGE_EN: "LAN DHT peer:", LANGUAGE_ZH: "局域网DHT节点:"},
+	"identify.push":               {LANGUAGE_EN: "advertised addresses changed, pushing identify", LANGUAGE_ZH: "宣告地址变化, 推送标识"},
+	"nat.addrs":                   {LANGUAGE_EN: "NAT addresses:", LANGUAGE_ZH: "节点NAT地址:"},
+	"nat.gateway_found":           {LANGUAGE_EN: "found NAT gateway:", LANGUAGE_ZH: "发现NAT网关:"},
+	"nat.map_failed":              {LANGUAGE_EN: "NAT gateway failed to map ports:", LANGUAGE_ZH: "NAT网关映射端口出错:"},
+	"nat.no_gateway":              {LANGUAGE_EN: "no usable NAT gateway, not using NAT addresses, bootstrap peers will use observed addresses", LANGUAGE_ZH: "没有可用的NAT网关, 不使用NAT地址, 启发节点将使用其观察到的地址"},
+	"nat.external_ip_retry":       {LANGUAGE_EN: "failed to get NAT external IP, retrying:", LANGUAGE_ZH: "获取NAT公网IP出错, 重试:"},
+	"nat.external_ip":             {LANGUAGE_EN: "NAT external IP:", LANGUAGE_ZH: "NAT公网IP:"},
+	"nat.external_ip_failed":      {LANGUAGE_EN: "failed to get NAT external IP:", LANGUAGE_ZH: "获取NAT公网IP出错:"},
+	"nat.external_ip_changed":     {LANGUAGE_EN: "NAT external IP changed:", LANGUAGE_ZH: "NAT公网IP变化:"},
+	"nat.internal_ip_mismatch":    {LANGUAGE_EN: "NAT gateway interface IP is not the listen IP, not mapping port:", LANGUAGE_ZH: "NAT网关连接的网卡IP不是监听IP, 不映射端口:"},
+	"nat.port_map_failed":         {LANGUAGE_EN: "failed to map NAT port:", LANGUAGE_ZH: "NAT映射端口出错:"},
+	"nat.port_mapped":             {LANGUAGE_EN: "NAT port mapped, gateway, protocol, internal and external port:", LANGUAGE_ZH: "NAT映射端口, 网关, 协议, 内部和外部端口:"},
+	"nat.port_differs":            {LANGUAGE_EN: "NAT external port differs from internal port:", LANGUAGE_ZH: "NAT外部端口与内部端口不同:"},
+	"nat.renew_failed":            {LANGUAGE_EN: "failed to renew NAT port mapping:", LANGUAGE_ZH: "NAT续期端口出错:"},
+	"nat.external_port_changed":   {LANGUAGE_EN: "NAT external port changed:", LANGUAGE_ZH: "NAT外部端口变化:"},
+	"persist.read_failed":         {LANGUAGE_EN: "failed to read peer file:", LANGUAGE_ZH: "读取节点文件出错:"},
+	"persist.invalid":             {LANGUAGE_EN: "invalid peer file:", LANGUAGE_ZH: "节点文件格式错误:"},
+	"persist.expired":             {LANGUAGE_EN: "dropping expired peer:", LANGUAGE_ZH: "丢弃过期节点:"},
+	"persist.reconnecting":        {LANGUAGE_EN: "reconnecting previous peers:", LANGUAGE_ZH: "重连上次的节点:"},
+	"persist.reconnect_failed":    {LANGUAGE_EN: "failed to reconnect peer:", LANGUAGE_ZH: "重连节点出错:"},
+	"persist.reconnected":         {LANGUAGE_EN: "reconnected peer:", LANGUAGE_ZH: "已重连节点:"},
+	"rendezvous.advertise_failed": {LANGUAGE_EN: "failed to advertise rendezvous:", LANGUAGE_ZH: "宣告汇合点出错:"},
+	"rendezvous.advertised":       {LANGUAGE_EN: "rendezvous advertised:", LANGUAGE_ZH: "已宣告汇合点:"},
+	"rendezvous.find_failed":      {LANGUAGE_EN: "failed to find rendezvous peers:", LANGUAGE_ZH: "查找汇合点节点出错:"},
+	"rendezvous.found":            {LANGUAGE_EN: "found rendezvous peer:", LANGUAGE_ZH: "汇合点发现节点:"},
+	"broadcast.read_failed":       {LANGUAGE_EN: "failed to read broadcast:", LANGUAGE_ZH: "读取广播出错:"},
+	"broadcast.invalid":           {LANGUAGE_EN: "invalid broadcast:", LANGUAGE_ZH: "广播格式错误:"},
+	"broadcast.unverified":        {LANGUAGE_EN: "broadcast signature verification failed, resetting stream:", LANGUAGE_ZH: "广播签名验证失败, 重置流:"},
+	"broadcast.duplicate":         {LANGUAGE_EN: "dropping duplicate broadcast:", LANGUAGE_ZH: "丢弃重复的广播:"},
+	"request.read_failed":         {LANGUAGE_EN: "failed to read request:", LANGUAGE_ZH: "读取请求出错:"},
+	"reconnect.started":           {LANGUAGE_EN: "protected peer disconnected, reconnecting:", LANGUAGE_ZH: "受保护的节点断开, 开始重连:"},
+	"reconnect.failed":            {LANGUAGE_EN: "reconnect failed:", LANGUAGE_ZH: "重连失败:"},
+	"reconnect.succeeded":         {LANGUAGE_EN: "reconnected:", LANGUAGE_ZH: "重连成功:"},
+	"reconnect.cancelled":         {LANGUAGE_EN: "peer no longer protected, stop reconnecting:", LANGUAGE_ZH: "节点已取消保护, 停止重连:"},
+	"breaker.opened":              {LANGUAGE_EN: "peer dials keep failing, suppressing dials (peer, failures, cooldown):", LANGUAGE_ZH: "节点连续拨号失败, 暂停拨号(节点, 失败次数, 冷却时间):"},
+	"breaker.probe":               {LANGUAGE_EN: "cooldown over, probing peer once (peer, failures):", LANGUAGE_ZH: "冷却结束, 试探拨号一次(节点, 失败次数):"},
+	"breaker.closed":              {LANGUAGE_EN: "peer reachable again, dials resumed:", LANGUAGE_ZH: "节点恢复连接, 恢复拨号:"},
+	"request.invalid":             {LANGUAGE_EN: "invalid request:", LANGUAGE_ZH: "请求格式错误:"},
+	"request.unverified":          {LANGUAGE_EN: "request signature verification failed, resetting stream:", LANGUAGE_ZH: "请求签名验证失败, 重置流:"},
+	"request.reply_failed":        {LANGUAGE_EN: "failed to reply to request:", LANGUAGE_ZH: "回复请求出错:"},
+	"request.retry":               {LANGUAGE_EN: "request not acknowledged, retrying:", LANGUAGE_ZH: "请求未确认, 重试:"},
+	"selfdial.reachable":          {LANGUAGE_EN: "reachable from outside, address and prober:", LANGUAGE_ZH: "外部可达, 地址和回拨节点:"},
+	"selfdial.failed":             {LANGUAGE_EN: "dial-back failed:", LANGUAGE_ZH: "回拨失败:"},
+	"streams.limit":               {LANGUAGE_EN: "inbound streams from peer reached limit, resetting stream:", LANGUAGE_ZH: "节点进入流数量已达上限, 重置流:"},
+	"streams.draining":            {LANGUAGE_EN: "node is draining, resetting new stream:", LANGUAGE_ZH: "节点正在排空, 重置新的流:"},
+	"streams.panic":               {LANGUAGE_EN: "stream handler panicked, resetting stream:", LANGUAGE_ZH: "流处理出现异常, 重置流:"},
+	"streams.handler_limit":       {LANGUAGE_EN: "concurrent stream handlers reached limit, resetting stream:", LANGUAGE_ZH: "同时处理的流数量已达上限, 重置流:"},
+	"unix.listening":              {LANGUAGE_EN: "listening on unix socket:", LANGUAGE_ZH: "监听套接字:"},
+	"unix.remove_stale":           {LANGUAGE_EN: "removing stale unix socket:", LANGUAGE_ZH: "删除残留的套接字文件:"},
+}
+
+var language = LANGUAGE_EN
+
+// 设置日志语言, 不支持的语言使用英文
+func setLanguage(lang string) {
+	lang = strings.ToLower(lang)
+	switch lang {
+	case LANGUAGE_ZH:
+		language = LANGUAGE_ZH
+	default:
+		language = LANGUAGE_EN
+	}
+}
+
+// 获取消息文本, 没有该语言时使用英文, 没有该消息时返回键
+func message(key string) string {
+	texts, exists := messages[key]
+	if !exists {
+		return key
+	}
+	if text, exists := texts[language]; exists {
+		return text
+	}
+	return texts[LANGUAGE_EN]
+}
+
+// 记录日志, 格式为 [键] 消息 参数..., 或按Config.LogFormat输出JSON
+func logMsg(key string, args ...interface{}) {
+	writeLog(logLevel(key), key, args)
+}
+
+// 记录日志后退出
+func fatalMsg(key string, args ...interface{}) {
+	writeLog("fatal", key, args)
+	os.Exit(1)
+}
@@ -0,0 +1,29 @@
+package mp2p
+
+import (
+	"testing"
+)
+
+func TestMessagesComplete(t *testing.T) {
+	for key, texts := range messages {
+		if texts[LANGUAGE_EN] == "" || texts[LANGUAGE_ZH] == "" {
+			t.Fatal("消息缺少翻译:", key)
+		}
+	}
+}
+
+func TestMessageLanguage(t *testing.T) {
+	defer setLanguage("")
+
+	setLanguage(LANGUAGE_ZH)
+	if message("node.starting") != "启动节点:" {
+		t.Fatal("中文消息错误:", message("node.starting"))
+	}
+	setLanguage("fr")
+	if message("node.starting") != "starting node:" {
+		t.Fatal("不支持的语言应使用英文:", message("node.starting"))
+	}
+	if message("no.such.key") != "no.such.key" {
+		t.Fatal("没有该消息时应返回键")
+	}
+}
@@ -0,0 +1,79 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"go.uber.org/multierr"
+)
+
+// 指标导出, 把CollectMetrics的指标导出到监控系统
+// 所有导出共用同一份指标, 只有导出方式不同. 节点启动后调用Start, 关闭时调用Close.
+// OpenTelemetry导出见子模块 otelmetrics, 不使用的程序不依赖OpenTelemetry.
+type MetricsExporter interface {
+	Start() error
+	Close() error
+}
+
+// 节点指标
+type Metrics struct {
+	ConnectedPeers int                 //已连接节点数量
+	KnownPeers     int                 //缓存的节点数量
+	Streams        map[protocol.ID]int //各协议打开的流数量(进入和发出), 还没有协商协议的流不计
+	BytesIn        int64               //接收的总字节数
+	BytesOut       int64               //发送的总字节数
+	RateIn         float64             //接收速率(字节/秒)
+	RateOut        float64             //发送速率(字节/秒)
+	DroppedEvents  uint64              //因缓冲满丢弃的事件数量
+}
+
+// 带宽统计, 所有连接共用
+var bandwidthCounter = metrics.NewBandwidthCounter()
+
+// 收集节点指标, 各指标导出共用
+// 模拟网络(Config.MockNet)中不统计带宽.
+func CollectMetrics() Metrics {
+	m := Metrics{
+		ConnectedPeers: len(node.Network().Peers()),
+		Streams:        make(map[protocol.ID]int),
+		DroppedEvents:  DroppedEvents(),
+	}
+	for _, conn := range node.Network().Conns() {
+		for _, s := range conn.GetStreams() {
+			if s.Protocol() != "" {
+				m.Streams[s.Protocol()]++
+			}
+		}
+	}
+	totals := bandwidthCounter.GetBandwidthTotals()
+	m.BytesIn, m.BytesOut = totals.TotalIn, totals.TotalOut
+	m.RateIn, m.RateOut = totals.RateIn, totals.RateOut
+	sm.RLock()
+	m.KnownPeers = len(peerMap)
+	sm.RUnlock()
+	return m
+}
+
+// 各协议的带宽统计, 键为协商的协议ID, 用于找出流量大的协议
+// 包括libp2p自身的协议(标识, DHT, ping等). 统计每秒更新一次, 模拟网络中为空.
+func ProtocolBandwidth() map[protocol.ID]metrics.Stats {
+	return bandwidthCounter.GetBandwidthByProtocol()
+}
+
+// 启动配置的指标导出, 启动失败的导出记录日志后忽略
+func startMetricsExporters() {
+	for _, exporter := range config.MetricsExporters {
+		e := exporter.Start()
+		if e != nil {
+			logMsg("metrics.start_failed", e)
+		}
+	}
+}
+
+// 关闭配置的指标导出, 返回所有错误的组合
+func closeMetricsExporters() error {
+	var err error
+	for _, exporter := range config.MetricsExporters {
+		err = multierr.Append(err, exporter.Close())
+	}
+	return err
+}
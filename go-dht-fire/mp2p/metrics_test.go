@@ -0,0 +1,54 @@
+package mp2p
+
+import (
+	"bytes"
+	"context"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"testing"
+	"time"
+)
+
+func TestProtocolBandwidth(t *testing.T) {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	bandwidthCounter = metrics.NewBandwidthCounter()
+	var e error
+	node, e = libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), libp2p.BandwidthReporter(bandwidthCounter))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node.Close()
+
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer remote.Close()
+	remote.SetStreamHandler(PROTOCOL_ECHO, handleEchoStream)
+	node.Peerstore().AddAddrs(remote.ID(), remote.Addrs(), peerstore.TempAddrTTL)
+
+	payload := bytes.Repeat([]byte("a"), 4096)
+	echoed, e := Echo(ctx, remote.ID(), payload)
+	if e != nil || !bytes.Equal(echoed, payload) {
+		t.Fatal("回显失败:", e)
+	}
+
+	//统计每秒更新一次
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		stats := ProtocolBandwidth()[PROTOCOL_ECHO]
+		if stats.TotalOut >= int64(len(payload)) && stats.TotalIn >= int64(len(payload)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("应统计回显协议的带宽:", stats)
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	if _, exists := ProtocolBandwidth()[PROTOCOL_BOOTSTRAP_V2]; exists {
+		t.Fatal("没有使用的协议不应有统计")
+	}
+}
@@ -0,0 +1,32 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	routedhost "github.com/libp2p/go-libp2p/p2p/host/routed"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// 在模拟网络中创建节点, 不使用系统网络(套接字, 端口, NAT)
+// 地址只用于宣告, 模拟网络中的节点之间必须先链接(LinkMockHosts)才能连接. 启用DHT时节点同样运行DHT.
+func newMockHost(mn mocknet.Mocknet, prKey crypto.PrivKey, addr string) (host.Host, error) {
+	ma, e := multiaddr.NewMultiaddr(addr)
+	if e != nil {
+		return nil, e
+	}
+	h, e := mn.AddPeer(prKey, ma)
+	if e != nil {
+		return nil, e
+	}
+	basicHost = h
+	if !config.EnableDHT {
+		return h, nil
+	}
+	return routedhost.Wrap(h, dhtRouting{}), nil
+}
+
+// 链接模拟网络中的所有节点, 之后节点之间可以互相连接
+func LinkMockHosts(mn mocknet.Mocknet) error {
+	return mn.LinkAll()
+}
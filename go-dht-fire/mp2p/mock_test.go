@@ -0,0 +1,99 @@
+package mp2p
+
+import (
+	"bytes"
+	"context"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"strings"
+	"testing"
+)
+
+func TestMockNetBootstrap(t *testing.T) {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	prKey, e := generateKey(crypto.Ed25519)
+	if e != nil {
+		t.Fatal(e)
+	}
+	node, e = newMockHost(mn, prKey, "/ip4/127.0.0.1/tcp/4001")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node.Close()
+
+	bootstrapHost, e := mn.GenPeer()
+	if e != nil {
+		t.Fatal(e)
+	}
+	other, e := mn.GenPeer()
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = LinkMockHosts(mn)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	//启发节点回复另一个节点
+	otherAddr := strings.Join([]string{other.Addrs()[0].String(), "/p2p/", other.ID().String()}, "")
+	bootstrapHost.SetStreamHandler(PROTOCOL_BOOTSTRAP_V2, func(s network.Stream) {
+		defer s.Close()
+		_, _ = readTextFormStream(s)
+		_ = writeJSONToStream(s, BootstrapResponse{Peers: []string{otherAddr}})
+	})
+
+	bootstrapAddr := strings.Join([]string{bootstrapHost.Addrs()[0].String(), "/p2p/", bootstrapHost.ID().String()}, "")
+	e = bootstrap(bootstrapAddr)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !IsConnected(bootstrapHost.ID()) || !IsConnected(other.ID()) {
+		t.Fatal("应该通过模拟网络连接启发节点和回复的节点")
+	}
+}
+
+func TestMockNetEcho(t *testing.T) {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	prKey, e := generateKey(crypto.Ed25519)
+	if e != nil {
+		t.Fatal(e)
+	}
+	node, e = newMockHost(mn, prKey, "/ip4/127.0.0.1/tcp/4001")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer node.Close()
+	other, e := mn.GenPeer()
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = LinkMockHosts(mn)
+	if e != nil {
+		t.Fatal(e)
+	}
+	other.SetStreamHandler(PROTOCOL_ECHO, handleEchoStream)
+	e = node.Connect(ctx, peer.AddrInfo{ID: other.ID(), Addrs: other.Addrs()})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	//包含换行的数据也应原样返回
+	payload := bytes.Repeat([]byte("mp2p\n"), 1000)
+	data, e := Echo(ctx, other.ID(), payload)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !bytes.Equal(data, payload) {
+		t.Fatal("回显数据错误:", len(data))
+	}
+}
@@ -3,27 +3,34 @@ package mp2p
 import (
 	"bufio"
 	"context"
-	"crypto/rand"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/libp2p/go-libp2p"
 	autonat "github.com/libp2p/go-libp2p-autonat-svc"
 	connmgr "github.com/libp2p/go-libp2p-connmgr"
 	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/metrics"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
 	"github.com/libp2p/go-libp2p-core/routing"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p-kad-dht/dual"
+	kbucket "github.com/libp2p/go-libp2p-kbucket"
 	libp2pquic "github.com/libp2p/go-libp2p-quic-transport"
 	secio "github.com/libp2p/go-libp2p-secio"
 	libp2ptls "github.com/libp2p/go-libp2p-tls"
-	gonat "github.com/libp2p/go-nat"
 	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multistream"
+	"go.uber.org/multierr"
+	"io"
 	"io/ioutil"
-	"log"
+	mrand "math/rand"
 	"os"
 	"os/signal"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
@@ -31,70 +38,170 @@ import (
 )
 
 const (
-	PROTOCOL_BOOTSTRAP = "/p2p/bootstrap"
+	PROTOCOL_BOOTSTRAP    = "/p2p/bootstrap"        //旧版本引导协议, 同1.0.0
+	PROTOCOL_BOOTSTRAP_V1 = "/mp2p/bootstrap/1.0.0" //请求一行节点地址, 回复JSON数组
+	PROTOCOL_BOOTSTRAP_V2 = "/mp2p/bootstrap/2.0.0" //请求和回复都是一行JSON, 可宣告多个地址
+	REFRESH_INTERVAL      = time.Second * 6
+	REFRESH_JITTER        = 0.2              //刷新间隔随机浮动比例
+	REFRESH_MIN_INTERVAL  = time.Second * 10 //手动刷新路由表的最小间隔
+	MAX_MESSAGE_SIZE      = 1 << 20          //流中单条文本的最大字节数
+	MAX_PEER_ADDRS        = 1000             //引导返回节点地址的最大数量, 超出部分忽略
+	STOP_TIMEOUT          = time.Second * 10
+	LISTEN_TIMEOUT        = time.Second * 10
+
+	DHT_READY_POLL_INTERVAL       = time.Millisecond * 100
+	DEFAULT_BOOTSTRAP_CONCURRENCY = 4 //默认同时引导的启发节点数量
+
+	DEFAULT_BOOTSTRAP_STREAM_RETRIES = 3                      //打开引导流失败时的默认重试次数
+	BOOTSTRAP_STREAM_BACKOFF         = time.Millisecond * 200 //首次重试打开引导流前的等待时间, 之后每次加倍
+)
+
+var (
+	ErrInvalidMultiaddr = errors.New("地址格式错误")
+	ErrNoPeerID         = errors.New("地址中没有节点ID")
+	ErrStopTimeout      = errors.New("关闭节点超时")
+	ErrRefreshLimited   = errors.New("刷新路由表过于频繁")
+	ErrDHTDisabled      = errors.New("没有启用DHT")
+
+	ErrBootstrapAddr    = errors.New("启发节点地址错误")
+	ErrBootstrapConnect = errors.New("连接启发节点出错")
+	ErrBootstrapStream  = errors.New("打开引导流出错")
+	ErrBootstrapWrite   = errors.New("发送引导请求出错")
+	ErrBootstrapRead    = errors.New("读取引导回复出错")
+	ErrBootstrapDecode  = errors.New("引导回复格式错误")
 )
 
+// 版本, 编译时可用 -ldflags "-X github.com/alx696/libp2p/go-dht-fire/mp2p.version=1.2.3" 设置
+var version = "0.1.0"
+
+var config Config
+var bootstrapPeers []string //启发节点P2P地址
 var ctx context.Context
+var cancel context.CancelFunc
 var mDHT *dht.IpfsDHT
+var dualDHT *dual.DHT
 var node host.Host
+var basicHost host.Host //未经路由包装的节点, 用于通知地址变化
 var sm sync.RWMutex
 var peerMap = make(map[string]string)
-var natGateway gonat.NAT
+var relayMap = make(map[string][]string) //节点ID -> 请求引导时提供的中继地址(/p2p-circuit), 与peerMap一起由sm保护
+var natGateway NATGateway
+var listenTransports []transportAddr //各传输的监听地址
 
 // 生成或读取密钥
+// 只存储私钥, 公钥由私钥推导. 旧版本存储的public文件仍可存在, 但不再使用.
+// 没有私钥文件时生成keyType类型的密钥(目录不存在时创建), 已有的密钥不论类型都直接读取. requireExisting为true时不生成, 返回ErrKeyMissing.
 // 注意: Android可用"/sdcard/rsa"定位到存储中rsa文件夹, 但记得在应用权限中申请写外部存储权限.
-func rsaKey(dir string) (prKey crypto.PrivKey, puKey crypto.PubKey) {
-	log.Println("密钥文件夹路径:", dir)
-	privatePath := strings.Join([]string{dir, "private"}, "/")
-	publicPath := strings.Join([]string{dir, "public"}, "/")
+func rsaKey(dir string, keyType int, requireExisting bool) (prKey crypto.PrivKey, puKey crypto.PubKey, err error) {
+	dir, e := cleanKeyDir(dir)
+	if e != nil {
+		logMsg("key.dir_invalid", e)
+		return nil, nil, e
+	}
+	logMsg("key.dir", dir)
+	privatePath := filepath.Join(dir, "private")
+	publicPath := filepath.Join(dir, "public")
 
-	_, e := os.Stat(dir)
+	//按私钥文件判断是否已有密钥, 目录存在但没有私钥(如挂载了空目录)时同样生成
+	privateKeyBytes, e := ioutil.ReadFile(privatePath)
 	if os.IsNotExist(e) {
+		//不生成新身份, 防止挂载错误的目录时节点ID悄悄改变
+		if requireExisting {
+			return nil, nil, fmt.Errorf("%w: %s", ErrKeyMissing, privatePath)
+		}
 		e = os.MkdirAll(dir, 0755)
 		if e != nil {
-			log.Println("创建密钥文件夹出错:", e)
-			return
+			logMsg("key.mkdir_failed", e)
+			return nil, nil, e
 		}
 
 		//生成密钥
-		rr := rand.Reader
-		prKey, puKey, _ = crypto.GenerateKeyPairWithReader(crypto.Ed25519, -1, rr)
-
-		//存储密钥
-		privateKeyBytes, _ := crypto.MarshalPrivateKey(prKey)
-		_ = ioutil.WriteFile(privatePath, privateKeyBytes, 0644)
-		publicKeyBytes, _ := crypto.MarshalPublicKey(puKey)
-		_ = ioutil.WriteFile(publicPath, publicKeyBytes, 0644)
-	} else {
-		//还原密钥
-		privateKeyBytes, _ := ioutil.ReadFile(privatePath)
-		publicKeyBytes, _ := ioutil.ReadFile(publicPath)
-		prKey, _ = crypto.UnmarshalPrivateKey(privateKeyBytes)
-		puKey, _ = crypto.UnmarshalPublicKey(publicKeyBytes)
+		prKey, e = generateKey(keyType)
+		if e != nil {
+			logMsg("key.generate_failed", e)
+			return nil, nil, e
+		}
+		puKey = prKey.GetPublic()
+
+		//存储密钥, 公钥由私钥推导无需存储. 私钥只允许所有者读写
+		//存储失败时返回错误, 否则每次启动都会生成新的节点ID
+		privateKeyBytes, e = crypto.MarshalPrivateKey(prKey)
+		if e != nil {
+			logMsg("key.write_private_failed", e)
+			return nil, nil, e
+		}
+		e = ioutil.WriteFile(privatePath, privateKeyBytes, 0600)
+		if e != nil {
+			logMsg("key.write_private_failed", e)
+			return nil, nil, e
+		}
+		return
+	}
+
+	//还原密钥
+	if e == nil {
+		prKey, e = crypto.UnmarshalPrivateKey(privateKeyBytes)
+	}
+	if e != nil {
+		logMsg("key.read_private_failed", e)
+		return nil, nil, e
+	}
+	puKey = prKey.GetPublic()
+
+	//兼容旧版本的公钥文件, 与私钥不一致时使用私钥推导的公钥
+	publicKeyBytes, e := ioutil.ReadFile(publicPath)
+	if e == nil {
+		oldPuKey, e := crypto.UnmarshalPublicKey(publicKeyBytes)
+		if e == nil && !oldPuKey.Equals(puKey) {
+			logMsg("key.public_mismatch", publicPath)
+		}
 	}
 
 	return
 }
 
 // P2P地址转地址信息
+// 出错时返回nil, 错误可用errors.Is判断是ErrInvalidMultiaddr还是ErrNoPeerID.
 func textToAddrInfo(text string) (*peer.AddrInfo, error) {
-	ai := &peer.AddrInfo{}
-
 	ma, e := multiaddr.NewMultiaddr(text)
 	if e != nil {
-		return ai, e
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMultiaddr, e)
 	}
-	ai, e = peer.AddrInfoFromP2pAddr(ma)
+	ai, e := peer.AddrInfoFromP2pAddr(ma)
 	if e != nil {
-		return ai, e
+		return nil, fmt.Errorf("%w: %v", ErrNoPeerID, e)
 	}
 
 	return ai, nil
 }
 
-//从流中读取文本
+// 按节点分组地址文本, 保持首次出现的顺序
+// 同一节点的多个地址(例如QUIC和TCP)放在一组, 一起连接时libp2p同时尝试, 一个地址不可用不影响连接.
+// 格式错误的地址单独一组.
+func groupAddrTexts(texts []string) [][]string {
+	var groups [][]string
+	index := make(map[peer.ID]int)
+	for _, text := range texts {
+		ai, e := textToAddrInfo(text)
+		if e != nil {
+			groups = append(groups, []string{text})
+			continue
+		}
+		i, exists := index[ai.ID]
+		if !exists {
+			index[ai.ID] = len(groups)
+			groups = append(groups, []string{text})
+			continue
+		}
+		groups[i] = append(groups[i], text)
+	}
+	return groups
+}
+
+// 从流中读取文本
+// 最多读取MAX_MESSAGE_SIZE字节, 超出时返回错误.
 func readTextFormStream(s network.Stream) (string, error) {
-	reader := bufio.NewReader(s)
+	reader := bufio.NewReader(io.LimitReader(s, MAX_MESSAGE_SIZE))
 	text, e := reader.ReadString('\n')
 	if e != nil {
 		return "", e
@@ -103,178 +210,853 @@ func readTextFormStream(s network.Stream) (string, error) {
 	return text, nil
 }
 
+// 从reader中读取一行文本
+// 一个流中有多条消息时整个流使用同一个reader, 每条消息新建reader会丢失已缓冲的后续消息.
+// 每条最多MAX_MESSAGE_SIZE字节, 超出时返回错误.
+func readTextFromReader(reader *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		part, e := reader.ReadSlice('\n')
+		line = append(line, part...)
+		if len(line) > MAX_MESSAGE_SIZE {
+			return "", fmt.Errorf("消息超过%d字节", MAX_MESSAGE_SIZE)
+		}
+		if e == bufio.ErrBufferFull {
+			continue
+		}
+		if e != nil {
+			return "", e
+		}
+		return strings.TrimSuffix(string(line), "\n"), nil
+	}
+}
+
 func handleBootstrapStream(s network.Stream) {
 	peerId := s.Conn().RemotePeer().String()
 	peerMa := s.Conn().RemoteMultiaddr().String()
-	log.Println("流处:", peerId, peerMa)
+	logMsg("bootstrap.stream_opened", peerId, peerMa)
 
 	//读取流
 	text, e := readTextFormStream(s)
 	if e != nil {
-		log.Println(e)
+		logMsg("bootstrap.read_failed", e)
 		return
 	}
-	log.Println("流处收到数据:", text)
+	logMsg("bootstrap.request_received", text)
 
-	//缓存连接节点地址
-	sm.Lock()
+	var addrs []string
 	if text != "" {
-		peerMap[peerId] = text
-	} else {
-		peerMap[peerId] = strings.Join([]string{peerMa, "/ipfs/", peerId}, "")
+		addrs = append(addrs, text)
 	}
-	sm.Unlock()
 
-	//获取现有节点地址
-	var maArray []string
-	sm.RLock()
-	for k, v := range peerMap {
-		if k == peerId {
-			continue
+	//旧版本协议没有Meta, 拦截时Meta为空. 没有拦截时使用缓存的JSON
+	var jsonBytes []byte
+	if config.ResponseInterceptor != nil {
+		req := BootstrapRequest{Addrs: addrs}
+		res := BootstrapResponse{Peers: bootstrapResponseAddrs(s.Conn().RemotePeer())}
+		e = config.ResponseInterceptor(s.Conn().RemotePeer(), &req, &res)
+		if e != nil {
+			logMsg("bootstrap.rejected", peerId, e)
+			_ = s.Reset()
+			return
 		}
-
-		maArray = append(maArray, v)
+		if res.Peers == nil {
+			res.Peers = []string{}
+		}
+		jsonBytes, e = json.Marshal(res.Peers)
+	} else {
+		jsonBytes, e = bootstrapResponseJSON(s.Conn().RemotePeer())
+	}
+	if e != nil {
+		logMsg("bootstrap.encode_failed", e)
+		return
 	}
-	sm.RUnlock()
+
+	//缓存连接节点地址
+	recordBootstrapPeer(s, addrs)
 
 	//返回现有节点地址
-	jsonText := "[]"
-	if len(maArray) > 0 {
-		jsonBytes, e := json.Marshal(maArray)
+	_, e = s.Write(append(append([]byte(nil), jsonBytes...), '\n'))
+	if e != nil {
+		logMsg("bootstrap.write_failed", e)
+		return
+	}
+
+	logMsg("bootstrap.stream_done")
+}
+
+// 引导请求(2.0.0)
+type BootstrapRequest struct {
+	Addrs []string          `json:"addrs"`          //请求节点的P2P地址(QUIC在前), 为空时使用观察到的地址
+	Meta  map[string]string `json:"meta,omitempty"` //应用附加信息, 例如认证令牌, 追踪ID
+}
+
+// 引导回复(2.0.0)
+type BootstrapResponse struct {
+	Peers    []string          `json:"peers"`              //现有节点P2P地址
+	Meta     map[string]string `json:"meta,omitempty"`     //应用附加信息
+	Observed string            `json:"observed,omitempty"` //看到的请求节点地址, 请求节点据此发现自己的外部地址
+}
+
+// 处理引导流(2.0.0)
+func handleBootstrapStreamV2(s network.Stream) {
+	peerId := s.Conn().RemotePeer().String()
+	logMsg("bootstrap.stream_opened_v2", peerId, s.Conn().RemoteMultiaddr().String())
+
+	text, e := readTextFormStream(s)
+	if e != nil {
+		logMsg("bootstrap.read_failed", e)
+		return
+	}
+	var req BootstrapRequest
+	e = json.Unmarshal([]byte(text), &req)
+	if e != nil {
+		logMsg("bootstrap.request_invalid", e)
+		_ = s.Reset()
+		return
+	}
+	logMsg("bootstrap.addrs_received", req.Addrs)
+
+	res := BootstrapResponse{Peers: bootstrapResponseAddrs(s.Conn().RemotePeer()), Observed: s.Conn().RemoteMultiaddr().String()}
+	if config.ResponseInterceptor != nil {
+		e = config.ResponseInterceptor(s.Conn().RemotePeer(), &req, &res)
 		if e != nil {
-			log.Println(e)
+			logMsg("bootstrap.rejected", peerId, e)
+			_ = s.Reset()
 			return
 		}
-		jsonText = string(jsonBytes)
 	}
-	_, e = s.Write([]byte(strings.Join([]string{jsonText, "\n"}, "")))
+
+	recordBootstrapPeer(s, req.Addrs)
+
+	e = writeJSONToStream(s, res)
 	if e != nil {
-		log.Println(e)
+		logMsg("bootstrap.write_failed", e)
 		return
 	}
 
-	log.Println("流处完毕")
+	logMsg("bootstrap.stream_done")
 }
 
-// 引导
-func bootstrap(internalPort int, addrText string) error {
-	//NAT穿越
-	natAddr := ""
-	natChan := gonat.DiscoverNATs(ctx)
-	select {
-	case natGateway = <-natChan:
-		if natGateway == nil {
-			log.Println("没有找到NAT网关!")
-			break
+// 缓存请求引导的节点, 两个版本的协议共用
+// 缓存第一个直连地址, 没有时使用观察到的地址. 中继地址(/p2p-circuit)另外缓存, 回复时跟在直连地址后面,
+// 在NAT后面不能直连的节点也能被其它节点经中继连接. 全部地址加入节点存储.
+func recordBootstrapPeer(s network.Stream, addrs []string) {
+	peerId := s.Conn().RemotePeer()
+	addr := strings.Join([]string{s.Conn().RemoteMultiaddr().String(), "/ipfs/", peerId.String()}, "")
+	var relays []string
+	direct := false
+	for _, v := range addrs {
+		ma, e := multiaddr.NewMultiaddr(v)
+		if e != nil {
+			continue
+		}
+		if isRelayAddr(ma) {
+			relays = append(relays, v)
+		} else if !direct {
+			addr = v
+			direct = true
 		}
-		log.Println("NAT网关类型:", natGateway.Type())
+	}
 
-		//获取公网IP
-		netIp, e := natGateway.GetExternalAddress()
-		if e != nil {
-			log.Fatalln(e)
+	sm.Lock()
+	peerMap[peerId.String()] = addr
+	if len(relays) > 0 {
+		relayMap[peerId.String()] = relays
+	} else {
+		delete(relayMap, peerId.String())
+	}
+	sm.Unlock()
+	invalidateBootstrapCache()
+
+	for _, v := range addrs {
+		ai, e := textToAddrInfo(v)
+		if e != nil || ai.ID != peerId {
+			continue
 		}
-		log.Println("NAT公网IP:", netIp.String())
+		addAddrs(*ai, gossipAddrTTL())
+	}
+}
+
+// 引导出错
+// 可用errors.Is判断出错阶段(ErrBootstrapConnect等), 也可判断原因.
+type BootstrapError struct {
+	Addr  string //启发节点地址, 多个时用逗号分隔
+	Stage error  //出错阶段
+	Err   error  //原因
+}
+
+func (e *BootstrapError) Error() string {
+	return fmt.Sprintf("%v %s: %v", e.Stage, e.Addr, e.Err)
+}
+
+func (e *BootstrapError) Is(target error) bool {
+	return target == e.Stage
+}
+
+func (e *BootstrapError) Unwrap() error {
+	return e.Err
+}
 
-		log.Println("内部端口:", internalPort)
-		//映射端口
-		externalPort, e := natGateway.AddPortMapping("udp", internalPort, "mp2p", time.Second*3)
+// 引导
+// addrTexts为同一启发节点的地址, 在一次连接中同时尝试. 出错时返回*BootstrapError.
+func bootstrap(addrTexts ...string) error {
+	addrText := strings.Join(addrTexts, ",")
+	//节点地址, 旧版本协议只支持一个, 使用QUIC地址
+	natAddr := ""
+	if addrs := advertisedAddrs(); len(addrs) > 0 {
+		natAddr = addrs[0]
+	}
+
+	//转换地址, 合并为一个节点
+	var ai *peer.AddrInfo
+	for _, text := range addrTexts {
+		textAi, e := textToAddrInfo(text)
 		if e != nil {
-			log.Fatalln(e)
+			return &BootstrapError{Addr: addrText, Stage: ErrBootstrapAddr, Err: e}
+		}
+		if ai == nil {
+			ai = textAi
+			continue
 		}
-		log.Println("NAT内部端口:", internalPort, "映射外部端口:", externalPort)
-		natAddr = strings.Join([]string{"/ip4/", netIp.String(), "/udp/", strconv.Itoa(externalPort), "/quic/ipfs/", node.ID().String()}, "")
+		if textAi.ID != ai.ID {
+			return &BootstrapError{Addr: addrText, Stage: ErrBootstrapAddr, Err: fmt.Errorf("%w: %s 不是 %s", ErrNoPeerID, textAi.ID, ai.ID)}
+		}
+		ai.Addrs = append(ai.Addrs, textAi.Addrs...)
+	}
+	if ai == nil {
+		return &BootstrapError{Stage: ErrBootstrapAddr, Err: ErrNoPeerID}
 	}
-	log.Println("节点NAT地址:", natAddr)
 
-	//转换地址
-	ai, e := textToAddrInfo(addrText)
+	//连接节点, 启发节点地址保留较长时间
+	addAddrs(*ai, bootstrapAddrTTL())
+	e := dialNode(ctx, *ai)
 	if e != nil {
-		return e
+		return &BootstrapError{Addr: addrText, Stage: ErrBootstrapConnect, Err: e}
 	}
+	logMsg("bootstrap.connected")
+	//启发节点不被连接管理器断开
+	Protect(ai.ID, PROTECT_TAG_BOOTSTRAP)
 
-	//连接节点
-	e = node.Connect(ctx, *ai)
+	//请给节点, 优先使用新版本协议, 对方不支持时使用旧版本
+	s, e := newBootstrapStream(ai.ID)
 	if e != nil {
-		return e
+		return &BootstrapError{Addr: addrText, Stage: ErrBootstrapStream, Err: e}
 	}
-	log.Println("已连启发节点")
+	//无论成功与否都关闭流, 关闭出错只记录
+	defer func() {
+		if e := s.Reset(); e != nil {
+			logMsg("bootstrap.reset_failed", e)
+		}
+	}()
+	logMsg("bootstrap.protocol", s.Protocol())
 
-	//请给节点
-	s, e := node.NewStream(ctx, ai.ID, PROTOCOL_BOOTSTRAP)
-	if e != nil {
-		return e
+	var maArray []string
+	if s.Protocol() == PROTOCOL_BOOTSTRAP_V2 {
+		req := BootstrapRequest{Addrs: advertisedAddrs()}
+		if config.RequestInterceptor != nil {
+			config.RequestInterceptor(&req)
+		}
+		e = writeJSONToStream(s, req)
+		if e != nil {
+			return &BootstrapError{Addr: addrText, Stage: ErrBootstrapWrite, Err: e}
+		}
+		text, e := readTextFormStream(s)
+		if e != nil {
+			return &BootstrapError{Addr: addrText, Stage: ErrBootstrapRead, Err: e}
+		}
+		logMsg("bootstrap.response_received", text)
+		var res BootstrapResponse
+		e = json.Unmarshal([]byte(text), &res)
+		if e != nil {
+			return &BootstrapError{Addr: addrText, Stage: ErrBootstrapDecode, Err: e}
+		}
+		maArray = res.Peers
+		if res.Observed != "" {
+			recordObservedAddr(s.Conn().RemoteMultiaddr(), res.Observed)
+		}
+	} else {
+		_, e = s.Write([]byte(strings.Join([]string{natAddr, "\n"}, "")))
+		if e != nil {
+			return &BootstrapError{Addr: addrText, Stage: ErrBootstrapWrite, Err: e}
+		}
+		text, e := readTextFormStream(s)
+		if e != nil {
+			return &BootstrapError{Addr: addrText, Stage: ErrBootstrapRead, Err: e}
+		}
+		logMsg("bootstrap.response_received", text)
+		e = json.Unmarshal([]byte(text), &maArray)
+		if e != nil {
+			return &BootstrapError{Addr: addrText, Stage: ErrBootstrapDecode, Err: e}
+		}
 	}
-	_, e = s.Write([]byte(strings.Join([]string{natAddr, "\n"}, "")))
-	if e != nil {
-		return e
+
+	//逐个连接
+	connectPeers(maArray)
+
+	return nil
+}
+
+// 打开引导流的重试次数
+func bootstrapStreamRetries() int {
+	if config.BootstrapStreamRetries < 0 {
+		return 0
 	}
-	text, e := readTextFormStream(s)
-	if e != nil {
-		return e
+	if config.BootstrapStreamRetries > 0 {
+		return config.BootstrapStreamRetries
 	}
-	log.Println("启发收到数据:", text)
-	e = s.Reset()
-	if e != nil {
-		return e
+	return DEFAULT_BOOTSTRAP_STREAM_RETRIES
+}
+
+// 打开引导流, 失败时短暂等待后重试
+// 刚连接成功时连接可能还在升级, 慢速链路上打开流会暂时失败. 对方不支持引导协议时不重试.
+func newBootstrapStream(id peer.ID) (network.Stream, error) {
+	backoff := BOOTSTRAP_STREAM_BACKOFF
+	for attempt := 0; ; attempt++ {
+		s, e := node.NewStream(ctx, id, PROTOCOL_BOOTSTRAP_V2, PROTOCOL_BOOTSTRAP_V1, PROTOCOL_BOOTSTRAP)
+		if e == nil || attempt >= bootstrapStreamRetries() || errors.Is(e, multistream.ErrNotSupported) {
+			return s, e
+		}
+		logMsg("bootstrap.stream_retry", id.String(), attempt+1, e)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-clock.After(backoff):
+		}
+		backoff *= 2
 	}
+}
 
-	//逐个连接
-	var maArray []string
-	e = json.Unmarshal([]byte(text), &maArray)
-	if e != nil {
-		return e
+// 同时引导多个启发节点的数量
+func bootstrapConcurrency() int {
+	if config.BootstrapConcurrency > 0 {
+		return config.BootstrapConcurrency
 	}
-	sm.Lock()
+	return DEFAULT_BOOTSTRAP_CONCURRENCY
+}
+
+// 引导所有启发节点, 同时最多引导bootstrapConcurrency()个, 返回引导成功的节点数量
+// 同一节点的多个地址一起引导. 成功数量达到Config.MinBootstrapPeers(默认1)时立即返回, 其余的在后台继续引导. 全部失败时等待全部结束.
+// 每个启发节点引导完成时发出EVENT_BOOTSTRAP_COMPLETED事件.
+func bootstrapAll(addrs []string) int {
+	groups := groupAddrTexts(addrs)
+	min := config.MinBootstrapPeers
+	if min <= 0 {
+		min = 1
+	}
+	if min > len(groups) {
+		min = len(groups)
+	}
+
+	results := make(chan error, len(groups))
+	sem := make(chan struct{}, bootstrapConcurrency())
+	go func() {
+		for _, group := range groups {
+			sem <- struct{}{}
+			go func(group []string) {
+				defer func() { <-sem }()
+				e := bootstrap(group...)
+				if e != nil {
+					logMsg("bootstrap.failed", e)
+				}
+				ev := Event{Type: EVENT_BOOTSTRAP_COMPLETED, Err: e}
+				if ai, e := textToAddrInfo(group[0]); e == nil {
+					ev.Peer = ai.ID
+				}
+				emit(ev)
+				results <- e
+			}(group)
+		}
+	}()
+
+	connected := 0
+	for i := 0; i < len(groups); i++ {
+		if <-results == nil {
+			connected++
+			if connected >= min {
+				return connected
+			}
+		}
+	}
+	return connected
+}
+
+// 逐个连接节点并缓存, 忽略自己
+// 同一节点的多个地址合并后一起连接, 缓存连接使用的地址.
+func connectPeers(maArray []string) {
+	if len(maArray) > MAX_PEER_ADDRS {
+		logMsg("peers.too_many", MAX_PEER_ADDRS, len(maArray))
+		maArray = maArray[:MAX_PEER_ADDRS]
+	}
+	//分数高的节点优先连接
+	var addrInfos []*peer.AddrInfo
+	addrTexts := make(map[peer.ID][]string)
 	for _, v := range maArray {
 		addrInfo, e := textToAddrInfo(v)
 		if e != nil {
-			log.Println(e)
+			logMsg("peers.addr_invalid", e)
+			continue
+		}
+		if addrInfo.ID == node.ID() {
 			continue
 		}
+		addAddrs(*addrInfo, gossipAddrTTL())
+		if _, exists := addrTexts[addrInfo.ID]; exists {
+			for _, ai := range addrInfos {
+				if ai.ID == addrInfo.ID {
+					ai.Addrs = append(ai.Addrs, addrInfo.Addrs...)
+				}
+			}
+		} else {
+			addrInfos = append(addrInfos, addrInfo)
+		}
+		addrTexts[addrInfo.ID] = append(addrTexts[addrInfo.ID], v)
+	}
+	sortByScore(addrInfos)
 
+	sm.Lock()
+	for _, addrInfo := range addrInfos {
 		//连接节点, 触发DHT路由刷新
-		e = node.Connect(ctx, *addrInfo)
+		e := connect(*addrInfo)
+		if isDialBackoff(e) {
+			continue
+		}
 		if e != nil {
-			log.Println(e)
+			logMsg("peers.connect_failed", e)
 			continue
 		}
-		log.Println("已连节点:", v)
+		v := connectedAddrText(addrInfo.ID, addrTexts[addrInfo.ID])
+		logMsg("peers.connected", v)
 
 		//缓存节点
 		peerMap[addrInfo.ID.String()] = v
 	}
 	sm.Unlock()
+	invalidateBootstrapCache()
+}
+
+// 节点地址中连接使用的地址, 没有匹配的连接时使用第一个
+func connectedAddrText(id peer.ID, texts []string) string {
+	for _, c := range node.Network().ConnsToPeer(id) {
+		for _, text := range texts {
+			ai, e := textToAddrInfo(text)
+			if e == nil && len(ai.Addrs) > 0 && ai.Addrs[0].Equal(c.RemoteMultiaddr()) {
+				return text
+			}
+		}
+	}
+	return texts[0]
+}
+
+// DHT选项, 没有设置的使用libp2p默认值
+func dhtOptions(c Config) []dht.Option {
+	var opts []dht.Option
+	if c.DHTProtocolPrefix != "" {
+		opts = append(opts, dht.ProtocolPrefix(protocol.ID(c.DHTProtocolPrefix)))
+	}
+	if c.DHTBucketSize > 0 {
+		opts = append(opts, dht.BucketSize(c.DHTBucketSize))
+	}
+	if c.DHTConcurrency > 0 {
+		opts = append(opts, dht.Concurrency(c.DHTConcurrency))
+	}
+	if c.DHTResiliency > 0 {
+		opts = append(opts, dht.Resiliency(c.DHTResiliency))
+	}
+	return opts
+}
+
+// 设置节点的路由(DHT在节点创建后启动)
+func newRouting(h host.Host) (routing.PeerRouting, error) {
+	basicHost = h
+	return dhtRouting{}, nil
+}
+
+// 创建DHT, 调用前需锁定dhtLock
+// 双DHT模式时mDHT为互联网DHT, 局域网范围的查询由双DHT路由到局域网DHT.
+func newDHT(ctx context.Context, h host.Host) error {
+	opts := dhtOptions(config)
+	if config.DualDHT {
+		d, e := dual.New(ctx, h, opts...)
+		if e != nil {
+			return e
+		}
+		dualDHT = d
+		mDHT = d.WAN
+		return nil
+	}
+
+	var e error
+	mDHT, e = dht.New(ctx, h, opts...)
+	return e
+}
+
+// 刷新DHT路由表
+func refreshRoutingTable() {
+	wan, lan := currentDHT()
+	if wan == nil {
+		return
+	}
+	wan.RefreshRoutingTable()
+	if lan != nil {
+		lan.LAN.RefreshRoutingTable()
+	}
+}
+
+var refreshLock sync.Mutex
+var lastRefresh time.Time //上次手动刷新路由表的时间
+
+// 立即刷新DHT路由表并等待完成, 用于新连接较多时加快DHT收敛
+// 距上次调用不足REFRESH_MIN_INTERVAL时返回ErrRefreshLimited. 双DHT模式时同时刷新局域网DHT.
+func RefreshRouting(ctx context.Context) error {
+	wan, lan := currentDHT()
+	if wan == nil {
+		return dhtError()
+	}
+	refreshLock.Lock()
+	now := clock.Now()
+	if !lastRefresh.IsZero() && now.Sub(lastRefresh) < REFRESH_MIN_INTERVAL {
+		wait := REFRESH_MIN_INTERVAL - now.Sub(lastRefresh)
+		refreshLock.Unlock()
+		return fmt.Errorf("%w, 请%s后重试", ErrRefreshLimited, wait)
+	}
+	lastRefresh = now
+	refreshLock.Unlock()
 
+	resultChans := []<-chan error{wan.RefreshRoutingTable()}
+	if lan != nil {
+		resultChans = append(resultChans, lan.LAN.RefreshRoutingTable())
+	}
+	for _, resultChan := range resultChans {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-resultChan:
+			if e != nil {
+				return e
+			}
+		}
+	}
 	return nil
 }
 
+// 给间隔加上随机浮动(±REFRESH_JITTER), 避免同时启动的节点同步刷新
+func jitter(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * (1 + REFRESH_JITTER*(2*mrand.Float64()-1)))
+}
+
+// 获取底层libp2p节点
+// 可用于访问节点存储, 事件总线等mp2p没有封装的功能. 注意直接使用会绕过mp2p的记录(节点缓存, 评分, 事件等).
+func Host() host.Host {
+	return node
+}
+
+// 获取版本
+func Version() string {
+	return version
+}
+
+// 获取节点代理
+func userAgent(c Config) string {
+	if c.UserAgent != "" {
+		return c.UserAgent
+	}
+	return strings.Join([]string{"mp2p/", Version()}, "")
+}
+
+// 获取远程节点的代理(标识协议交换), 未知时返回空
+// 可用于区分mp2p节点和其它libp2p节点.
+func PeerAgent(id peer.ID) string {
+	v, e := node.Peerstore().Get(id, "AgentVersion")
+	if e != nil {
+		return ""
+	}
+	agent, _ := v.(string)
+	return agent
+}
+
+// 获取DHT路由表(双DHT模式时为互联网路由表), 没有启用DHT或DHT已停止时为nil
+func RoutingTable() *kbucket.RoutingTable {
+	wan, _ := currentDHT()
+	if wan == nil {
+		return nil
+	}
+	return wan.RoutingTable()
+}
+
+// 获取局域网DHT路由表, 非双DHT模式或DHT已停止时为nil
+func LANRoutingTable() *kbucket.RoutingTable {
+	_, lan := currentDHT()
+	if lan == nil {
+		return nil
+	}
+	return lan.LAN.RoutingTable()
+}
+
+// 等待DHT路由表节点数量达到minPeers, 上下文结束时返回其错误
+// 双DHT模式时任一路由表达到即可. 路由表为空时的DHT查询会直接返回空结果, 查询前可先调用.
+func WaitDHTReady(ctx context.Context, minPeers int) error {
+	for {
+		rt := RoutingTable()
+		if rt == nil {
+			return dhtError()
+		}
+		if rt.Size() >= minPeers {
+			return nil
+		}
+		if lan := LANRoutingTable(); lan != nil && lan.Size() >= minPeers {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-clock.After(DHT_READY_POLL_INTERVAL):
+		}
+	}
+}
+
+// 查询DHT中距离key最近的k个节点(双DHT模式时查询互联网DHT), 用于诊断路由问题
+// k不大于0时返回查询得到的全部节点. 上下文结束时返回已得到的部分节点和上下文错误.
+func ClosestPeers(ctx context.Context, key string, k int) ([]peer.ID, error) {
+	wan, _ := currentDHT()
+	if wan == nil {
+		return nil, dhtError()
+	}
+	peerChan, e := wan.GetClosestPeers(ctx, key)
+	if e != nil {
+		return nil, e
+	}
+
+	var ids []peer.ID
+	for {
+		select {
+		case id, ok := <-peerChan:
+			if !ok {
+				return ids, nil
+			}
+			ids = append(ids, id)
+			if k > 0 && len(ids) >= k {
+				return ids, nil
+			}
+		case <-ctx.Done():
+			return ids, ctx.Err()
+		}
+	}
+}
+
 // 参考 https://github.com/libp2p/go-libp2p-examples/blob/master/libp2p-host/host.go
 func Init(port, bootstrapAddr string) {
-	log.Println("启动节点:", port, bootstrapAddr)
+	c := DefaultConfig()
+	c.Port = port
+	c.BootstrapAddr = bootstrapAddr
+	InitWithConfig(c)
+}
+
+// 使用配置启动节点
+func InitWithConfig(c Config) {
+	config = c
+	if c.Clock != nil {
+		clock = c.Clock
+	}
+	setLanguage(c.Language)
+	if e := setLogOutput(c); e != nil {
+		fatalMsg("node.log_failed", e)
+	}
+	resetDrain()
+	port := c.Port
+	logMsg("node.starting", Version(), port, c.BootstrapAddr)
+
+	e := c.Validate()
+	if e != nil {
+		fatalMsg("node.config_invalid", e)
+	}
+
+	setAnnounceAddrs(c.AnnounceAddrs)
+
+	bootstrapPeers, e = bootstrapAddrs(c)
+	if e != nil {
+		fatalMsg("node.bootstrap_addrs_failed", e)
+	}
 
-	internalPort, e := strconv.Atoi(port)
+	addrs, e := listenAddrs(c)
 	if e != nil {
-		log.Fatalln(e)
+		fatalMsg("node.listen_addrs_failed", e)
+	}
+	if c.PortFallback {
+		addrs = fallbackListenAddrs(addrs)
+	}
+	listenTransports, e = transportListenAddrs(addrs)
+	if e != nil {
+		fatalMsg("node.listen_addrs_failed", e)
 	}
 
 	//生成密钥
-	prKey, _ := rsaKey("./config/rsa")
+	keyType, _ := ParseKeyType(c.KeyType)
+	prKey, _, e := rsaKey(c.KeyDir, keyType, c.RequireExistingKey)
+	if e != nil {
+		fatalMsg("node.key_failed", e)
+	}
+
+	//拨号退避
+	setDialBackoff(c.DialBackoffBase, c.DialBackoffCoef, c.DialBackoffMax)
+	setDialBreaker(c.BreakerFailures, c.BreakerCooldown)
+	setMaxDials(c.MaxDials)
+
+	//协议处理并发
+	setHandlerLimit(c.MaxHandlers, c.HandlerQueueTimeout)
+	setReconnectLimit(c.MaxReconnects)
+
+	//内存上限, 限制事件缓冲和去重缓存的数量
+	setMemoryLimit(c.MaxMemoryBytes)
+
+	//事件缓冲
+	setEventBuffer(limitEventBufferSize(c.EventBufferSize), c.EventDropPolicy)
+
+	//观察地址
+	setObservedAddrThreshold(c.ObservedAddrThreshold)
+
+	//引导回复的节点选择
+	setBootstrapSelection(c.BootstrapSelection, c.BootstrapResponseLimit, c.BootstrapSelectionSeed)
+
+	//转发消息去重
+	seenMessages = newSeenCache(limitSeenCacheSize(c.SeenCacheSize), c.SeenCacheTTL)
 
 	// The context governs the lifetime of the libp2p node.
 	// Cancelling it will stop the the host.
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel = context.WithCancel(context.Background())
 	defer cancel()
 
 	//创建节点
-	node, e = libp2p.New(
-		ctx,
+	bandwidthCounter = metrics.NewBandwidthCounter()
+	opts, e := hostOptions(c, prKey, addrs)
+	if e != nil {
+		fatalMsg("node.listen_failed", e)
+	}
+	if c.MockNet != nil {
+		//模拟网络, 只用于测试
+		node, e = newMockHost(c.MockNet, prKey, addrs[0])
+		if e != nil {
+			fatalMsg("node.create_failed", e)
+		}
+	} else {
+		node, e = libp2p.New(ctx, opts...)
+		if e != nil {
+			fatalMsg("node.create_failed", e)
+		}
+		//没有DHT时节点不经路由包装
+		if !c.EnableDHT {
+			basicHost = node
+		}
+
+		// If you want to help other peers to figure out if they are behind
+		// NATs, you can launch the server-side of AutoNAT too (AutoRelay
+		// already runs the client)
+		_, e = autonat.NewAutoNATService(ctx, node,
+			// Support same non default security and transport options as
+			// original host.
+			libp2p.Security(libp2ptls.ID, libp2ptls.New),
+			libp2p.Security(secio.ID, secio.New),
+			libp2p.Transport(libp2pquic.NewTransport),
+			libp2p.DefaultTransports,
+		)
+	}
+
+	//创建DHT, 后台协程在引导之后启动
+	if c.EnableDHT {
+		_, e = createDHT()
+		if e != nil {
+			fatalMsg("node.create_failed", e)
+		}
+	}
+
+	//等待监听完成后节点地址转为P2P地址
+	nodeAddrs, e := waitListenAddrs(LISTEN_TIMEOUT)
+	if e != nil {
+		fatalMsg("node.listen_failed", e)
+	}
+	listenTransports = boundTransports(listenTransports, node.Network().ListenAddresses())
+	p2pAddrs, e := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: node.ID(), Addrs: filterAnnounceAddrs(nodeAddrs)})
+	if e != nil {
+		fatalMsg("node.addrs_invalid", e)
+	}
+	logMsg("node.addrs", p2pAddrs)
+
+	//网络事件
+	node.Network().Notify(eventNotifiee())
+	go watchRelayAddrs()
+
+	//设置协议处理, 之后注册的处理(请求, 广播, 通道)直接设置到节点
+	installProtocols(node)
+
+	//指标导出
+	startMetricsExporters()
+
+	//NAT穿越, 模拟网络不需要(除非指定了网关)
+	if c.MockNet == nil || c.NATGateway != nil {
+		logMsg("nat.addrs", natMap(listenTransports))
+		signalAddrsChanged()
+		if natGateway != nil {
+			go natRenew()
+		}
+	}
+
+	//连接IPFS公共启发节点
+	if c.UseIPFSBootstrap {
+		logMsg("ipfs.connected_count", connectIPFSBootstrap())
+	}
+
+	//重连上次的节点
+	if c.PeerFile != "" {
+		if c.PeerTTL <= 0 {
+			config.PeerTTL = DEFAULT_PEER_TTL
+		}
+		loadPeers(c.PeerFile, config.PeerTTL)
+		go reconnectPeers()
+	}
+
+	//如果设置了引导节点则连接
+	if len(bootstrapPeers) > 0 {
+		logMsg("bootstrap.connected_count", bootstrapAll(bootstrapPeers), len(bootstrapPeers))
+	}
+
+	//DHT后台协程: 显示DHT节点, 通过汇合点发现节点. 没有启用DHT时只通过引导交换节点
+	if c.EnableDHT {
+		startDHTLoops()
+	}
+
+	// wait for a SIGINT or SIGTERM signal
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	<-ch
+	logMsg("node.signal")
+
+	e = Stop()
+	if e != nil {
+		for _, stopErr := range multierr.Errors(e) {
+			logMsg("node.stop_failed", stopErr)
+		}
+		os.Exit(1)
+	}
+}
+
+// 注册mp2p自己的协议处理, 安装注册表中的所有处理到节点h
+// 不重新创建注册表, 启动前注册(或包装)的处理同样安装.
+func installProtocols(h host.Host) {
+	protocols.Register(PROTOCOL_BOOTSTRAP_V2, handleBootstrapStreamV2)
+	protocols.Register(PROTOCOL_BOOTSTRAP_V1, handleBootstrapStream)
+	protocols.Register(PROTOCOL_BOOTSTRAP, handleBootstrapStream)
+	protocols.Register(PROTOCOL_ECHO, handleEchoStream)
+	protocols.Install(h)
+}
+
+// 创建节点的libp2p选项(不含模拟网络)
+func hostOptions(c Config, prKey crypto.PrivKey, addrs []string) ([]libp2p.Option, error) {
+	opts := []libp2p.Option{
 		libp2p.Identity(prKey), //保持节点ID
-		libp2p.ListenAddrStrings(
-			strings.Join([]string{"/ip4/0.0.0.0/tcp/", port}, ""),          //监听IPv4
-			strings.Join([]string{"/ip4/0.0.0.0/udp/", port, "/quic"}, ""), //监听IPv4
-			//strings.Join([]string{"/ip6/::/udp/", port, "/quic"}, ""),      //监听IPv6
-		),
+		libp2p.UserAgent(userAgent(c)),
+		libp2p.BandwidthReporter(bandwidthCounter),
+		libp2p.ListenAddrStrings(addrs...),
 		// support TLS connections
 		libp2p.Security(libp2ptls.ID, libp2ptls.New),
 		// support secio connections
@@ -290,100 +1072,142 @@ func Init(port, bootstrapAddr string) {
 			300,         // HighWater,
 			time.Minute, // GracePeriod
 		)),
-		// Attempt to open ports using uPNP for NATed hosts.
-		libp2p.NATPortMap(),
+		// 连接过滤
+		libp2p.ConnectionGater(newConnGater(c)),
+	}
+	if c.EnableDHT {
 		// Let this host use the DHT to find other hosts
-		libp2p.Routing(func(h host.Host) (routing.PeerRouting, error) {
-			mDHT, e = dht.New(ctx, h)
-			return mDHT, e
-		}),
+		opts = append(opts, libp2p.Routing(newRouting))
 		// Let this host use relays and advertise itself on relays if
 		// it finds it is behind NAT. Use libp2p.Relay(options...) to
 		// enable active relays and more.
-		libp2p.EnableAutoRelay(),
-	)
-	if e != nil {
-		log.Fatalln(e)
+		//AutoRelay通过路由发现中继节点, 没有DHT时不启用, 仍可经已知的中继连接(ConnectWithFallback)
+		opts = append(opts, libp2p.EnableAutoRelay())
 	}
+	if c.UnixSocketPath != "" {
+		unixAddr, e := unixListenAddr(c.UnixSocketPath)
+		if e != nil {
+			return nil, e
+		}
+		logMsg("unix.listening", unixAddr)
+		opts = append(opts, libp2p.ListenAddrStrings(unixAddr), libp2p.Transport(newUnixTransport))
+	}
+	if c.IdentifyPush || len(c.AnnounceAddrs) > 0 {
+		opts = append(opts, libp2p.AddrsFactory(natAddrsFactory))
+	}
+	if c.Peerstore != nil {
+		opts = append(opts, libp2p.Peerstore(c.Peerstore))
+	}
+	if c.EnableNAT {
+		// Attempt to open ports using uPNP for NATed hosts.
+		opts = append(opts, libp2p.NATPortMap())
+	}
+	return opts, nil
+}
 
-	// If you want to help other peers to figure out if they are behind
-	// NATs, you can launch the server-side of AutoNAT too (AutoRelay
-	// already runs the client)
-	_, e = autonat.NewAutoNATService(ctx, node,
-		// Support same non default security and transport options as
-		// original host.
-		libp2p.Security(libp2ptls.ID, libp2ptls.New),
-		libp2p.Security(secio.ID, secio.New),
-		libp2p.Transport(libp2pquic.NewTransport),
-		libp2p.DefaultTransports,
-	)
+// 定时刷新DHT路由表, 显示路由表节点, 移除失去的节点
+func refreshLoop(ctx context.Context) {
+	for {
+		//暂停发现时不刷新, 刷新会拨号新节点
+		if !DiscoveryPaused() {
+			refreshRoutingTable()
+		}
 
-	//节点地址转为P2P地址
-	p2pAddrs, e := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{node.ID(), node.Addrs()})
-	if e != nil {
-		log.Fatalln(e)
-	}
-	log.Println("节点地址:", p2pAddrs)
+		rt := RoutingTable()
+		if rt == nil {
+			return
+		}
+		routingPeers := rt.ListPeers()
+		for _, peerId := range routingPeers {
+			logMsg("dht.peer", peerId.String())
+		}
+		if lan := LANRoutingTable(); lan != nil {
+			for _, peerId := range lan.ListPeers() {
+				logMsg("dht.lan_peer", peerId.String())
+				routingPeers = append(routingPeers, peerId)
+			}
+		}
 
-	//设置引导流处
-	node.SetStreamHandler(PROTOCOL_BOOTSTRAP, handleBootstrapStream)
+		//发现和失去节点, 失去的节点从缓存中移除
+		found, lost := syncRoutingPeers(routingPeers, IsConnected)
+		for _, peerId := range found {
+			logMsg("dht.peer_found", peerId.String())
+		}
+		if len(lost) > 0 {
+			sm.Lock()
+			for _, peerId := range lost {
+				logMsg("dht.peer_lost", peerId.String())
+				delete(peerMap, peerId.String())
+				delete(relayMap, peerId.String())
+			}
+			sm.Unlock()
+			invalidateBootstrapCache()
+		}
+		//已知节点和分数不经过节点缓存也会增长
+		trimPeers()
 
-	//如果设置了引导节点则连接
-	if bootstrapAddr != "" {
-		e = bootstrap(internalPort, bootstrapAddr)
-		if e != nil {
-			log.Println(e)
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(jitter(REFRESH_INTERVAL)):
+		case <-discoveryResumedChan():
 		}
 	}
+}
 
-	//显示DHT节点
+// 关闭节点, 超时时间STOP_TIMEOUT
+func Stop() error {
+	return StopWithTimeout(STOP_TIMEOUT)
+}
+
+// 关闭节点
+// 停止后台协程, 保存节点, 移除端口映射, 关闭DHT和节点. 某一步出错时继续后面的步骤, 返回所有错误的组合(可用multierr.Errors拆分).
+// 超时则返回ErrStopTimeout, 此时节点可能仍未关闭, 调用方应直接退出进程.
+func StopWithTimeout(d time.Duration) error {
+	done := make(chan error, 1)
 	go func() {
-		for {
-			mDHT.RefreshRoutingTable()
+		var err error
+
+		//停止DHT和后台协程
+		cancel()
+		e := StopDHT()
+		if e != nil {
+			err = multierr.Append(err, e)
+		}
 
-			for _, peerId := range mDHT.RoutingTable().ListPeers() {
-				log.Println("DHT节点:", peerId.String())
+		//保存节点
+		if config.PeerFile != "" {
+			e := savePeers(config.PeerFile, config.PeerTTL)
+			if e != nil {
+				err = multierr.Append(err, fmt.Errorf("保存节点出错: %w", e))
 			}
+		}
 
-			//var idMap = make(map[string]int)
-			//sm.Lock()
-			//for _, peerId := range kadDHT.RoutingTable().ListPeers() {
-			//	idMap[peerId.String()] = 0
-			//
-			//	_, exists := peerMap[peerId.String()]
-			//	if exists {
-			//		continue
-			//	}
-			//
-			//	log.Println("发现节点:", peerId.String())
-			//	peerMap[peerId.String()] = ""
-			//}
-			//for k, _ := range peerMap {
-			//	_, exists := idMap[k]
-			//	if exists {
-			//		continue
-			//	}
-			//
-			//	log.Println("失去节点:", k)
-			//	delete(peerMap, k)
-			//}
-			//log.Println("DHT节点数量:", len(peerMap))
-			//sm.Unlock()
-
-			time.Sleep(time.Second * 6)
+		//移除端口映射
+		err = multierr.Append(err, natUnmap())
+
+		e = node.Close()
+		if e != nil {
+			err = multierr.Append(err, fmt.Errorf("关闭节点出错: %w", e))
 		}
-	}()
 
-	// wait for a SIGINT or SIGTERM signal
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
-	<-ch
-	log.Println("收到信号, 关闭...")
+		//删除套接字文件
+		if config.UnixSocketPath != "" {
+			err = multierr.Append(err, removeUnixSocket(config.UnixSocketPath))
+		}
 
-	//移除端口映射
-	if natGateway != nil {
-		_ = natGateway.DeletePortMapping("udp", internalPort)
-	}
+		//关闭指标导出
+		err = multierr.Append(err, closeMetricsExporters())
 
-	_ = node.Close()
+		//关闭日志文件
+		err = multierr.Append(err, closeLogOutput())
+		done <- err
+	}()
+
+	select {
+	case e := <-done:
+		return e
+	case <-clock.After(d):
+		return ErrStopTimeout
+	}
 }
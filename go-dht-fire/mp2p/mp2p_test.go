@@ -0,0 +1,113 @@
+package mp2p
+
+import (
+	"context"
+	"errors"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTextToAddrInfo(t *testing.T) {
+	ai, e := textToAddrInfo("/ip4/127.0.0.1/udp/60000/quic/ipfs/QmXDunpuNNS93eCEv66UnAzuMBgdENZY7MSE3TuhXNtEjv")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if ai.ID.Pretty() != "QmXDunpuNNS93eCEv66UnAzuMBgdENZY7MSE3TuhXNtEjv" || len(ai.Addrs) != 1 {
+		t.Fatal("地址信息错误:", ai)
+	}
+}
+
+func TestTextToAddrInfoInvalidMultiaddr(t *testing.T) {
+	ai, e := textToAddrInfo("not-a-multiaddr")
+	if !errors.Is(e, ErrInvalidMultiaddr) {
+		t.Fatal("期望ErrInvalidMultiaddr:", e)
+	}
+	if ai != nil {
+		t.Fatal("出错时应返回nil")
+	}
+}
+
+func TestTextToAddrInfoNoPeerID(t *testing.T) {
+	ai, e := textToAddrInfo("/ip4/127.0.0.1/udp/60000/quic")
+	if !errors.Is(e, ErrNoPeerID) {
+		t.Fatal("期望ErrNoPeerID:", e)
+	}
+	if ai != nil {
+		t.Fatal("出错时应返回nil")
+	}
+}
+
+func TestRsaKeyOnlyPrivate(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mp2p")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	prKey, _, e := crypto.GenerateEd25519Key(nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	privateKeyBytes, _ := crypto.MarshalPrivateKey(prKey)
+	e = ioutil.WriteFile(filepath.Join(dir, "private"), privateKeyBytes, 0644)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	loadedPrKey, loadedPuKey, _ := rsaKey(dir, crypto.Ed25519, false)
+	if loadedPrKey == nil || !loadedPrKey.Equals(prKey) {
+		t.Fatal("私钥错误")
+	}
+	if loadedPuKey == nil || !loadedPuKey.Equals(prKey.GetPublic()) {
+		t.Fatal("公钥应由私钥推导")
+	}
+}
+
+func TestRsaKeyGenerateWithoutPublicFile(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mp2p")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	dir = filepath.Join(dir, "rsa")
+
+	prKey, puKey, _ := rsaKey(dir, crypto.Ed25519, false)
+	if prKey == nil || puKey == nil {
+		t.Fatal("生成密钥失败")
+	}
+	if _, e = os.Stat(filepath.Join(dir, "public")); !os.IsNotExist(e) {
+		t.Fatal("不应存储公钥文件")
+	}
+}
+
+// 使用节点的选项创建真实的节点(不是模拟网络), 启用和关闭DHT时都能创建, 路由需要满足AutoRelay
+func TestHostOptions(t *testing.T) {
+	prKey, _, e := crypto.GenerateEd25519Key(nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		basicHost = nil
+	}()
+
+	for _, enableDHT := range []bool{true, false} {
+		basicHost = nil
+		opts, e := hostOptions(Config{EnableDHT: enableDHT}, prKey, []string{"/ip4/127.0.0.1/tcp/0"})
+		if e != nil {
+			t.Fatal(e)
+		}
+		h, e := libp2p.New(context.Background(), opts...)
+		if e != nil {
+			t.Fatal("应能创建节点:", enableDHT, e)
+		}
+		_ = h.Close()
+		//没有DHT时不设置路由
+		if (basicHost != nil) != enableDHT {
+			t.Fatal("路由设置错误:", enableDHT)
+		}
+	}
+}
@@ -0,0 +1,561 @@
+package mp2p
+
+import (
+	"context"
+	"fmt"
+	gonat "github.com/libp2p/go-nat"
+	"github.com/multiformats/go-multiaddr"
+	"go.uber.org/multierr"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	NAT_PROTOCOL_UPNP   = "upnp"
+	NAT_PROTOCOL_NATPMP = "natpmp"
+	NAT_MAPPING_LEASE   = time.Minute //默认端口映射租期, 每半个租期续期一次
+	NAT_MAPPING_DESC    = "mp2p"      //默认端口映射描述, 路由器管理界面中显示
+
+	NAT_EXTERNAL_ADDR_RETRIES = 3               //获取NAT公网IP的尝试次数
+	NAT_EXTERNAL_ADDR_TIMEOUT = time.Second * 5 //每次获取NAT公网IP的超时时间
+	NAT_EXTERNAL_ADDR_BACKOFF = time.Second     //首次重试前的等待时间, 之后每次加倍
+)
+
+// NAT网关, 端口映射使用的接口
+// 默认使用go-nat发现的网关(UPnP或NAT-PMP, gonat.NAT满足该接口). 测试时可通过Config.NATGateway使用假的网关, 不需要真实路由器.
+type NATGateway interface {
+	Type() string                        //网关类型, 例如"UPNP (IG1-IP1)"或"NAT-PMP"
+	GetInternalAddress() (net.IP, error) //本机在网关所在网络中的IP
+	GetExternalAddress() (net.IP, error) //网关的公网IP
+	// 映射端口, 返回外部端口(可能与内部端口不同). 续期时使用相同的参数再次调用
+	AddPortMapping(protocol string, internalPort int, description string, timeout time.Duration) (int, error)
+	DeletePortMapping(protocol string, internalPort int) error
+}
+
+// 发现NAT网关, 设置了Config.NATGateway时只使用该网关
+// discoverCtx结束时停止发现并关闭信道.
+func discoverNATGateways(discoverCtx context.Context) <-chan NATGateway {
+	gateways := make(chan NATGateway, 1)
+	if config.NATGateway != nil {
+		gateways <- config.NATGateway
+		close(gateways)
+		return gateways
+	}
+	go func() {
+		defer close(gateways)
+		for gateway := range gonat.DiscoverNATs(discoverCtx) {
+			select {
+			case gateways <- gateway:
+			case <-discoverCtx.Done():
+				return
+			}
+		}
+	}()
+	return gateways
+}
+
+// 端口映射
+type natMapping struct {
+	Protocol     string //udp或tcp
+	InternalPort int
+	ExternalPort int
+	Description  string
+	Lease        time.Duration
+}
+
+// 端口映射选项, 按协议(tcp或udp)配置
+type NATMappingOptions struct {
+	Description string        //映射描述, 路由器管理界面中显示, 默认NAT_MAPPING_DESC
+	Lease       time.Duration //租期, 默认NAT_MAPPING_LEASE
+}
+
+// 获取协议的端口映射描述和租期
+func natMappingOptions(protocol string) (string, time.Duration) {
+	desc, lease := NAT_MAPPING_DESC, NAT_MAPPING_LEASE
+	if o, exists := config.NATMappings[protocol]; exists {
+		if o.Description != "" {
+			desc = o.Description
+		}
+		if o.Lease > 0 {
+			lease = o.Lease
+		}
+	}
+	return desc, lease
+}
+
+// 续期间隔, 为最短租期的一半, 调用前需锁定natLock
+func natRenewInterval() time.Duration {
+	lease := NAT_MAPPING_LEASE
+	for i, m := range natMappings {
+		if i == 0 || m.Lease < lease {
+			lease = m.Lease
+		}
+	}
+	return lease / 2
+}
+
+var natLock sync.Mutex
+var natDirectAddrs []string       //监听IP为公网IP的地址, 无需映射
+var natTransports []transportAddr //通过NAT映射的传输
+var natMappings []*natMapping     //已映射的端口
+var natExternalIP net.IP          //NAT公网IP
+var natAddrs []string             //节点地址(QUIC在前)
+
+// 获取节点地址(QUIC在前, 中继地址在最后), 经过宣告地址过滤, 可能为空
+// 用于引导请求和状态, NAT映射全部失败时通过中继的地址仍可被其它节点得到.
+func advertisedAddrs() []string {
+	if len(announceAddrs) > 0 {
+		return announceP2pAddrs()
+	}
+	addrs := natAdvertisedAddrs()
+	exists := make(map[string]bool)
+	for _, addr := range addrs {
+		exists[addr] = true
+	}
+	for _, addr := range promotedObservedP2pAddrs() {
+		if !exists[addr] {
+			addrs = append(addrs, addr)
+		}
+	}
+	return append(addrs, filterAnnounceTexts(currentRelayAddrs())...)
+}
+
+// 获取节点的宣告地址(P2P地址), 包括NAT映射地址和中继地址
+// 节点位于NAT后且获得中继预约时, 其它节点可通过中继地址连接.
+func ListenAddrs() []string {
+	return advertisedAddrs()
+}
+
+// 获取NAT穿越得到的节点地址(QUIC在前), 经过宣告地址过滤
+// 节点地址工厂使用, 中继地址已由AutoRelay加入节点地址.
+func natAdvertisedAddrs() []string {
+	natLock.Lock()
+	defer natLock.Unlock()
+	return filterAnnounceTexts(natAddrs)
+}
+
+// NAT穿越, 设置并返回节点地址(QUIC在前)
+// 监听IP为公网IP的传输直接使用监听地址, 其余传输通过NAT网关映射端口, 部分传输映射失败时只返回成功的.
+// 没有NAT网关或映射全部失败时只返回监听IP为公网IP的地址, 可能为空.
+func natMap(transports []transportAddr) []string {
+	var addrs []string
+	var needMap []transportAddr
+	for _, t := range transports {
+		//指定了公网IP时无需NAT穿越
+		if !t.IP.IsUnspecified() && isPublicIP(t.IP) {
+			addrs = append(addrs, t.p2pAddr(t.IP, t.Port))
+			continue
+		}
+		needMap = append(needMap, t)
+	}
+
+	natLock.Lock()
+	natDirectAddrs = addrs
+	natAddrs = addrs
+	natLock.Unlock()
+	if len(needMap) == 0 {
+		return addrs
+	}
+
+	//关闭NAT穿越时使用监听到的公网地址
+	if !config.EnableNAT {
+		//publicAddrs经节点地址工厂读取natAddrs, 不能在锁内调用
+		public := publicAddrs()
+		natLock.Lock()
+		natAddrs = sortQuicFirst(append(addrs, public...))
+		natLock.Unlock()
+		return advertisedAddrs()
+	}
+
+	//逐个尝试发现的网关, 优先协议的网关发现后立即尝试, 其他协议的网关在优先协议失败后再尝试
+	discoverCtx, discoverCancel := context.WithCancel(ctx)
+	defer discoverCancel()
+	var fallbacks []NATGateway
+	for gateway := range discoverNATGateways(discoverCtx) {
+		logMsg("nat.gateway_found", gateway.Type())
+		protocol := natProtocol(gateway)
+		if config.NATProtocol != "" && protocol != config.NATProtocol {
+			if !config.NATProtocolOnly {
+				fallbacks = append(fallbacks, gateway)
+			}
+			continue
+		}
+
+		e := natMapGateway(gateway, needMap)
+		if e != nil {
+			logMsg("nat.map_failed", gateway.Type(), e)
+			continue
+		}
+		return advertisedAddrs()
+	}
+	for _, gateway := range fallbacks {
+		e := natMapGateway(gateway, needMap)
+		if e != nil {
+			logMsg("nat.map_failed", gateway.Type(), e)
+			continue
+		}
+		return advertisedAddrs()
+	}
+
+	logMsg("nat.no_gateway")
+	return addrs
+}
+
+// 获取NAT公网IP, 部分路由器偶尔出错, 超时或出错时重试
+func natExternalAddress(gateway NATGateway) (net.IP, error) {
+	type result struct {
+		ip net.IP
+		e  error
+	}
+
+	backoff := NAT_EXTERNAL_ADDR_BACKOFF
+	var lastErr error
+	for i := 0; i < NAT_EXTERNAL_ADDR_RETRIES; i++ {
+		if i > 0 {
+			logMsg("nat.external_ip_retry", i, lastErr)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-clock.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		//GetExternalAddress不支持上下文, 在协程中执行
+		resultChan := make(chan result, 1)
+		go func() {
+			ip, e := gateway.GetExternalAddress()
+			resultChan <- result{ip, e}
+		}()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case r := <-resultChan:
+			if r.e == nil {
+				return r.ip, nil
+			}
+			lastErr = r.e
+		case <-clock.After(NAT_EXTERNAL_ADDR_TIMEOUT):
+			lastErr = fmt.Errorf("超时(%s)", NAT_EXTERNAL_ADDR_TIMEOUT)
+		}
+	}
+	return nil, fmt.Errorf("获取NAT公网IP失败(尝试%d次): %w", NAT_EXTERNAL_ADDR_RETRIES, lastErr)
+}
+
+// 使用网关映射各传输的端口, 至少一个成功时设置natGateway和节点地址
+func natMapGateway(gateway NATGateway, transports []transportAddr) error {
+	internalIp, e := gateway.GetInternalAddress()
+	if e != nil {
+		return e
+	}
+
+	//获取公网IP
+	netIp, e := natExternalAddress(gateway)
+	if e != nil {
+		return e
+	}
+	logMsg("nat.external_ip", netIp.String())
+
+	var mappedTransports []transportAddr
+	var mappings []*natMapping
+	for _, t := range transports {
+		//指定了监听IP时, 网关必须能够映射到该IP
+		if !t.IP.IsUnspecified() && !internalIp.Equal(t.IP) {
+			logMsg("nat.internal_ip_mismatch", internalIp.String(), t.IP.String())
+			continue
+		}
+
+		//同一协议和端口只映射一次
+		if findMapping(mappings, t) == nil {
+			desc, lease := natMappingOptions(t.Protocol)
+			externalPort, e := gateway.AddPortMapping(t.Protocol, t.Port, desc, lease)
+			if e != nil {
+				logMsg("nat.port_map_failed", t.Protocol, t.Port, e)
+				continue
+			}
+			logMsg("nat.port_mapped", gateway.Type(), t.Protocol, t.Port, externalPort)
+			if externalPort != t.Port {
+				logMsg("nat.port_differs", t.Protocol, t.Port, externalPort)
+			}
+			mappings = append(mappings, &natMapping{
+				Protocol:     t.Protocol,
+				InternalPort: t.Port,
+				ExternalPort: externalPort,
+				Description:  desc,
+				Lease:        lease,
+			})
+		}
+		mappedTransports = append(mappedTransports, t)
+	}
+	if len(mappedTransports) == 0 {
+		return fmt.Errorf("所有端口映射失败")
+	}
+
+	natLock.Lock()
+	oldAddrs := natAddrs
+	natGateway = gateway
+	natExternalIP = netIp
+	natTransports = mappedTransports
+	natMappings = mappings
+	buildNATAddrs()
+	newAddrs := natAddrs
+	for _, natAddr := range natAddrs {
+		ma, e := multiaddr.NewMultiaddr(natAddr)
+		if e == nil {
+			emit(Event{Type: EVENT_NAT_MAPPED, Addr: ma})
+		}
+	}
+	natLock.Unlock()
+	notifyNATChange(oldAddrs, newAddrs)
+	return nil
+}
+
+// 查找传输对应的端口映射, 没有时返回nil
+func findMapping(mappings []*natMapping, t transportAddr) *natMapping {
+	for _, m := range mappings {
+		if m.Protocol == t.Protocol && m.InternalPort == t.Port {
+			return m
+		}
+	}
+	return nil
+}
+
+// 根据公网IP和映射的外部端口生成节点地址, 调用前需锁定natLock
+// 续期失败(外部端口为0)的映射不生成地址.
+func buildNATAddrs() {
+	addrs := append([]string(nil), natDirectAddrs...)
+	for _, t := range natTransports {
+		m := findMapping(natMappings, t)
+		if m == nil || m.ExternalPort == 0 {
+			continue
+		}
+		addrs = append(addrs, t.p2pAddr(natExternalIP, m.ExternalPort))
+	}
+	natAddrs = sortQuicFirst(addrs)
+}
+
+// 定时续期端口映射, 间隔为最短租期的一半
+// 网关返回的外部端口或公网IP变化时重新生成节点地址, 发出事件, 推送标识并重新引导以宣告新地址.
+// 续期失败的映射不再宣告, 之后续期成功时恢复.
+func natRenew() {
+	for {
+		natLock.Lock()
+		interval := natRenewInterval()
+		natLock.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(interval):
+		}
+
+		changed, oldAddrs, newAddrs := natRenewOnce()
+
+		//推送标识并重新引导以宣告新地址
+		if changed {
+			notifyNATChange(oldAddrs, newAddrs)
+			signalAddrsChanged()
+			for _, group := range groupAddrTexts(bootstrapPeers) {
+				e := bootstrap(group...)
+				if e != nil {
+					logMsg("bootstrap.failed", e)
+				}
+			}
+		}
+	}
+}
+
+// 续期一次, 返回节点地址是否变化和变化前后的节点地址
+// 网关请求要经过路由器, 可能很慢, 请求时不锁定natLock, 以免阻塞节点地址(标识协议, 引导回复), 得到结果后再锁定更新.
+func natRenewOnce() (changed bool, oldAddrs []string, newAddrs []string) {
+	natLock.Lock()
+	gateway := natGateway
+	mappings := make([]natMapping, len(natMappings))
+	for i, m := range natMappings {
+		mappings[i] = *m
+	}
+	natLock.Unlock()
+	if gateway == nil {
+		return false, nil, nil
+	}
+
+	//公网IP有超时和重试, 网关没有响应时不会一直阻塞续期
+	netIp, ipErr := natExternalAddress(gateway)
+	if ipErr != nil {
+		logMsg("nat.external_ip_failed", ipErr)
+	}
+	for i := range mappings {
+		m := &mappings[i]
+		externalPort, e := gateway.AddPortMapping(m.Protocol, m.InternalPort, m.Description, m.Lease)
+		if e != nil {
+			logMsg("nat.renew_failed", m.Protocol, m.InternalPort, e)
+			m.ExternalPort = 0
+			continue
+		}
+		m.ExternalPort = externalPort
+	}
+
+	natLock.Lock()
+	defer natLock.Unlock()
+	//续期期间停止了NAT或换了网关(natUnmap, natMap), 结果作废
+	if natGateway != gateway {
+		return false, nil, nil
+	}
+	oldAddrs = natAddrs
+	if ipErr == nil && !netIp.Equal(natExternalIP) {
+		logMsg("nat.external_ip_changed", natExternalIP.String(), netIp.String())
+		natExternalIP = netIp
+		changed = true
+	}
+	for _, renewed := range mappings {
+		for _, m := range natMappings {
+			if m.Protocol != renewed.Protocol || m.InternalPort != renewed.InternalPort || m.ExternalPort == renewed.ExternalPort {
+				continue
+			}
+			if renewed.ExternalPort != 0 {
+				logMsg("nat.external_port_changed", m.Protocol, m.ExternalPort, renewed.ExternalPort)
+			}
+			m.ExternalPort = renewed.ExternalPort
+			changed = true
+		}
+	}
+	if changed {
+		buildNATAddrs()
+		for _, natAddr := range natAddrs {
+			ma, e := multiaddr.NewMultiaddr(natAddr)
+			if e == nil {
+				emit(Event{Type: EVENT_NAT_CHANGED, Addr: ma})
+			}
+		}
+	}
+	return changed, oldAddrs, natAddrs
+}
+
+// 移除端口映射, 之后只宣告无需映射的地址
+// 网关请求不锁定natLock, 进行中的续期结果作废.
+func natUnmap() error {
+	natLock.Lock()
+	gateway := natGateway
+	mappings := natMappings
+	oldAddrs := natAddrs
+	directAddrs := natDirectAddrs
+	if gateway != nil {
+		natGateway = nil
+		natMappings = nil
+		natAddrs = directAddrs
+	}
+	natLock.Unlock()
+	if gateway == nil {
+		return nil
+	}
+
+	var err error
+	for _, m := range mappings {
+		e := gateway.DeletePortMapping(m.Protocol, m.InternalPort)
+		if e != nil {
+			err = multierr.Append(err, fmt.Errorf("移除NAT映射%s端口%d出错: %w", m.Protocol, m.InternalPort, e))
+		}
+	}
+	notifyNATChange(oldAddrs, directAddrs)
+	return err
+}
+
+// 调用Config.OnNATChange, 新增的地址可达, 去掉的地址不可达
+// 不能在natLock内调用, 回调中可能读取节点地址.
+func notifyNATChange(oldAddrs, newAddrs []string) {
+	if config.OnNATChange == nil {
+		return
+	}
+	contains := func(addrs []string, addr string) bool {
+		for _, a := range addrs {
+			if a == addr {
+				return true
+			}
+		}
+		return false
+	}
+	for _, addr := range oldAddrs {
+		if !contains(newAddrs, addr) {
+			if ma, e := multiaddr.NewMultiaddr(addr); e == nil {
+				config.OnNATChange(ma, false)
+			}
+		}
+	}
+	for _, addr := range newAddrs {
+		if !contains(oldAddrs, addr) {
+			if ma, e := multiaddr.NewMultiaddr(addr); e == nil {
+				config.OnNATChange(ma, true)
+			}
+		}
+	}
+}
+
+// 获取网关协议, NAT_PROTOCOL_UPNP或NAT_PROTOCOL_NATPMP
+func natProtocol(gateway NATGateway) string {
+	if gateway.Type() == "NAT-PMP" {
+		return NAT_PROTOCOL_NATPMP
+	}
+	return NAT_PROTOCOL_UPNP
+}
+
+// 获取节点监听到的公网地址(QUIC在前), 没有时返回空
+// 返回空时启发节点会使用其观察到的地址.
+func publicAddrs() []string {
+	var addrs []string
+	for _, ma := range filterAnnounceAddrs(node.Addrs()) {
+		ip := maIP(ma)
+		if ip != nil && isPublicIP(ip) {
+			addrs = append(addrs, strings.Join([]string{ma.String(), "/ipfs/", node.ID().String()}, ""))
+		}
+	}
+	return sortQuicFirst(addrs)
+}
+
+// 地址排序, QUIC在前
+func sortQuicFirst(addrs []string) []string {
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return strings.Contains(addrs[i], "/quic") && !strings.Contains(addrs[j], "/quic")
+	})
+	return addrs
+}
+
+// 私有网段
+var privateNets = parseCIDRs(
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"100.64.0.0/10", //CGNAT
+	"fc00::/7",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, ipNet, e := net.ParseCIDR(cidr)
+		if e != nil {
+			panic(e)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// 是否为私有IP
+func isPrivateIP(ip net.IP) bool {
+	for _, ipNet := range privateNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否为公网IP
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || isPrivateIP(ip) {
+		return false
+	}
+	return ip.IsGlobalUnicast()
+}
@@ -0,0 +1,281 @@
+package mp2p
+
+import (
+	"errors"
+	"fmt"
+	"github.com/multiformats/go-multiaddr"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNotifyNATChange(t *testing.T) {
+	changes := make(map[string]bool)
+	config = Config{OnNATChange: func(addr multiaddr.Multiaddr, reachable bool) {
+		changes[addr.String()] = reachable
+	}}
+	defer func() {
+		config = Config{}
+	}()
+
+	notifyNATChange(
+		[]string{"/ip4/1.2.3.4/udp/4001/quic", "/ip4/1.2.3.4/tcp/4001"},
+		[]string{"/ip4/1.2.3.4/udp/4002/quic", "/ip4/1.2.3.4/tcp/4001"},
+	)
+	if len(changes) != 2 || changes["/ip4/1.2.3.4/udp/4001/quic"] || !changes["/ip4/1.2.3.4/udp/4002/quic"] {
+		t.Fatal("只应通知变化的地址:", changes)
+	}
+}
+
+// 假的NAT网关, 外部端口为内部端口加portOffset
+type fakeNATGateway struct {
+	lock       sync.Mutex
+	externalIP net.IP
+	portOffset int
+	mapFailed  error          //不为nil时映射出错
+	mappings   map[string]int //协议/内部端口 -> 外部端口
+	added      int            //映射(包括续期)次数
+	deleted    int
+	lookups    int           //获取公网IP的次数
+	hang       chan struct{} //不为nil时获取公网IP一直等待, 直到关闭
+}
+
+func newFakeNATGateway() *fakeNATGateway {
+	return &fakeNATGateway{externalIP: net.ParseIP("1.2.3.4"), mappings: make(map[string]int)}
+}
+
+func (g *fakeNATGateway) Type() string {
+	return "NAT-PMP"
+}
+
+func (g *fakeNATGateway) GetInternalAddress() (net.IP, error) {
+	return net.ParseIP("192.168.1.2"), nil
+}
+
+func (g *fakeNATGateway) GetExternalAddress() (net.IP, error) {
+	g.lock.Lock()
+	g.lookups++
+	hang, ip := g.hang, g.externalIP
+	g.lock.Unlock()
+	if hang != nil {
+		<-hang
+	}
+	return ip, nil
+}
+
+func (g *fakeNATGateway) AddPortMapping(protocol string, internalPort int, description string, timeout time.Duration) (int, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.added++
+	if g.mapFailed != nil {
+		return 0, g.mapFailed
+	}
+	g.mappings[fmt.Sprintf("%s/%d", protocol, internalPort)] = internalPort + g.portOffset
+	return internalPort + g.portOffset, nil
+}
+
+func (g *fakeNATGateway) DeletePortMapping(protocol string, internalPort int) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	delete(g.mappings, fmt.Sprintf("%s/%d", protocol, internalPort))
+	g.deleted++
+	return nil
+}
+
+// 等待获取公网IP的次数达到n
+func waitLookups(t *testing.T, g *fakeNATGateway, n int) {
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		g.lock.Lock()
+		lookups := g.lookups
+		g.lock.Unlock()
+		if lookups >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("没有获取公网IP:", lookups)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (g *fakeNATGateway) set(f func()) {
+	g.lock.Lock()
+	f()
+	g.lock.Unlock()
+}
+
+func TestNATFakeGateway(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	fc, restoreClock := useFakeClock()
+	defer restoreClock()
+	gateway := newFakeNATGateway()
+	config = Config{EnableNAT: true, NATGateway: gateway}
+	defer func() {
+		config = Config{}
+		natLock.Lock()
+		natGateway, natMappings, natTransports, natAddrs, natDirectAddrs = nil, nil, nil, nil, nil
+		natLock.Unlock()
+	}()
+
+	quic, _ := multiaddr.NewMultiaddr("/quic")
+	transports := []transportAddr{
+		{Protocol: "tcp", IP: net.IPv4zero, Port: 4001},
+		{Protocol: "udp", IP: net.IPv4zero, Port: 4001, Suffix: quic},
+	}
+	p2p := strings.Join([]string{"/ipfs/", node.ID().String()}, "")
+	expect := func(addrs ...string) {
+		t.Helper()
+		var want []string
+		for _, addr := range addrs {
+			want = append(want, addr+p2p)
+		}
+		if got := natAdvertisedAddrs(); !reflect.DeepEqual(got, want) {
+			t.Fatal("节点地址错误:", got, want)
+		}
+	}
+
+	//映射端口, QUIC在前
+	natMap(transports)
+	expect("/ip4/1.2.3.4/udp/4001/quic", "/ip4/1.2.3.4/tcp/4001")
+	if len(gateway.mappings) != 2 {
+		t.Fatal("应映射两个端口:", gateway.mappings)
+	}
+
+	//续期时外部端口和公网IP变化
+	//测试结束时等待续期协程退出, 之后才能恢复时钟和配置
+	renewDone := make(chan struct{})
+	go func() {
+		natRenew()
+		close(renewDone)
+	}()
+	defer func() {
+		closeNode()
+		<-renewDone
+	}()
+	waitNATRenew := func() {
+		fc.waitForWaiter(NAT_MAPPING_LEASE / 2)
+		fc.Advance(NAT_MAPPING_LEASE / 2)
+		//等待续期完成, 开始下一次等待
+		fc.waitForWaiter(NAT_MAPPING_LEASE / 2)
+	}
+	gateway.set(func() {
+		gateway.portOffset = 1
+		gateway.externalIP = net.ParseIP("5.6.7.8")
+	})
+	waitNATRenew()
+	expect("/ip4/5.6.7.8/udp/4002/quic", "/ip4/5.6.7.8/tcp/4002")
+
+	//续期失败时不再宣告, 恢复后重新宣告
+	gateway.set(func() {
+		gateway.mapFailed = errors.New("路由器拒绝")
+	})
+	waitNATRenew()
+	expect()
+	gateway.set(func() {
+		gateway.mapFailed = nil
+	})
+	waitNATRenew()
+	expect("/ip4/5.6.7.8/udp/4002/quic", "/ip4/5.6.7.8/tcp/4002")
+
+	//停止时移除映射
+	if e := natUnmap(); e != nil || gateway.deleted != 2 {
+		t.Fatal("应移除所有映射:", gateway.deleted, e)
+	}
+}
+
+func TestNATGatewayMapFailed(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	gateway := newFakeNATGateway()
+	gateway.mapFailed = errors.New("路由器拒绝")
+	config = Config{EnableNAT: true, NATGateway: gateway}
+	defer func() {
+		config = Config{}
+		natLock.Lock()
+		natGateway, natMappings, natTransports, natAddrs, natDirectAddrs = nil, nil, nil, nil, nil
+		natLock.Unlock()
+	}()
+
+	addrs := natMap([]transportAddr{{Protocol: "tcp", IP: net.IPv4zero, Port: 4001}})
+	if len(addrs) != 0 || natGateway != nil {
+		t.Fatal("映射全部失败时不应有NAT地址:", addrs)
+	}
+}
+
+func TestNATRenewHungGateway(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	fc, restoreClock := useFakeClock()
+	defer restoreClock()
+	gateway := newFakeNATGateway()
+	config = Config{EnableNAT: true, NATGateway: gateway}
+	defer func() {
+		config = Config{}
+		natLock.Lock()
+		natGateway, natMappings, natTransports, natAddrs, natDirectAddrs = nil, nil, nil, nil, nil
+		natLock.Unlock()
+	}()
+
+	natMap([]transportAddr{{Protocol: "tcp", IP: net.IPv4zero, Port: 4001}})
+	mapped := natAdvertisedAddrs()
+	if len(mapped) != 1 {
+		t.Fatal("应映射端口:", mapped)
+	}
+
+	//续期时网关没有响应
+	hang := make(chan struct{})
+	gateway.set(func() {
+		gateway.hang = hang
+	})
+	//测试结束时等待续期协程退出, 之后才能恢复时钟和配置
+	renewDone := make(chan struct{})
+	go func() {
+		natRenew()
+		close(renewDone)
+	}()
+	defer func() {
+		closeNode()
+		close(hang)
+		<-renewDone
+	}()
+	fc.waitForWaiter(NAT_MAPPING_LEASE / 2)
+	fc.Advance(NAT_MAPPING_LEASE / 2)
+	waitLookups(t, gateway, 2)
+
+	//等待网关时节点地址不被阻塞
+	done := make(chan []string, 1)
+	go func() {
+		done <- natAdvertisedAddrs()
+	}()
+	select {
+	case addrs := <-done:
+		if !reflect.DeepEqual(addrs, mapped) {
+			t.Fatal("节点地址不应变化:", addrs)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("等待网关时获取节点地址被阻塞")
+	}
+
+	//获取公网IP超时重试后放弃, 继续续期端口
+	for i := 0; ; i++ {
+		gateway.lock.Lock()
+		added := gateway.added
+		gateway.lock.Unlock()
+		if added >= 2 {
+			break
+		}
+		if i > 1000 {
+			t.Fatal("获取公网IP超时后应继续续期")
+		}
+		fc.Advance(time.Second)
+		time.Sleep(time.Millisecond * 5)
+	}
+	if addrs := natAdvertisedAddrs(); !reflect.DeepEqual(addrs, mapped) {
+		t.Fatal("公网IP未知时端口续期成功, 节点地址不应变化:", addrs)
+	}
+}
@@ -0,0 +1,138 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
+	"github.com/multiformats/go-multiaddr"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_OBSERVED_ADDR_THRESHOLD = 4                //观察地址默认需要的不同观察者数量, 同libp2p
+	OBSERVED_ADDR_TTL               = time.Minute * 40 //观察记录的保留时间, 同libp2p
+)
+
+// 观察到的自己的地址
+type ObservedAddr struct {
+	Addr      string `json:"addr"`      //其它节点看到的地址(不含节点ID)
+	Observers int    `json:"observers"` //不同观察者(按IP)的数量
+	Promoted  bool   `json:"promoted"`  //观察者数量达到阈值, 已加入宣告地址
+}
+
+// 观察地址记录, 地址 -> 观察者IP -> 最后观察时间
+// 同一IP的多个节点只算一个观察者, 防止单个主机伪造多个节点毒化宣告地址.
+var observedLock sync.Mutex
+var observedAddrs = make(map[string]map[string]time.Time)
+var observedThreshold = DEFAULT_OBSERVED_ADDR_THRESHOLD
+
+// 设置观察地址阈值并清空记录, 不大于0时使用默认值. 只应在节点启动前调用
+// libp2p的标识协议同样使用该阈值(identify.ActivationThresh, 进程内共享).
+func setObservedAddrThreshold(n int) {
+	if n <= 0 {
+		n = DEFAULT_OBSERVED_ADDR_THRESHOLD
+	}
+	identify.ActivationThresh = n
+	observedLock.Lock()
+	observedThreshold = n
+	observedAddrs = make(map[string]map[string]time.Time)
+	observedLock.Unlock()
+}
+
+// 观察者分组, 使用地址的第一部分(IP)
+func observerGroup(observer multiaddr.Multiaddr) string {
+	first, _ := multiaddr.SplitFirst(observer)
+	if first == nil {
+		return ""
+	}
+	return first.String()
+}
+
+// 记录其它节点(地址为observer)看到的自己的地址
+// 忽略传输与监听地址不一致和不宣告(宣告地址过滤)的地址. 观察者数量刚达到阈值时通知节点地址变化.
+func recordObservedAddr(observer multiaddr.Multiaddr, text string) {
+	ma, e := multiaddr.NewMultiaddr(text)
+	if e != nil || !shouldAnnounce(ma) || !identify.HasConsistentTransport(ma, node.Network().ListenAddresses()) {
+		return
+	}
+	group := observerGroup(observer)
+	if group == "" {
+		return
+	}
+
+	now := clock.Now()
+	observedLock.Lock()
+	observers, exists := observedAddrs[ma.String()]
+	if !exists {
+		observers = make(map[string]time.Time)
+		observedAddrs[ma.String()] = observers
+	}
+	before := countObservers(observers, now)
+	observers[group] = now
+	promoted := before < observedThreshold && countObservers(observers, now) >= observedThreshold
+	observedLock.Unlock()
+
+	if promoted {
+		logMsg("observed.promoted", ma, observedThreshold)
+		signalAddrsChanged()
+	}
+}
+
+// 未过期的观察者数量, 同时删除过期的观察者. 需持有observedLock
+func countObservers(observers map[string]time.Time, now time.Time) int {
+	for group, seen := range observers {
+		if now.Sub(seen) > OBSERVED_ADDR_TTL {
+			delete(observers, group)
+		}
+	}
+	return len(observers)
+}
+
+// 观察到的自己的地址和观察者数量, 观察者多的在前
+// 观察者数量达到Config.ObservedAddrThreshold(默认4)的地址才会加入宣告地址, 其余的只是候选.
+func ObservedAddrs() []ObservedAddr {
+	now := clock.Now()
+	observedLock.Lock()
+	result := make([]ObservedAddr, 0, len(observedAddrs))
+	for addr, observers := range observedAddrs {
+		n := countObservers(observers, now)
+		if n == 0 {
+			delete(observedAddrs, addr)
+			continue
+		}
+		result = append(result, ObservedAddr{Addr: addr, Observers: n, Promoted: n >= observedThreshold})
+	}
+	observedLock.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Observers != result[j].Observers {
+			return result[i].Observers > result[j].Observers
+		}
+		return result[i].Addr < result[j].Addr
+	})
+	return result
+}
+
+// 已达到阈值的观察地址
+func promotedObservedAddrs() []multiaddr.Multiaddr {
+	var addrs []multiaddr.Multiaddr
+	for _, o := range ObservedAddrs() {
+		if !o.Promoted {
+			continue
+		}
+		if ma, e := multiaddr.NewMultiaddr(o.Addr); e == nil {
+			addrs = append(addrs, ma)
+		}
+	}
+	return addrs
+}
+
+// 已达到阈值的观察地址(P2P地址)
+func promotedObservedP2pAddrs() []string {
+	var addrs []string
+	for _, ma := range promotedObservedAddrs() {
+		addrs = append(addrs, strings.Join([]string{ma.String(), "/p2p/", node.ID().String()}, ""))
+	}
+	return addrs
+}
@@ -0,0 +1,52 @@
+package mp2p
+
+import (
+	"github.com/multiformats/go-multiaddr"
+	"testing"
+	"time"
+)
+
+func TestObservedAddrThreshold(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	fc, restore := useFakeClock()
+	defer restore()
+	setObservedAddrThreshold(2)
+	defer setObservedAddrThreshold(0)
+
+	observer := func(text string) multiaddr.Multiaddr {
+		ma, _ := multiaddr.NewMultiaddr(text)
+		return ma
+	}
+	const addr = "/ip4/1.2.3.4/tcp/4001"
+
+	//同一IP的多个节点只算一个观察者
+	recordObservedAddr(observer("/ip4/5.6.7.8/tcp/1000"), addr)
+	recordObservedAddr(observer("/ip4/5.6.7.8/tcp/2000"), addr)
+	//传输不一致和不宣告的地址忽略
+	recordObservedAddr(observer("/ip4/5.6.7.9/tcp/1000"), "/ip4/1.2.3.4/udp/4001/quic")
+	recordObservedAddr(observer("/ip4/5.6.7.9/tcp/1000"), "/ip4/127.0.0.1/tcp/4001")
+	observed := ObservedAddrs()
+	if len(observed) != 1 || observed[0].Observers != 1 || observed[0].Promoted {
+		t.Fatal("候选地址错误:", observed)
+	}
+	if len(promotedObservedAddrs()) != 0 {
+		t.Fatal("未达到阈值不应宣告")
+	}
+
+	recordObservedAddr(observer("/ip4/5.6.7.9/tcp/1000"), addr)
+	observed = ObservedAddrs()
+	if len(observed) != 1 || observed[0].Observers != 2 || !observed[0].Promoted {
+		t.Fatal("应达到阈值:", observed)
+	}
+	promoted := promotedObservedAddrs()
+	if len(promoted) != 1 || promoted[0].String() != addr {
+		t.Fatal("宣告地址错误:", promoted)
+	}
+
+	//观察过期后不再宣告
+	fc.Advance(OBSERVED_ADDR_TTL + time.Second)
+	if len(ObservedAddrs()) != 0 {
+		t.Fatal("过期的观察应删除")
+	}
+}
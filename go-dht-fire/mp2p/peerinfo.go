@@ -0,0 +1,99 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/peer"
+	"sort"
+	"time"
+)
+
+// 与节点的连接
+type PeerConn struct {
+	Addr      string `json:"addr"`      //对方地址
+	Direction string `json:"direction"` //方向, Inbound或Outbound
+	ConnInfo
+}
+
+// 节点信息, 合并网络, 节点存储和mp2p记录中关于一个节点的所有数据, 用于诊断
+// 不知道的字段为零值.
+type PeerInfo struct {
+	ID            string     `json:"id"`
+	State         string     `json:"state"`         //节点状态(GetPeerState), unknown, known或connected
+	Connectedness string     `json:"connectedness"` //libp2p的连接状态, 例如Connected, NotConnected, CannotConnect
+	Addrs         []string   `json:"addrs"`         //节点存储中的地址(排序)
+	Conns         []PeerConn `json:"conns"`         //当前连接
+	Protocols     []string   `json:"protocols"`     //支持的协议(标识交换得到, 排序)
+	AgentVersion  string     `json:"agent_version"` //节点代理(PeerAgent)
+	LatencyMs     int64      `json:"latency_ms"`    //ping测量的延迟(毫秒)
+	ConnectMs     int64      `json:"connect_ms"`    //连接耗时EWMA(毫秒)
+	Score         float64    `json:"score"`         //节点分数(PeerScore), 没有连接记录时为0
+	Successes     int        `json:"successes"`     //连接成功次数
+	Failures      int        `json:"failures"`      //连接失败次数
+	FirstSeen     time.Time  `json:"first_seen"`    //第一次发现的时间
+	LastSeen      time.Time  `json:"last_seen"`     //最后发现或连接的时间, 已连接时为当前时间
+	InDHT         bool       `json:"in_dht"`        //是否在DHT路由表中(任一DHT)
+	CachedAddr    string     `json:"cached_addr"`   //引导回复中使用的缓存地址
+	Protected     bool       `json:"protected"`     //是否受保护(Protect)
+	Breaker       string     `json:"breaker"`       //拨号熔断状态, 没有连续失败时为空
+}
+
+// 获取节点信息, 没有节点的记录时除ID和状态外都是零值, 不返回错误
+func GetPeerInfo(id peer.ID) PeerInfo {
+	info := PeerInfo{
+		ID:            id.String(),
+		State:         GetPeerState(id).String(),
+		Connectedness: node.Network().Connectedness(id).String(),
+		AgentVersion:  PeerAgent(id),
+		LatencyMs:     node.Peerstore().LatencyEWMA(id).Milliseconds(),
+		Protected:     IsProtected(id),
+		LastSeen:      peerLastSeen(id),
+	}
+
+	for _, ma := range node.Peerstore().Addrs(id) {
+		info.Addrs = append(info.Addrs, ma.String())
+	}
+	sort.Strings(info.Addrs)
+	for _, c := range node.Network().ConnsToPeer(id) {
+		info.Conns = append(info.Conns, PeerConn{
+			Addr:      c.RemoteMultiaddr().String(),
+			Direction: c.Stat().Direction.String(),
+			ConnInfo:  connInfo(c),
+		})
+	}
+	if protocols, e := node.Peerstore().GetProtocols(id); e == nil && len(protocols) > 0 {
+		info.Protocols = protocols
+		sort.Strings(info.Protocols)
+	}
+
+	scoreLock.RLock()
+	if ps, exists := scoreMap[id]; exists {
+		info.Score = ps.score
+		info.Successes = ps.successes
+		info.Failures = ps.failures
+		info.ConnectMs = ps.latency.Milliseconds()
+	}
+	scoreLock.RUnlock()
+
+	knownLock.Lock()
+	if kp, exists := knownPeers[id]; exists {
+		info.FirstSeen = kp.firstSeen
+	}
+	knownLock.Unlock()
+
+	if rt := RoutingTable(); rt != nil && rt.Find(id) != "" {
+		info.InDHT = true
+	}
+	if rt := LANRoutingTable(); rt != nil && rt.Find(id) != "" {
+		info.InDHT = true
+	}
+
+	sm.RLock()
+	info.CachedAddr = peerMap[id.String()]
+	sm.RUnlock()
+
+	breakerLock.Lock()
+	if b, exists := breakers[id]; exists {
+		info.Breaker = b.state
+	}
+	breakerLock.Unlock()
+	return info
+}
@@ -0,0 +1,47 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"reflect"
+	"testing"
+)
+
+func TestGetPeerInfo(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), libp2p.UserAgent("mp2p-test"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer remote.Close()
+	ai := peer.AddrInfo{ID: remote.ID(), Addrs: remote.Addrs()}
+	addAddrs(ai, gossipAddrTTL())
+	if e = connect(ai); e != nil {
+		t.Fatal(e)
+	}
+	Protect(remote.ID(), "test")
+	defer Unprotect(remote.ID(), "test")
+
+	info := GetPeerInfo(remote.ID())
+	if info.ID != remote.ID().String() || info.State != "connected" || info.Connectedness != "Connected" {
+		t.Fatal("连接状态错误:", info)
+	}
+	if len(info.Addrs) == 0 || len(info.Conns) != 1 || info.Conns[0].Transport != "tcp" || info.Conns[0].Direction != "Outbound" {
+		t.Fatal("地址或连接错误:", info)
+	}
+	if len(info.Protocols) == 0 || info.AgentVersion != "mp2p-test" {
+		t.Fatal("标识信息错误:", info)
+	}
+	if info.Successes != 1 || info.Score <= SCORE_INITIAL || info.FirstSeen.IsZero() || info.LastSeen.IsZero() || !info.Protected {
+		t.Fatal("mp2p记录错误:", info)
+	}
+
+	//未知节点除ID和状态外都是零值
+	id := randomPeerID(t)
+	info = GetPeerInfo(id)
+	if !reflect.DeepEqual(info, PeerInfo{ID: id.String(), State: "unknown", Connectedness: "NotConnected"}) {
+		t.Fatal("未知节点应为零值:", info)
+	}
+}
@@ -0,0 +1,186 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"sync"
+	"time"
+)
+
+// 节点状态
+type PeerState int
+
+const (
+	PEER_STATE_UNKNOWN   PeerState = iota //未知节点
+	PEER_STATE_KNOWN                      //已知节点(DHT, 引导或汇合点发现), 当前未连接
+	PEER_STATE_CONNECTED                  //已连接
+)
+
+func (s PeerState) String() string {
+	switch s {
+	case PEER_STATE_KNOWN:
+		return "known"
+	case PEER_STATE_CONNECTED:
+		return "connected"
+	}
+	return "unknown"
+}
+
+const (
+	DEFAULT_LOST_PEER_CYCLES = 3 //节点连续不在DHT路由表中的刷新次数达到该值时视为失去
+)
+
+// 已知节点
+type knownPeer struct {
+	firstSeen     time.Time
+	lastSeen      time.Time //最后发现或连接的时间
+	everConnected bool      //是否连接成功过
+	failures      int       //连续拨号失败次数
+	unreachable   bool      //已发出无法连接事件
+	inDHT         bool      //是否在DHT路由表中出现过
+	missing       int       //连续不在DHT路由表中的刷新次数
+}
+
+var knownLock sync.Mutex
+var knownPeers = make(map[peer.ID]*knownPeer)
+
+// 记录发现的节点
+func learnPeer(id peer.ID) *knownPeer {
+	knownLock.Lock()
+	defer knownLock.Unlock()
+	kp := learnPeerLocked(id)
+	kp.lastSeen = clock.Now()
+	return kp
+}
+
+func learnPeerLocked(id peer.ID) *knownPeer {
+	kp, exists := knownPeers[id]
+	if !exists {
+		kp = &knownPeer{firstSeen: clock.Now()}
+		knownPeers[id] = kp
+	}
+	return kp
+}
+
+// 记录连接成功
+func markConnected(id peer.ID) {
+	knownLock.Lock()
+	defer knownLock.Unlock()
+	kp := learnPeerLocked(id)
+	kp.lastSeen = clock.Now()
+	kp.everConnected = true
+	kp.failures = 0
+	kp.unreachable = false
+}
+
+// 记录拨号失败(所有地址都失败)
+// 从未连接成功的节点第一次失败时发出EVENT_PEER_UNREACHABLE.
+func markDialFailed(id peer.ID, e error) {
+	knownLock.Lock()
+	kp := learnPeerLocked(id)
+	kp.failures++
+	report := !kp.everConnected && !kp.unreachable
+	if report {
+		kp.unreachable = true
+	}
+	knownLock.Unlock()
+
+	if report {
+		logMsg("peers.unreachable", id.String(), e)
+		emit(Event{Type: EVENT_PEER_UNREACHABLE, Peer: id, Err: e})
+	}
+}
+
+// 失去节点前的刷新次数
+func lostPeerCycles() int {
+	if config.LostPeerCycles > 0 {
+		return config.LostPeerCycles
+	}
+	return DEFAULT_LOST_PEER_CYCLES
+}
+
+// 根据DHT路由表更新已知节点, 返回新发现和失去的节点
+// DHT成员经常波动, 节点连续lostPeerCycles次不在路由表中并且未连接时才视为失去, 从已知节点中移除.
+func syncRoutingPeers(ids []peer.ID, connected func(peer.ID) bool) (found []peer.ID, lost []peer.ID) {
+	knownLock.Lock()
+	defer knownLock.Unlock()
+
+	inTable := make(map[peer.ID]bool)
+	for _, id := range ids {
+		inTable[id] = true
+		kp := learnPeerLocked(id)
+		kp.lastSeen = clock.Now()
+		if !kp.inDHT {
+			kp.inDHT = true
+			found = append(found, id)
+		}
+		kp.missing = 0
+	}
+
+	cycles := lostPeerCycles()
+	for id, kp := range knownPeers {
+		if !kp.inDHT || inTable[id] {
+			continue
+		}
+		if connected(id) {
+			kp.missing = 0
+			continue
+		}
+		kp.missing++
+		if kp.missing >= cycles {
+			delete(knownPeers, id)
+			lost = append(lost, id)
+		}
+	}
+	return found, lost
+}
+
+// 是否已连接节点, 已连接时无需再拨号
+func IsConnected(id peer.ID) bool {
+	return node.Network().Connectedness(id) == network.Connected
+}
+
+// 获取节点状态
+func GetPeerState(id peer.ID) PeerState {
+	if node != nil && IsConnected(id) {
+		return PEER_STATE_CONNECTED
+	}
+	knownLock.Lock()
+	defer knownLock.Unlock()
+	if _, exists := knownPeers[id]; exists {
+		return PEER_STATE_KNOWN
+	}
+	return PEER_STATE_UNKNOWN
+}
+
+// 节点最后发现或连接的时间, 已连接的节点为当前时间, 没有记录的节点为零值
+func peerLastSeen(id peer.ID) time.Time {
+	if IsConnected(id) {
+		return clock.Now()
+	}
+	knownLock.Lock()
+	defer knownLock.Unlock()
+	if kp, exists := knownPeers[id]; exists {
+		return kp.lastSeen
+	}
+	return time.Time{}
+}
+
+// 获取已知(未连接)和已连接节点数量
+func PeerStateCounts() (known int, connected int) {
+	knownLock.Lock()
+	ids := make([]peer.ID, 0, len(knownPeers))
+	for id := range knownPeers {
+		ids = append(ids, id)
+	}
+	knownLock.Unlock()
+
+	for _, id := range ids {
+		if IsConnected(id) {
+			connected++
+		} else {
+			known++
+		}
+	}
+	return known, connected
+}
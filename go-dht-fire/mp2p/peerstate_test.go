@@ -0,0 +1,74 @@
+package mp2p
+
+import (
+	"errors"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"testing"
+)
+
+func TestMarkDialFailedUnreachable(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+
+	//清空事件
+	for len(eventChan) > 0 {
+		<-eventChan
+	}
+
+	id := randomPeerID(t)
+	learnPeer(id)
+	if GetPeerState(id) != PEER_STATE_KNOWN {
+		t.Fatal("发现的节点应为已知状态:", GetPeerState(id))
+	}
+
+	markDialFailed(id, errors.New("拨号失败"))
+	markDialFailed(id, errors.New("拨号失败"))
+	count := 0
+	for len(eventChan) > 0 {
+		if ev := <-eventChan; ev.Type == EVENT_PEER_UNREACHABLE && ev.Peer == id {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Fatal("无法连接事件应只发出一次:", count)
+	}
+
+	known, connected := PeerStateCounts()
+	if known < 1 || connected != 0 {
+		t.Fatal("节点数量错误:", known, connected)
+	}
+}
+
+func TestSyncRoutingPeersGrace(t *testing.T) {
+	config = Config{LostPeerCycles: 3}
+	defer func() {
+		config = Config{}
+	}()
+	notConnected := func(peer.ID) bool { return false }
+
+	a, b := randomPeerID(t), randomPeerID(t)
+	found, lost := syncRoutingPeers([]peer.ID{a, b}, notConnected)
+	if len(found) != 2 || len(lost) != 0 {
+		t.Fatal("应发现2个节点:", found, lost)
+	}
+
+	//b短暂离开路由表后回来, 不应失去
+	syncRoutingPeers([]peer.ID{a}, notConnected)
+	syncRoutingPeers([]peer.ID{a}, notConnected)
+	found, lost = syncRoutingPeers([]peer.ID{a, b}, notConnected)
+	if len(found) != 0 || len(lost) != 0 {
+		t.Fatal("短暂离开不应失去或重新发现:", found, lost)
+	}
+
+	//连续3次不在路由表中才失去
+	for i := 0; i < 2; i++ {
+		_, lost = syncRoutingPeers([]peer.ID{a}, notConnected)
+		if len(lost) != 0 {
+			t.Fatal("未达到次数不应失去:", i)
+		}
+	}
+	_, lost = syncRoutingPeers([]peer.ID{a}, notConnected)
+	if len(lost) != 1 || lost[0] != b {
+		t.Fatal("应失去b:", lost)
+	}
+}
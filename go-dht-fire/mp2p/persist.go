@@ -0,0 +1,232 @@
+package mp2p
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"go.uber.org/multierr"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_PEER_TTL      = time.Hour * 24 //连接失败的节点保留时间
+	RECONNECT_CONCURRENCY = 8              //启动时同时重连的节点数量
+)
+
+// 保存的节点
+type persistedPeer struct {
+	Addr     string `json:"addr"`      //P2P地址
+	LastSeen int64  `json:"last_seen"` //最后连接时间(Unix秒)
+}
+
+var persistLock sync.Mutex
+var persistedPeers = make(map[string]persistedPeer)
+
+// 读取保存的节点, 丢弃超过TTL没有连接的
+func loadPeers(path string, ttl time.Duration) {
+	persistLock.Lock()
+	defer persistLock.Unlock()
+
+	persistedPeers = make(map[string]persistedPeer)
+	data, e := ioutil.ReadFile(path)
+	if os.IsNotExist(e) {
+		return
+	}
+	if e != nil {
+		logMsg("persist.read_failed", e)
+		return
+	}
+	var peers map[string]persistedPeer
+	e = json.Unmarshal(data, &peers)
+	if e != nil {
+		logMsg("persist.invalid", e)
+		return
+	}
+
+	now := clock.Now()
+	for id, p := range peers {
+		if now.Sub(time.Unix(p.LastSeen, 0)) > ttl {
+			logMsg("persist.expired", id)
+			continue
+		}
+		persistedPeers[id] = p
+	}
+}
+
+// 保存节点
+// 已连接的节点更新最后连接时间, 没有连接的保留之前的时间, 超过TTL的丢弃.
+func savePeers(path string, ttl time.Duration) error {
+	persistLock.Lock()
+	defer persistLock.Unlock()
+
+	now := clock.Now()
+	sm.RLock()
+	for id, addr := range peerMap {
+		if addr == "" {
+			continue
+		}
+		p := persistedPeer{Addr: addr, LastSeen: now.Unix()}
+		if old, exists := persistedPeers[id]; exists && !isConnectedText(id) {
+			p.LastSeen = old.LastSeen
+		}
+		persistedPeers[id] = p
+	}
+	sm.RUnlock()
+	for id, p := range persistedPeers {
+		if now.Sub(time.Unix(p.LastSeen, 0)) > ttl {
+			delete(persistedPeers, id)
+		}
+	}
+
+	data, e := json.Marshal(persistedPeers)
+	if e != nil {
+		return e
+	}
+	e = os.MkdirAll(filepath.Dir(path), 0755)
+	if e != nil {
+		return e
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// 是否已连接节点(文本ID)
+func isConnectedText(id string) bool {
+	peerId, e := peer.Decode(id)
+	if e != nil {
+		return false
+	}
+	return IsConnected(peerId)
+}
+
+// 重连上次保存的节点, 同时最多连接RECONNECT_CONCURRENCY个
+// 连接成功的节点放入缓存, 失败的保留在节点文件中直到超过TTL.
+func reconnectPeers() {
+	persistLock.Lock()
+	peers := make(map[string]persistedPeer, len(persistedPeers))
+	for id, p := range persistedPeers {
+		peers[id] = p
+	}
+	persistLock.Unlock()
+	if len(peers) == 0 {
+		return
+	}
+	logMsg("persist.reconnecting", len(peers))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, RECONNECT_CONCURRENCY)
+	for id, p := range peers {
+		ai, e := textToAddrInfo(p.Addr)
+		if e != nil {
+			logMsg("peers.addr_invalid", e)
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id, addr string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			addAddrs(*ai, gossipAddrTTL())
+			e := connect(*ai)
+			if e != nil {
+				logMsg("persist.reconnect_failed", id, e)
+				return
+			}
+			logMsg("persist.reconnected", addr)
+			sm.Lock()
+			peerMap[id] = addr
+			sm.Unlock()
+			invalidateBootstrapCache()
+		}(id, p.Addr)
+	}
+	wg.Wait()
+}
+
+// 导出节点知道的所有节点地址, 用于调试时保存和重现连接问题
+// 键为节点ID, 值为缓存和节点存储中的所有地址(不含/p2p部分, 已去重排序). 不包括自己.
+func ExportPeerMap() map[string][]string {
+	addrSets := make(map[string]map[string]bool)
+	add := func(id peer.ID, ma multiaddr.Multiaddr) {
+		if id == node.ID() {
+			return
+		}
+		if addrSets[id.String()] == nil {
+			addrSets[id.String()] = make(map[string]bool)
+		}
+		addrSets[id.String()][ma.String()] = true
+	}
+
+	sm.RLock()
+	for _, addr := range peerMap {
+		ai, e := textToAddrInfo(addr)
+		if e != nil {
+			continue
+		}
+		for _, ma := range ai.Addrs {
+			add(ai.ID, ma)
+		}
+	}
+	ps := node.Peerstore()
+	for _, id := range ps.PeersWithAddrs() {
+		for _, ma := range ps.Addrs(id) {
+			add(id, ma)
+		}
+	}
+	sm.RUnlock()
+
+	peers := make(map[string][]string, len(addrSets))
+	for id, set := range addrSets {
+		addrs := make([]string, 0, len(set))
+		for addr := range set {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		peers[id] = addrs
+	}
+	return peers
+}
+
+// 导入ExportPeerMap导出的节点地址, 用于新节点重现之前的节点信息
+// 地址加入节点存储(保留GossipAddrTTL), 没有缓存的节点使用第一个地址缓存. 不会连接节点.
+// 错误的节点ID或地址跳过, 返回所有错误的组合.
+func ImportPeerMap(peers map[string][]string) error {
+	var err error
+	defer invalidateBootstrapCache()
+	sm.Lock()
+	defer sm.Unlock()
+	for idText, addrTexts := range peers {
+		id, e := peer.Decode(idText)
+		if e != nil {
+			err = multierr.Append(err, fmt.Errorf("节点ID错误%s: %w", idText, e))
+			continue
+		}
+		if id == node.ID() {
+			continue
+		}
+		ai := peer.AddrInfo{ID: id}
+		for _, addrText := range addrTexts {
+			ma, e := multiaddr.NewMultiaddr(addrText)
+			if e != nil {
+				err = multierr.Append(err, fmt.Errorf("节点%s地址错误%s: %w", idText, addrText, e))
+				continue
+			}
+			ai.Addrs = append(ai.Addrs, ma)
+		}
+		if len(ai.Addrs) == 0 {
+			continue
+		}
+		addAddrs(ai, gossipAddrTTL())
+		if _, exists := peerMap[idText]; !exists {
+			peerMap[idText] = strings.Join([]string{ai.Addrs[0].String(), "/ipfs/", idText}, "")
+		}
+	}
+	return err
+}
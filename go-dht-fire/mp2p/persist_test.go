@@ -0,0 +1,40 @@
+package mp2p
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportImportPeerMap(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	defer func() {
+		peerMap = make(map[string]string)
+	}()
+
+	id := randomPeerID(t).String()
+	peers := map[string][]string{
+		id: {"/ip4/1.2.3.4/tcp/4001", "/ip4/1.2.3.4/udp/4001/quic"},
+	}
+	e := ImportPeerMap(peers)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if peerMap[id] != strings.Join([]string{"/ip4/1.2.3.4/tcp/4001/ipfs/", id}, "") {
+		t.Fatal("导入的节点应该缓存:", peerMap[id])
+	}
+
+	exported := ExportPeerMap()
+	if !reflect.DeepEqual(exported[id], peers[id]) {
+		t.Fatal("导出的地址错误:", exported[id])
+	}
+	if _, exists := exported[node.ID().String()]; exists {
+		t.Fatal("不应导出自己")
+	}
+
+	e = ImportPeerMap(map[string][]string{"not-a-peer": {"/ip4/1.2.3.4/tcp/1"}, id: {"bad"}})
+	if e == nil {
+		t.Fatal("错误的节点ID和地址应返回错误")
+	}
+}
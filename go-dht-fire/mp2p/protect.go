@@ -0,0 +1,45 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/peer"
+	"sync"
+)
+
+const (
+	PROTECT_TAG_BOOTSTRAP = "mp2p-bootstrap" //启发节点的保护标签
+)
+
+// 受保护的节点和标签
+// 连接管理器没有提供查询方法, 在这里记录一份.
+var protectLock sync.Mutex
+var protectedPeers = make(map[peer.ID]map[string]bool)
+
+// 保护节点, 连接数量超过上限时连接管理器不会断开该节点
+// 同一节点可用不同标签多次保护, 所有标签都取消后才不再保护.
+func Protect(id peer.ID, tag string) {
+	protectLock.Lock()
+	if protectedPeers[id] == nil {
+		protectedPeers[id] = make(map[string]bool)
+	}
+	protectedPeers[id][tag] = true
+	protectLock.Unlock()
+	node.ConnManager().Protect(id, tag)
+}
+
+// 取消节点的一个保护标签, 返回节点是否仍受保护
+func Unprotect(id peer.ID, tag string) bool {
+	protectLock.Lock()
+	delete(protectedPeers[id], tag)
+	if len(protectedPeers[id]) == 0 {
+		delete(protectedPeers, id)
+	}
+	protectLock.Unlock()
+	return node.ConnManager().Unprotect(id, tag)
+}
+
+// 节点是否受保护
+func IsProtected(id peer.ID) bool {
+	protectLock.Lock()
+	defer protectLock.Unlock()
+	return len(protectedPeers[id]) > 0
+}
@@ -0,0 +1,23 @@
+package mp2p
+
+import "testing"
+
+func TestProtect(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+
+	id := randomPeerID(t)
+	Protect(id, "a")
+	Protect(id, "b")
+	if !IsProtected(id) {
+		t.Fatal("节点应受保护")
+	}
+	Unprotect(id, "a")
+	if !IsProtected(id) {
+		t.Fatal("还有标签时节点应受保护")
+	}
+	Unprotect(id, "b")
+	if IsProtected(id) {
+		t.Fatal("所有标签取消后节点不应受保护")
+	}
+}
@@ -0,0 +1,101 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"sort"
+	"sync"
+)
+
+// 协议处理注册表
+// 集中管理协议处理的生命周期: Register记录处理, Install把所有处理设置到节点, Uninstall(排空时)全部移除.
+// 设置到节点的处理都经过并发限制(limitStreams)和异常恢复(recoverStream), 各协议的排空和限制一致.
+type Protocols struct {
+	lock      sync.Mutex
+	handlers  map[protocol.ID]network.StreamHandler
+	installed host.Host //已安装的节点, 未安装时为nil
+}
+
+// 创建协议处理注册表
+func NewProtocols() *Protocols {
+	return &Protocols{handlers: make(map[protocol.ID]network.StreamHandler)}
+}
+
+// mp2p的协议处理, 节点启动时安装. 启动前注册的处理不会丢失
+var protocols = NewProtocols()
+
+// 注册协议处理, 同一协议重复注册时替换
+// 已安装时立即设置到节点.
+func (p *Protocols) Register(id protocol.ID, handler network.StreamHandler) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.handlers[id] = handler
+	if p.installed != nil {
+		p.installed.SetStreamHandler(id, wrapStreamHandler(handler))
+	}
+}
+
+// 把所有协议处理设置到节点h, 之后注册的处理也会设置到h
+// 已安装到其它节点时先从原节点移除.
+func (p *Protocols) Install(h host.Host) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.installed != nil && p.installed != h {
+		p.removeLocked()
+	}
+	p.installed = h
+	for id, handler := range p.handlers {
+		h.SetStreamHandler(id, wrapStreamHandler(handler))
+	}
+}
+
+// 从节点移除所有协议处理, 返回移除的数量. 新的流会收到协议不支持的错误, 正在执行的处理不受影响
+// 注册的处理仍然保留, 可以再次安装.
+func (p *Protocols) Uninstall() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.installed == nil {
+		return 0
+	}
+	n := len(p.handlers)
+	p.removeLocked()
+	return n
+}
+
+func (p *Protocols) removeLocked() {
+	for id := range p.handlers {
+		p.installed.RemoveStreamHandler(id)
+	}
+	p.installed = nil
+}
+
+// 已注册的协议, 按协议ID排序
+func (p *Protocols) IDs() []protocol.ID {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	ids := make([]protocol.ID, 0, len(p.handlers))
+	for id := range p.handlers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// 设置到节点的处理: 并发限制, 流期限, 异常恢复
+func wrapStreamHandler(handler network.StreamHandler) network.StreamHandler {
+	return limitStreams(recoverStream(handler))
+}
+
+// 处理出现异常(panic)时记录日志并重置流, 不影响节点的其它处理
+func recoverStream(handler network.StreamHandler) network.StreamHandler {
+	return func(s network.Stream) {
+		defer func() {
+			if r := recover(); r != nil {
+				logMsg("streams.panic", s.Conn().RemotePeer().String(), s.Protocol(), r)
+				_ = s.Reset()
+			}
+		}()
+		handler(s)
+	}
+}
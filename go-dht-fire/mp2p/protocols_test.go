@@ -0,0 +1,104 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"reflect"
+	"testing"
+)
+
+func TestProtocols(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	resetDrain()
+
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer remote.Close()
+	remote.Peerstore().AddAddrs(node.ID(), node.Addrs(), peerstore.TempAddrTTL)
+	request := func(proto protocol.ID) (string, error) {
+		s, e := remote.NewStream(ctx, node.ID(), proto)
+		if e != nil {
+			return "", e
+		}
+		defer s.Close()
+		_, _ = s.Write([]byte("ping\n"))
+		return readTextFormStream(s)
+	}
+
+	//安装前注册的处理在安装时设置, 安装后注册的处理立即设置
+	p := NewProtocols()
+	reply := func(s network.Stream) {
+		_, _ = readTextFormStream(s)
+		_, _ = s.Write([]byte("pong\n"))
+		_ = s.Close()
+	}
+	p.Register("/mp2p/test/before", reply)
+	p.Install(node)
+	p.Register("/mp2p/test/after", reply)
+	p.Register("/mp2p/test/panic", func(s network.Stream) {
+		panic("处理异常")
+	})
+	if ids := p.IDs(); !reflect.DeepEqual(ids, []protocol.ID{"/mp2p/test/after", "/mp2p/test/before", "/mp2p/test/panic"}) {
+		t.Fatal("已注册的协议错误:", ids)
+	}
+	for _, proto := range []protocol.ID{"/mp2p/test/before", "/mp2p/test/after"} {
+		if text, e := request(proto); e != nil || text != "pong" {
+			t.Fatal("应处理已注册的协议:", proto, text, e)
+		}
+	}
+
+	//异常的处理重置流, 其它处理不受影响
+	if _, e = request("/mp2p/test/panic"); e == nil {
+		t.Fatal("处理异常时应重置流")
+	}
+	if text, e := request("/mp2p/test/before"); e != nil || text != "pong" {
+		t.Fatal("处理异常后其它协议应正常:", text, e)
+	}
+
+	//卸载后新的流出错, 再次安装后恢复
+	if n := p.Uninstall(); n != 3 {
+		t.Fatal("应移除所有协议处理:", n)
+	}
+	if _, e = request("/mp2p/test/before"); e == nil {
+		t.Fatal("卸载后新的流应出错")
+	}
+	p.Install(node)
+	if text, e := request("/mp2p/test/after"); e != nil || text != "pong" {
+		t.Fatal("再次安装后应处理:", text, e)
+	}
+	p.Uninstall()
+}
+
+// 节点启动前注册的处理在启动时和mp2p自己的协议一起安装
+func TestInstallProtocolsKeepsRegistered(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+
+	protocols = NewProtocols()
+	protocols.Register("/mp2p/test/early", func(s network.Stream) {
+		_ = s.Close()
+	})
+	installProtocols(node)
+	ids := protocols.IDs()
+	for _, proto := range []protocol.ID{"/mp2p/test/early", PROTOCOL_BOOTSTRAP_V2, PROTOCOL_ECHO} {
+		found := false
+		for _, id := range ids {
+			found = found || id == proto
+		}
+		if !found {
+			t.Fatal("应安装协议:", proto, ids)
+		}
+	}
+	found := false
+	for _, id := range node.Mux().Protocols() {
+		found = found || id == "/mp2p/test/early"
+	}
+	if !found {
+		t.Fatal("启动前注册的处理应设置到节点")
+	}
+}
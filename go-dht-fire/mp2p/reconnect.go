@@ -0,0 +1,113 @@
+package mp2p
+
+import (
+	"context"
+	"errors"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"sync"
+	"time"
+)
+
+const (
+	RECONNECT_BACKOFF_BASE = time.Second     //意外断开后首次重连前的等待时间, 之后每次加倍
+	RECONNECT_BACKOFF_MAX  = time.Minute * 5 //重连的最长等待时间
+	DEFAULT_MAX_RECONNECTS = 8               //默认同时拨号重连的节点数量
+)
+
+// 正在重连的节点
+var reconnectLock sync.Mutex
+var reconnecting = make(map[peer.ID]bool)
+var reconnectSem = make(chan struct{}, DEFAULT_MAX_RECONNECTS)
+
+// 设置同时拨号重连的节点数量, 不大于0时使用默认值. 只应在节点启动前调用
+func setReconnectLimit(max int) {
+	if max <= 0 {
+		max = DEFAULT_MAX_RECONNECTS
+	}
+	reconnectLock.Lock()
+	reconnectSem = make(chan struct{}, max)
+	reconnectLock.Unlock()
+}
+
+// 正在重连的节点
+// 受保护的节点(Protect)意外断开后自动重连, 直到连接成功或取消保护.
+func Reconnecting() []peer.ID {
+	reconnectLock.Lock()
+	defer reconnectLock.Unlock()
+	ids := make([]peer.ID, 0, len(reconnecting))
+	for id := range reconnecting {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// 节点断开后开始重连, 只重连受保护的节点, 已在重连或节点正在关闭时忽略
+func startReconnect(id peer.ID) {
+	if ctx == nil || ctx.Err() != nil || !IsProtected(id) || IsConnected(id) {
+		return
+	}
+	reconnectLock.Lock()
+	if reconnecting[id] {
+		reconnectLock.Unlock()
+		return
+	}
+	reconnecting[id] = true
+	reconnectLock.Unlock()
+
+	logMsg("reconnect.started", id.String())
+	go reconnectLoop(ctx, id)
+}
+
+// 按指数退避重连节点, 连接成功(包括对方连接过来), 取消保护或上下文结束时退出
+func reconnectLoop(ctx context.Context, id peer.ID) {
+	defer func() {
+		reconnectLock.Lock()
+		delete(reconnecting, id)
+		reconnectLock.Unlock()
+	}()
+
+	backoff := RECONNECT_BACKOFF_BASE
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(jitter(backoff)):
+		}
+		if !IsProtected(id) {
+			logMsg("reconnect.cancelled", id.String())
+			return
+		}
+		if IsConnected(id) {
+			return
+		}
+
+		e := reconnectOnce(ctx, id)
+		if e == nil {
+			logMsg("reconnect.succeeded", id.String(), attempt)
+			return
+		}
+		//熔断时不拨号, 不记录日志
+		if !errors.Is(e, ErrCircuitOpen) {
+			logMsg("reconnect.failed", id.String(), attempt, e)
+		}
+		backoff *= 2
+		if backoff > RECONNECT_BACKOFF_MAX {
+			backoff = RECONNECT_BACKOFF_MAX
+		}
+	}
+}
+
+// 拨号重连一次, 同时拨号的数量超过上限时等待
+func reconnectOnce(ctx context.Context, id peer.ID) error {
+	reconnectLock.Lock()
+	sem := reconnectSem
+	reconnectLock.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-sem }()
+	return connectContext(ctx, node.Peerstore().PeerInfo(id))
+}
@@ -0,0 +1,51 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"testing"
+	"time"
+)
+
+func TestReconnectProtected(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	node.Network().Notify(eventNotifiee())
+
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer remote.Close()
+	other, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer other.Close()
+
+	for _, h := range []peer.AddrInfo{{ID: remote.ID(), Addrs: remote.Addrs()}, {ID: other.ID(), Addrs: other.Addrs()}} {
+		if e = connect(h); e != nil {
+			t.Fatal(e)
+		}
+	}
+	Protect(remote.ID(), "test")
+	defer Unprotect(remote.ID(), "test")
+
+	//断开后只重连受保护的节点, 断开通知是异步的
+	_ = node.Network().ClosePeer(remote.ID())
+	_ = node.Network().ClosePeer(other.ID())
+	seen := make(map[peer.ID]bool)
+	deadline := time.Now().Add(time.Second * 10)
+	for !seen[remote.ID()] || !IsConnected(remote.ID()) || len(Reconnecting()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("受保护的节点应重新连接")
+		}
+		for _, id := range Reconnecting() {
+			seen[id] = true
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	if seen[other.ID()] || IsConnected(other.ID()) {
+		t.Fatal("没有保护的节点不应重连")
+	}
+}
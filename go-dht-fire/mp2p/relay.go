@@ -0,0 +1,162 @@
+package mp2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/event"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	PROTOCOL_CIRCUIT_RELAY = "/libp2p/circuit/relay/0.1.0" //中继协议, 支持的节点可作为中继
+)
+
+var ErrNoRelay = errors.New("没有可用的中继节点")
+
+// 通过中继到达自己的P2P地址, 来自AutoRelay的中继预约
+var relayAddrLock sync.Mutex
+var relayAddrs []string
+
+// 是否为中继地址
+func isRelayAddr(ma multiaddr.Multiaddr) bool {
+	_, e := ma.ValueForProtocol(multiaddr.P_CIRCUIT)
+	return e == nil
+}
+
+// 拆分直连地址和中继地址
+func splitRelayAddrs(addrs []multiaddr.Multiaddr) (direct []multiaddr.Multiaddr, relay []multiaddr.Multiaddr) {
+	for _, ma := range addrs {
+		if isRelayAddr(ma) {
+			relay = append(relay, ma)
+		} else {
+			direct = append(direct, ma)
+		}
+	}
+	return
+}
+
+// 通过已连接的中继节点到达目标节点的地址(/p2p/中继ID/p2p-circuit)
+func connectedRelayAddrs(target peer.ID) []multiaddr.Multiaddr {
+	var addrs []multiaddr.Multiaddr
+	for _, id := range node.Network().Peers() {
+		if id == target {
+			continue
+		}
+		protocols, e := node.Peerstore().SupportsProtocols(id, PROTOCOL_CIRCUIT_RELAY)
+		if e != nil || len(protocols) == 0 {
+			continue
+		}
+		ma, e := multiaddr.NewMultiaddr(strings.Join([]string{"/p2p/", id.String(), "/p2p-circuit"}, ""))
+		if e == nil {
+			addrs = append(addrs, ma)
+		}
+	}
+	return addrs
+}
+
+// 当前连接是否经过中继
+func connectedViaRelay(id peer.ID) bool {
+	conns := node.Network().ConnsToPeer(id)
+	for _, conn := range conns {
+		if !isRelayAddr(conn.RemoteMultiaddr()) {
+			return false
+		}
+	}
+	return len(conns) > 0
+}
+
+// 连接节点, 直连失败时通过中继连接
+// 先拨号直连地址(没有时使用节点存储中的地址), 失败后拨号pi中的中继地址和通过已连接中继节点的地址. 日志记录成功的路径.
+// 节点存储中已有中继地址时, 直连阶段也可能经中继连接.
+func ConnectWithFallback(ctx context.Context, pi peer.AddrInfo) error {
+	if IsConnected(pi.ID) {
+		return nil
+	}
+	direct, relay := splitRelayAddrs(pi.Addrs)
+
+	directErr := connectContext(ctx, peer.AddrInfo{ID: pi.ID, Addrs: direct})
+	if directErr == nil {
+		if connectedViaRelay(pi.ID) {
+			logMsg("relay.connected_relay", pi.ID.String())
+		} else {
+			logMsg("relay.connected_direct", pi.ID.String())
+		}
+		return nil
+	}
+	if ctx.Err() != nil {
+		return directErr
+	}
+
+	relay = append(relay, connectedRelayAddrs(pi.ID)...)
+	if len(relay) == 0 {
+		return fmt.Errorf("%w, 直连出错: %v", ErrNoRelay, directErr)
+	}
+	logMsg("relay.fallback", pi.ID.String(), directErr)
+	relayErr := connectContext(ctx, peer.AddrInfo{ID: pi.ID, Addrs: relay})
+	if relayErr != nil {
+		return fmt.Errorf("直连出错: %v, 中继出错: %w", directErr, relayErr)
+	}
+	logMsg("relay.connected_relay", pi.ID.String())
+	return nil
+}
+
+// 从节点地址中更新中继地址, 返回是否变化
+func updateRelayAddrs(addrs []multiaddr.Multiaddr) bool {
+	var p2pAddrs []string
+	for _, ma := range addrs {
+		if isRelayAddr(ma) {
+			p2pAddrs = append(p2pAddrs, strings.Join([]string{ma.String(), "/p2p/", node.ID().String()}, ""))
+		}
+	}
+	sort.Strings(p2pAddrs)
+
+	relayAddrLock.Lock()
+	defer relayAddrLock.Unlock()
+	changed := len(p2pAddrs) != len(relayAddrs)
+	for i := 0; !changed && i < len(p2pAddrs); i++ {
+		changed = p2pAddrs[i] != relayAddrs[i]
+	}
+	relayAddrs = p2pAddrs
+	return changed
+}
+
+// 获取中继地址
+func currentRelayAddrs() []string {
+	relayAddrLock.Lock()
+	defer relayAddrLock.Unlock()
+	return append([]string(nil), relayAddrs...)
+}
+
+// 监视节点地址变化, 中继预约变化时更新中继地址并重新引导以宣告
+// AutoRelay在节点位于NAT后时预约中继, 预约变化时节点地址随之变化.
+func watchRelayAddrs() {
+	sub, e := node.EventBus().Subscribe(new(event.EvtLocalAddressesUpdated))
+	if e != nil {
+		logMsg("relay.watch_failed", e)
+		return
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case <-sub.Out():
+		case <-ctx.Done():
+			return
+		}
+		if !updateRelayAddrs(node.Addrs()) {
+			continue
+		}
+		logMsg("relay.addrs", currentRelayAddrs())
+		for _, group := range groupAddrTexts(bootstrapPeers) {
+			e = bootstrap(group...)
+			if e != nil {
+				logMsg("bootstrap.failed", e)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package mp2p
+
+import (
+	"github.com/multiformats/go-multiaddr"
+	"testing"
+)
+
+func TestSplitRelayAddrs(t *testing.T) {
+	var addrs []multiaddr.Multiaddr
+	for _, text := range []string{
+		"/ip4/1.2.3.4/udp/4001/quic",
+		"/ip4/5.6.7.8/tcp/4001/p2p/QmbLHAnMoJPWSCR5Zhtx6BHJX9KiKNN6tpvbUcqanj75Nb/p2p-circuit",
+		"/ip4/1.2.3.4/tcp/4001",
+	} {
+		ma, e := multiaddr.NewMultiaddr(text)
+		if e != nil {
+			t.Fatal(e)
+		}
+		addrs = append(addrs, ma)
+	}
+	direct, relay := splitRelayAddrs(addrs)
+	if len(direct) != 2 || len(relay) != 1 || !relay[0].Equal(addrs[1]) {
+		t.Fatal("拆分错误:", direct, relay)
+	}
+}
+
+func TestRelayAddrsAdvertised(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	defer updateRelayAddrs(nil)
+	natLock.Lock()
+	natAddrs = []string{"/ip4/1.2.3.4/udp/4001/quic/p2p/" + node.ID().String()}
+	natLock.Unlock()
+	defer func() {
+		natLock.Lock()
+		natAddrs = nil
+		natLock.Unlock()
+	}()
+
+	var addrs []multiaddr.Multiaddr
+	for _, text := range []string{
+		"/ip4/1.2.3.4/udp/4001/quic",
+		"/ip4/5.6.7.8/tcp/4001/p2p/QmbLHAnMoJPWSCR5Zhtx6BHJX9KiKNN6tpvbUcqanj75Nb/p2p-circuit",
+	} {
+		ma, e := multiaddr.NewMultiaddr(text)
+		if e != nil {
+			t.Fatal(e)
+		}
+		addrs = append(addrs, ma)
+	}
+	if !updateRelayAddrs(addrs) {
+		t.Fatal("中继地址应变化")
+	}
+	if updateRelayAddrs(addrs) {
+		t.Fatal("相同的中继地址不应变化")
+	}
+
+	//中继地址在NAT地址之后, 以自己的ID结尾
+	relayAddr := "/ip4/5.6.7.8/tcp/4001/p2p/QmbLHAnMoJPWSCR5Zhtx6BHJX9KiKNN6tpvbUcqanj75Nb/p2p-circuit/p2p/" + node.ID().String()
+	advertised := ListenAddrs()
+	if len(advertised) != 2 || advertised[1] != relayAddr {
+		t.Fatal("宣告地址应包含中继地址:", advertised)
+	}
+	ai, e := textToAddrInfo(relayAddr)
+	if e != nil || ai.ID != node.ID() || !isRelayAddr(ai.Addrs[0]) {
+		t.Fatal("中继地址应可解析为自己:", ai, e)
+	}
+
+	//节点地址工厂不重复加入中继地址
+	for _, ma := range natAddrsFactory(nil) {
+		if isRelayAddr(ma) {
+			t.Fatal("节点地址工厂不应加入中继地址:", ma)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package mp2p
+
+import (
+	"context"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
+	discovery "github.com/libp2p/go-libp2p-discovery"
+	"time"
+)
+
+const (
+	DEFAULT_RENDEZVOUS_INTERVAL = time.Minute
+)
+
+// 获取内容路由(双DHT模式时使用双DHT)
+func contentRouting() routing.ContentRouting {
+	wan, lan := currentDHT()
+	if lan != nil {
+		return lan
+	}
+	return wan
+}
+
+// 通过汇合点发现节点
+// 定时在DHT中宣告汇合点, 并查找宣告了同一汇合点的节点, 连接并缓存. 暂停发现时跳过.
+func rendezvous(ctx context.Context, ns string, interval time.Duration) {
+	if interval <= 0 {
+		interval = DEFAULT_RENDEZVOUS_INTERVAL
+	}
+	routingDiscovery := discovery.NewRoutingDiscovery(contentRouting())
+
+	for {
+		if !DiscoveryPaused() {
+			_, e := routingDiscovery.Advertise(ctx, ns)
+			if e != nil {
+				logMsg("rendezvous.advertise_failed", e)
+			} else {
+				logMsg("rendezvous.advertised", ns)
+			}
+
+			findRendezvousPeers(ctx, routingDiscovery, ns)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(interval):
+		case <-discoveryResumedChan():
+		}
+	}
+}
+
+// 查找汇合点节点, 连接并缓存
+func findRendezvousPeers(ctx context.Context, routingDiscovery *discovery.RoutingDiscovery, ns string) {
+	peerChan, e := routingDiscovery.FindPeers(ctx, ns)
+	if e != nil {
+		logMsg("rendezvous.find_failed", e)
+		return
+	}
+
+	for ai := range peerChan {
+		if ai.ID == node.ID() || len(ai.Addrs) == 0 || DiscoveryPaused() {
+			continue
+		}
+
+		sm.RLock()
+		_, exists := peerMap[ai.ID.String()]
+		sm.RUnlock()
+		if exists {
+			continue
+		}
+
+		addAddrs(ai, gossipAddrTTL())
+		e = connect(ai)
+		if isDialBackoff(e) {
+			continue
+		}
+		if e != nil {
+			logMsg("peers.connect_failed", e)
+			continue
+		}
+
+		p2pAddrs, e := peer.AddrInfoToP2pAddrs(&ai)
+		if e != nil {
+			logMsg("peers.addr_invalid", e)
+			continue
+		}
+		logMsg("rendezvous.found", p2pAddrs[0])
+
+		//缓存节点
+		sm.Lock()
+		peerMap[ai.ID.String()] = p2pAddrs[0].String()
+		sm.Unlock()
+		invalidateBootstrapCache()
+	}
+}
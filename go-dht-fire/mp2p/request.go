@@ -0,0 +1,236 @@
+package mp2p
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_REQUEST_RETRIES = 3
+	DEFAULT_REQUEST_TIMEOUT = time.Second * 10
+	DEFAULT_REQUEST_BACKOFF = time.Second
+)
+
+var ErrRequestNoAck = errors.New("请求没有收到确认")
+
+// 对方处理请求出错
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+// 请求消息, 一行JSON
+// 回复使用相同的ID, 收到回复即为确认.
+type requestMessage struct {
+	ID    string `json:"id"`              //消息ID, 重试时不变, 接收方可据此去重
+	Data  []byte `json:"data"`            //数据
+	Error string `json:"error,omitempty"` //处理出错时的错误信息(仅回复)
+	From  string `json:"from,omitempty"`  //签名的节点ID(签名消息)
+	Sig   []byte `json:"sig,omitempty"`   //签名(签名消息), 见signingBytes
+}
+
+// 请求选项
+type RequestOptions struct {
+	Ack     bool          //至少一次送达: 超时或出错时重试, 直到收到确认
+	Retries int           //确认模式的重试次数, 默认3
+	Timeout time.Duration //每次写入和等待回复的时间, 默认使用协议配置的期限(Config.StreamDeadlines), 没有配置时10秒
+	Backoff time.Duration //首次重试前的等待时间, 之后每次加倍, 默认1秒
+
+	// 有序: 同一节点同一协议的有序请求进入发送队列, 通过一个长期的流按进入队列的顺序逐个发送, 不会交错
+	// 适合聊天等需要保持顺序的场景. 确认模式重试时重新进入队列, 重试的请求排在之后的请求后面.
+	Ordered bool
+}
+
+// 请求处理
+// msgID: 消息ID, 确认模式重试时相同, 需要幂等时据此去重
+// 返回的数据作为回复, 返回错误时回复错误信息.
+type RequestHandler func(from peer.ID, msgID string, data []byte) ([]byte, error)
+
+// 生成消息ID
+func newMessageID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// 在流中写入一行JSON
+func writeJSONToStream(s network.Stream, v interface{}) error {
+	jsonBytes, e := json.Marshal(v)
+	if e != nil {
+		return e
+	}
+	_, e = s.Write([]byte(strings.Join([]string{string(jsonBytes), "\n"}, "")))
+	return e
+}
+
+// 设置请求处理
+// 一个流中可以有多个请求(有序请求), 逐个处理和回复, 直到对方关闭流.
+func SetRequestHandler(proto protocol.ID, handler RequestHandler) {
+	setRequestHandler(proto, handler, false)
+}
+
+// 设置请求处理, verified为true时只处理签名正确的请求, 回复同样签名
+func setRequestHandler(proto protocol.ID, handler RequestHandler, verified bool) {
+	protocols.Register(proto, func(s network.Stream) {
+		defer s.Close()
+
+		reader := bufio.NewReader(s)
+		for i := 0; ; i++ {
+			text, e := readTextFromReader(reader)
+			if e == io.EOF && i > 0 {
+				return
+			}
+			if e != nil {
+				logMsg("request.read_failed", e)
+				_ = s.Reset()
+				return
+			}
+			var req requestMessage
+			e = json.Unmarshal([]byte(text), &req)
+			if e != nil {
+				logMsg("request.invalid", e)
+				_ = s.Reset()
+				return
+			}
+
+			from := s.Conn().RemotePeer()
+			if verified {
+				from, e = verifyMessage(proto, req)
+				if e != nil {
+					logMsg("request.unverified", s.Conn().RemotePeer().String(), e)
+					_ = s.Reset()
+					return
+				}
+			}
+
+			res := requestMessage{ID: req.ID}
+			res.Data, e = handler(from, req.ID, req.Data)
+			if e != nil {
+				res.Error = e.Error()
+			}
+			if verified {
+				e = signMessage(proto, &res)
+				if e != nil {
+					logMsg("request.reply_failed", e)
+					_ = s.Reset()
+					return
+				}
+			}
+			e = writeJSONToStream(s, res)
+			if e != nil {
+				logMsg("request.reply_failed", e)
+				return
+			}
+		}
+	})
+}
+
+// 请求, 返回回复数据
+// opts为nil时只发送一次. 确认模式时超时或出错会重试, 用尽重试次数后返回ErrRequestNoAck.
+// 对方处理出错时返回其错误信息, 不会重试.
+func Request(ctx context.Context, id peer.ID, proto protocol.ID, data []byte, opts *RequestOptions) ([]byte, error) {
+	return request(ctx, id, proto, requestMessage{ID: newMessageID(), Data: data}, opts)
+}
+
+// 发送请求消息, Request和VerifiedRequest共用
+func request(ctx context.Context, id peer.ID, proto protocol.ID, req requestMessage, opts *RequestOptions) ([]byte, error) {
+	o := RequestOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Retries <= 0 {
+		o.Retries = DEFAULT_REQUEST_RETRIES
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = DEFAULT_REQUEST_BACKOFF
+	}
+
+	deadline := requestDeadline(proto, o.Timeout)
+	send := requestOnce
+	if o.Ordered {
+		send = requestOrdered
+	}
+	if !o.Ack {
+		return send(ctx, id, proto, req, deadline)
+	}
+
+	backoff := o.Backoff
+	var lastErr error
+	for i := 0; i <= o.Retries; i++ {
+		if i > 0 {
+			logMsg("request.retry", id.String(), req.ID, i, lastErr)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-clock.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		var res []byte
+		res, lastErr = send(ctx, id, proto, req, deadline)
+		if lastErr == nil {
+			return res, nil
+		}
+		var remoteErr *RemoteError
+		if errors.As(lastErr, &remoteErr) {
+			return nil, lastErr
+		}
+	}
+	return nil, fmt.Errorf("%w: %v", ErrRequestNoAck, lastErr)
+}
+
+// 发送一次请求并等待回复
+func requestOnce(ctx context.Context, id peer.ID, proto protocol.ID, req requestMessage, deadline StreamDeadline) ([]byte, error) {
+	reqCtx, reqCancel := context.WithTimeout(ctx, deadline.Write)
+	defer reqCancel()
+
+	s, e := node.NewStream(reqCtx, id, proto)
+	if e != nil {
+		return nil, e
+	}
+	defer s.Close()
+	_ = s.SetWriteDeadline(time.Now().Add(deadline.Write))
+
+	e = writeJSONToStream(s, req)
+	if e != nil {
+		_ = s.Reset()
+		return nil, e
+	}
+	_ = s.SetReadDeadline(time.Now().Add(deadline.Read))
+	text, e := readTextFormStream(s)
+	if e != nil {
+		_ = s.Reset()
+		return nil, e
+	}
+	var res requestMessage
+	e = json.Unmarshal([]byte(text), &res)
+	if e != nil {
+		return nil, e
+	}
+	if res.ID != req.ID {
+		return nil, fmt.Errorf("回复的消息ID错误: %s", res.ID)
+	}
+	e = verifyReply(proto, req, res, id)
+	if e != nil {
+		return nil, e
+	}
+	if res.Error != "" {
+		return nil, &RemoteError{Message: res.Error}
+	}
+	return res.Data, nil
+}
@@ -0,0 +1,148 @@
+package mp2p
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 远程节点, 前drop次请求不回复直接重置流, 之后回复原数据, reply不为空时回复错误
+type ackRemote struct {
+	host.Host
+	lock     sync.Mutex
+	drop     int
+	reply    string
+	attempts int
+	ids      map[string]bool //收到的消息ID
+}
+
+func newAckRemote(t *testing.T, drop int, reply string) *ackRemote {
+	h, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	node.Peerstore().AddAddrs(h.ID(), h.Addrs(), peerstore.TempAddrTTL)
+	r := &ackRemote{Host: h, drop: drop, reply: reply, ids: make(map[string]bool)}
+	h.SetStreamHandler("/mp2p/test/ack", func(s network.Stream) {
+		text, e := readTextFormStream(s)
+		if e != nil {
+			_ = s.Reset()
+			return
+		}
+		var req requestMessage
+		if json.Unmarshal([]byte(text), &req) != nil {
+			_ = s.Reset()
+			return
+		}
+		r.lock.Lock()
+		r.attempts++
+		r.ids[req.ID] = true
+		dropped := r.attempts <= r.drop
+		r.lock.Unlock()
+		if dropped {
+			_ = s.Reset()
+			return
+		}
+		defer s.Close()
+		_ = writeJSONToStream(s, requestMessage{ID: req.ID, Data: req.Data, Error: r.reply})
+	})
+	return r
+}
+
+func (r *ackRemote) counts() (int, int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.attempts, len(r.ids)
+}
+
+func TestRequestAck(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	opts := &RequestOptions{Ack: true, Retries: 3, Backoff: time.Millisecond}
+
+	//前两次没有回复, 第三次确认, 重试使用相同的消息ID
+	remote := newAckRemote(t, 2, "")
+	defer remote.Close()
+	res, e := Request(context.Background(), remote.ID(), "/mp2p/test/ack", []byte("hello"), opts)
+	if e != nil || string(res) != "hello" {
+		t.Fatal("重试后应收到确认:", string(res), e)
+	}
+	if attempts, ids := remote.counts(); attempts != 3 || ids != 1 {
+		t.Fatal("应发送3次, 消息ID不变:", attempts, ids)
+	}
+
+	//一直没有回复, 用尽重试次数
+	remote = newAckRemote(t, 100, "")
+	defer remote.Close()
+	_, e = Request(context.Background(), remote.ID(), "/mp2p/test/ack", []byte("hello"), opts)
+	if !errors.Is(e, ErrRequestNoAck) {
+		t.Fatal("用尽重试次数应返回ErrRequestNoAck:", e)
+	}
+	if attempts, _ := remote.counts(); attempts != 4 {
+		t.Fatal("应发送1次并重试3次:", attempts)
+	}
+
+	//对方处理出错时不重试
+	remote = newAckRemote(t, 0, "处理失败")
+	defer remote.Close()
+	_, e = Request(context.Background(), remote.ID(), "/mp2p/test/ack", []byte("hello"), opts)
+	var remoteErr *RemoteError
+	if !errors.As(e, &remoteErr) || remoteErr.Message != "处理失败" {
+		t.Fatal("应返回对方的错误:", e)
+	}
+	if attempts, _ := remote.counts(); attempts != 1 {
+		t.Fatal("对方处理出错时不应重试:", attempts)
+	}
+}
+
+func TestRequestHandlerPipelined(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	SetRequestHandler("/mp2p/test/pipelined", func(from peer.ID, msgID string, data []byte) ([]byte, error) {
+		return data, nil
+	})
+
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer remote.Close()
+	remote.Peerstore().AddAddrs(node.ID(), node.Addrs(), peerstore.TempAddrTTL)
+
+	//一次写入多条请求, 每条都应回复
+	s, e := remote.NewStream(ctx, node.ID(), "/mp2p/test/pipelined")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer s.Close()
+	var lines []string
+	for _, data := range []string{"a", "b", "c"} {
+		b, _ := json.Marshal(requestMessage{ID: data, Data: []byte(data)})
+		lines = append(lines, string(b), "\n")
+	}
+	if _, e = s.Write([]byte(strings.Join(lines, ""))); e != nil {
+		t.Fatal(e)
+	}
+	_ = s.SetReadDeadline(time.Now().Add(time.Second * 5))
+	reader := bufio.NewReader(s)
+	for _, data := range []string{"a", "b", "c"} {
+		text, e := readTextFromReader(reader)
+		if e != nil {
+			t.Fatal("应收到回复:", data, e)
+		}
+		var res requestMessage
+		if e = json.Unmarshal([]byte(text), &res); e != nil || res.ID != data || string(res.Data) != data {
+			t.Fatal("回复错误:", text, e)
+		}
+	}
+}
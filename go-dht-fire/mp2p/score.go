@@ -0,0 +1,87 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/peer"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	SCORE_ALPHA   = 0.3 //连接成功率EWMA系数, 越大越看重最近的结果
+	SCORE_INITIAL = 0.5 //未知节点的分数
+)
+
+// 节点分数
+type peerScore struct {
+	score     float64       //连接成功率EWMA, 0到1
+	successes int           //成功次数
+	failures  int           //失败次数
+	latency   time.Duration //连接耗时EWMA
+}
+
+var scoreLock sync.RWMutex
+var scoreMap = make(map[peer.ID]*peerScore)
+
+// 记录连接结果
+func recordConnect(id peer.ID, ok bool, latency time.Duration) {
+	scoreLock.Lock()
+	defer scoreLock.Unlock()
+
+	ps, exists := scoreMap[id]
+	if !exists {
+		ps = &peerScore{score: SCORE_INITIAL}
+		scoreMap[id] = ps
+	}
+
+	result := 0.0
+	if ok {
+		result = 1
+		ps.successes++
+		if ps.latency == 0 {
+			ps.latency = latency
+		} else {
+			ps.latency = time.Duration(SCORE_ALPHA*float64(latency) + (1-SCORE_ALPHA)*float64(ps.latency))
+		}
+	} else {
+		ps.failures++
+	}
+	ps.score = SCORE_ALPHA*result + (1-SCORE_ALPHA)*ps.score
+}
+
+// 获取节点分数
+// 分数为连接成功率的EWMA, 0到1, 未知节点为SCORE_INITIAL.
+func PeerScore(id peer.ID) float64 {
+	scoreLock.RLock()
+	defer scoreLock.RUnlock()
+
+	ps, exists := scoreMap[id]
+	if !exists {
+		return SCORE_INITIAL
+	}
+	return ps.score
+}
+
+// 获取节点连接耗时EWMA, 未知时为0
+func peerLatency(id peer.ID) time.Duration {
+	scoreLock.RLock()
+	defer scoreLock.RUnlock()
+
+	ps, exists := scoreMap[id]
+	if !exists {
+		return 0
+	}
+	return ps.latency
+}
+
+// 按分数从高到低排序地址信息, 分数相同时连接耗时短的在前
+func sortByScore(ais []*peer.AddrInfo) {
+	sort.SliceStable(ais, func(i, j int) bool {
+		si, sj := PeerScore(ais[i].ID), PeerScore(ais[j].ID)
+		if si != sj {
+			return si > sj
+		}
+		li, lj := peerLatency(ais[i].ID), peerLatency(ais[j].ID)
+		return li != 0 && (lj == 0 || li < lj)
+	})
+}
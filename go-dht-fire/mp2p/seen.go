@@ -0,0 +1,104 @@
+package mp2p
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_SEEN_CACHE_SIZE = 10000
+	DEFAULT_SEEN_CACHE_TTL  = time.Minute * 2
+)
+
+// 已见消息缓存, 用于转发消息去重
+// 超过TTL的消息视为未见, 超过容量时移除最早的消息.
+type seenCache struct {
+	lock    sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List //最早的在前
+}
+
+type seenEntry struct {
+	id string
+	ts time.Time
+}
+
+// 创建已见消息缓存, size和ttl不大于0时使用默认值
+func newSeenCache(size int, ttl time.Duration) *seenCache {
+	if size <= 0 {
+		size = DEFAULT_SEEN_CACHE_SIZE
+	}
+	if ttl <= 0 {
+		ttl = DEFAULT_SEEN_CACHE_TTL
+	}
+	return &seenCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// 计算消息ID
+func messageID(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// 记录消息, 已经见过(TTL内)时返回true, 调用方应丢弃该消息
+func (c *seenCache) seen(id string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := clock.Now()
+	c.expire(now)
+
+	if _, exists := c.entries[id]; exists {
+		return true
+	}
+
+	c.entries[id] = c.order.PushBack(&seenEntry{id: id, ts: now})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Front())
+	}
+	return false
+}
+
+// 移除过期消息
+func (c *seenCache) expire(now time.Time) {
+	for el := c.order.Front(); el != nil; el = c.order.Front() {
+		if now.Sub(el.Value.(*seenEntry).ts) < c.ttl {
+			return
+		}
+		c.remove(el)
+	}
+}
+
+// 缓存的消息数量
+func (c *seenCache) len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.order.Len()
+}
+
+func (c *seenCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*seenEntry).id)
+}
+
+var seenMessages = newSeenCache(0, 0)
+
+// 消息去重, 已经处理或转发过的消息返回true
+// 处理或转发消息前调用, 返回true时丢弃. 按消息ID去重, 没有ID时按数据的哈希.
+func dropDuplicate(msg requestMessage) bool {
+	id := msg.ID
+	if id == "" {
+		id = messageID(msg.Data)
+	}
+	return seenMessages.seen(id)
+}
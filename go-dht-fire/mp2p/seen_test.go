@@ -0,0 +1,53 @@
+package mp2p
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDropDuplicate(t *testing.T) {
+	seenMessages = newSeenCache(0, 0)
+
+	msg := requestMessage{ID: newMessageID(), Data: []byte("你好")}
+	if dropDuplicate(msg) {
+		t.Fatal("第一次转发不应丢弃")
+	}
+	if !dropDuplicate(msg) {
+		t.Fatal("第二次转发应丢弃")
+	}
+	if dropDuplicate(requestMessage{ID: newMessageID(), Data: []byte("你好")}) {
+		t.Fatal("不同消息不应丢弃")
+	}
+
+	//没有ID时按数据去重
+	if dropDuplicate(requestMessage{Data: []byte("另一条")}) || !dropDuplicate(requestMessage{Data: []byte("另一条")}) {
+		t.Fatal("没有ID的相同数据应丢弃")
+	}
+	if dropDuplicate(requestMessage{Data: []byte("第三条")}) {
+		t.Fatal("没有ID的不同数据不应丢弃")
+	}
+}
+
+func TestSeenCacheTTL(t *testing.T) {
+	c := newSeenCache(10, time.Millisecond*10)
+	if c.seen("a") {
+		t.Fatal("第一次不应见过")
+	}
+	time.Sleep(time.Millisecond * 20)
+	if c.seen("a") {
+		t.Fatal("过期后不应见过")
+	}
+}
+
+func TestSeenCacheSize(t *testing.T) {
+	c := newSeenCache(2, time.Minute)
+	c.seen("a")
+	c.seen("b")
+	c.seen("c")
+	if c.seen("a") {
+		t.Fatal("超过容量时应移除最早的消息")
+	}
+	if !c.seen("c") {
+		t.Fatal("最近的消息应保留")
+	}
+}
@@ -0,0 +1,92 @@
+package mp2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/libp2p/go-libp2p-autonat"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"sync"
+	"time"
+)
+
+const (
+	SELF_DIAL_TIMEOUT = time.Second * 30 //每个节点回拨的超时时间, 对方回拨失败时会等到它自己的超时
+)
+
+var ErrNoAutoNATPeer = errors.New("没有支持AutoNAT的已连接节点")
+
+// 可达性自检结果
+type SelfDialResult struct {
+	Time      time.Time `json:"time"`             //检查时间
+	Reachable bool      `json:"reachable"`        //外部节点能否连接到自己
+	Addr      string    `json:"addr,omitempty"`   //回拨成功的地址
+	Prober    string    `json:"prober,omitempty"` //最后回拨的节点ID
+	Error     string    `json:"error,omitempty"`  //不可达时的原因
+}
+
+var selfDialLock sync.Mutex
+var lastSelfDial *SelfDialResult
+
+// 可达性自检, 确认外部节点能通过宣告地址连接到自己
+// 请已连接的支持AutoNAT服务的节点(mp2p节点都运行该服务)回拨节点地址, 返回回拨成功的地址. 逐个尝试, 全部失败时返回最后的错误.
+// AutoNAT服务只回拨公网地址, 而且只回拨与连接来源相同的IP. 结果记录在Status.Reachability中.
+func SelfDialTest(ctx context.Context) (multiaddr.Multiaddr, error) {
+	client := autonat.NewAutoNATClient(node, nil)
+	result := SelfDialResult{}
+	var lastErr error = ErrNoAutoNATPeer
+	for _, id := range autoNATPeers() {
+		result.Prober = id.String()
+		dialCtx, dialCancel := context.WithTimeout(ctx, SELF_DIAL_TIMEOUT)
+		ma, e := client.DialBack(dialCtx, id)
+		dialCancel()
+		if e == nil {
+			result.Reachable = true
+			result.Addr = ma.String()
+			recordSelfDial(result)
+			logMsg("selfdial.reachable", ma, id.String())
+			return ma, nil
+		}
+		lastErr = fmt.Errorf("%s回拨出错: %w", id, e)
+		logMsg("selfdial.failed", id.String(), e)
+		if ctx.Err() != nil {
+			lastErr = ctx.Err()
+			break
+		}
+	}
+	result.Error = lastErr.Error()
+	recordSelfDial(result)
+	return nil, lastErr
+}
+
+// 已连接的支持AutoNAT服务的节点
+func autoNATPeers() []peer.ID {
+	var ids []peer.ID
+	for _, id := range node.Network().Peers() {
+		protocols, e := node.Peerstore().SupportsProtocols(id, autonat.AutoNATProto)
+		if e == nil && len(protocols) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// 记录自检结果
+func recordSelfDial(result SelfDialResult) {
+	result.Time = clock.Now()
+	selfDialLock.Lock()
+	lastSelfDial = &result
+	selfDialLock.Unlock()
+}
+
+// 最近一次自检结果, 没有检查过时为nil
+func lastSelfDialResult() *SelfDialResult {
+	selfDialLock.Lock()
+	defer selfDialLock.Unlock()
+	if lastSelfDial == nil {
+		return nil
+	}
+	result := *lastSelfDial
+	return &result
+}
@@ -0,0 +1,57 @@
+package mp2p
+
+import (
+	"context"
+	"errors"
+	"github.com/libp2p/go-libp2p"
+	autonat "github.com/libp2p/go-libp2p-autonat-svc"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"testing"
+	"time"
+)
+
+func TestSelfDialTest(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	defer func() {
+		lastSelfDial = nil
+	}()
+
+	if _, e := SelfDialTest(context.Background()); !errors.Is(e, ErrNoAutoNATPeer) {
+		t.Fatal("没有AutoNAT节点时应返回ErrNoAutoNATPeer:", e)
+	}
+	result := lastSelfDialResult()
+	if result == nil || result.Reachable || result.Error == "" {
+		t.Fatal("应记录不可达结果:", result)
+	}
+
+	//AutoNAT服务不回拨回环地址, 回拨失败
+	prober, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer prober.Close()
+	_, e = autonat.NewAutoNATService(ctx, prober, libp2p.DefaultTransports)
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = node.Connect(ctx, peer.AddrInfo{ID: prober.ID(), Addrs: prober.Addrs()})
+	if e != nil {
+		t.Fatal(e)
+	}
+	//等待标识交换得到对方的协议
+	deadline := time.Now().Add(time.Second * 5)
+	for len(autoNATPeers()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("应发现支持AutoNAT的节点")
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	if _, e = SelfDialTest(context.Background()); e == nil || errors.Is(e, ErrNoAutoNATPeer) {
+		t.Fatal("回拨回环地址应失败:", e)
+	}
+	if status := GetStatus(); status.Reachability == nil || status.Reachability.Reachable || status.Reachability.Prober != prober.ID().String() {
+		t.Fatal("状态应包含自检结果:", status.Reachability)
+	}
+}
@@ -0,0 +1,160 @@
+package mp2p
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"sync"
+	"time"
+)
+
+const (
+	SEND_QUEUE_IDLE_TIMEOUT = time.Minute //发送队列空闲多久后关闭流并退出
+)
+
+// 发送队列的键, 每个节点的每个协议一个队列
+type sendQueueKey struct {
+	peer  peer.ID
+	proto protocol.ID
+}
+
+// 排队的请求
+type queuedRequest struct {
+	ctx      context.Context
+	req      requestMessage
+	deadline StreamDeadline
+	result   chan queuedResult
+}
+
+type queuedResult struct {
+	data []byte
+	e    error
+}
+
+// 发送队列
+// 同一节点同一协议的有序请求按进入队列的顺序通过一个长期的流逐个发送, 收到回复后再发送下一个.
+type sendQueue struct {
+	key     sendQueueKey
+	ch      chan *queuedRequest
+	pending int //已进入队列还没有被取出的请求数量, 大于0时队列不会退出
+	stream  network.Stream
+	reader  *bufio.Reader //与stream对应, 整个流使用同一个reader
+}
+
+var sendQueueLock sync.Mutex
+var sendQueues = make(map[sendQueueKey]*sendQueue)
+
+// 通过发送队列请求, 返回回复数据
+func requestOrdered(ctx context.Context, id peer.ID, proto protocol.ID, req requestMessage, deadline StreamDeadline) ([]byte, error) {
+	item := &queuedRequest{ctx: ctx, req: req, deadline: deadline, result: make(chan queuedResult, 1)}
+	key := sendQueueKey{peer: id, proto: proto}
+
+	sendQueueLock.Lock()
+	q, exists := sendQueues[key]
+	if !exists {
+		q = &sendQueue{key: key, ch: make(chan *queuedRequest)}
+		sendQueues[key] = q
+		go q.run()
+	}
+	q.pending++
+	sendQueueLock.Unlock()
+
+	select {
+	case q.ch <- item:
+	case <-ctx.Done():
+		sendQueueLock.Lock()
+		q.pending--
+		sendQueueLock.Unlock()
+		return nil, ctx.Err()
+	}
+
+	select {
+	case r := <-item.result:
+		return r.data, r.e
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// 逐个发送请求, 空闲超时后退出
+func (q *sendQueue) run() {
+	defer func() {
+		if q.stream != nil {
+			_ = q.stream.Close()
+		}
+	}()
+	for {
+		select {
+		case item := <-q.ch:
+			sendQueueLock.Lock()
+			q.pending--
+			sendQueueLock.Unlock()
+
+			//调用方已放弃的请求不再发送
+			if item.ctx.Err() != nil {
+				continue
+			}
+			data, e := q.send(item)
+			item.result <- queuedResult{data: data, e: e}
+		case <-clock.After(SEND_QUEUE_IDLE_TIMEOUT):
+			sendQueueLock.Lock()
+			if q.pending == 0 {
+				delete(sendQueues, q.key)
+				sendQueueLock.Unlock()
+				return
+			}
+			sendQueueLock.Unlock()
+		}
+	}
+}
+
+// 在队列的流中发送一个请求并等待回复, 出错时重置流, 下一个请求重新打开
+func (q *sendQueue) send(item *queuedRequest) ([]byte, error) {
+	if q.stream == nil {
+		streamCtx, streamCancel := context.WithTimeout(item.ctx, item.deadline.Write)
+		s, e := node.NewStream(streamCtx, q.key.peer, q.key.proto)
+		streamCancel()
+		if e != nil {
+			return nil, e
+		}
+		q.stream = s
+		q.reader = bufio.NewReader(s)
+	}
+	s := q.stream
+	_ = s.SetWriteDeadline(time.Now().Add(item.deadline.Write))
+
+	res, e := func() (requestMessage, error) {
+		var res requestMessage
+		e := writeJSONToStream(s, item.req)
+		if e != nil {
+			return res, e
+		}
+		_ = s.SetReadDeadline(time.Now().Add(item.deadline.Read))
+		text, e := readTextFromReader(q.reader)
+		if e != nil {
+			return res, e
+		}
+		e = json.Unmarshal([]byte(text), &res)
+		if e != nil {
+			return res, e
+		}
+		if res.ID != item.req.ID {
+			return res, fmt.Errorf("回复的消息ID错误: %s", res.ID)
+		}
+		return res, verifyReply(q.key.proto, item.req, res, q.key.peer)
+	}()
+	if e != nil {
+		_ = s.Reset()
+		q.stream = nil
+		q.reader = nil
+		return nil, e
+	}
+	if res.Error != "" {
+		return nil, &RemoteError{Message: res.Error}
+	}
+	return res.Data, nil
+}
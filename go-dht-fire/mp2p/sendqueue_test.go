@@ -0,0 +1,95 @@
+package mp2p
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRequestOrdered(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer remote.Close()
+	node.Peerstore().AddAddrs(remote.ID(), remote.Addrs(), peerstore.TempAddrTTL)
+
+	//远程节点按收到的顺序记录消息, 回复原数据
+	var lock sync.Mutex
+	var received []string
+	streams := 0
+	remote.SetStreamHandler("/mp2p/test/ordered", func(s network.Stream) {
+		defer s.Close()
+		lock.Lock()
+		streams++
+		lock.Unlock()
+		for {
+			text, e := readTextFormStream(s)
+			if e != nil {
+				return
+			}
+			var req requestMessage
+			if json.Unmarshal([]byte(text), &req) != nil {
+				return
+			}
+			lock.Lock()
+			received = append(received, string(req.Data))
+			lock.Unlock()
+			if writeJSONToStream(s, requestMessage{ID: req.ID, Data: req.Data}) != nil {
+				return
+			}
+		}
+	})
+
+	//多个协程同时发送, 每个协程的消息有序
+	const senders, messages = 5, 20
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(sender int) {
+			defer wg.Done()
+			for j := 0; j < messages; j++ {
+				data := []byte(fmt.Sprintf("%d-%d", sender, j))
+				res, e := Request(context.Background(), remote.ID(), "/mp2p/test/ordered", data, &RequestOptions{Ordered: true})
+				if e != nil {
+					t.Error(e)
+					return
+				}
+				if string(res) != string(data) {
+					t.Error("回复错误:", string(res))
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if streams != 1 {
+		t.Fatal("有序请求应使用一个流:", streams)
+	}
+	if len(received) != senders*messages {
+		t.Fatal("消息数量错误:", len(received))
+	}
+	next := make([]int, senders)
+	for _, text := range received {
+		parts := strings.Split(text, "-")
+		sender, _ := strconv.Atoi(parts[0])
+		j, _ := strconv.Atoi(parts[1])
+		if j != next[sender] {
+			t.Fatal("消息顺序错误:", received)
+		}
+		next[sender]++
+	}
+}
@@ -0,0 +1,116 @@
+package mp2p
+
+import (
+	"context"
+	"errors"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"strings"
+	"sync"
+)
+
+const (
+	PROTOCOL_CHANNEL_PREFIX = "/mp2p/channel/"
+)
+
+var (
+	ErrSessionClosed = errors.New("会话已关闭")
+	ErrChannelExists = errors.New("通道已打开")
+)
+
+// 会话, 同一节点的多个命名通道
+// 每个通道是一个独立的流, 协议ID为 PROTOCOL_CHANNEL_PREFIX + 名称, 会话关闭时一起关闭.
+type Session struct {
+	ctx      context.Context
+	peer     peer.ID
+	lock     sync.Mutex
+	channels map[string]network.Stream
+	closed   bool
+}
+
+// 获取通道协议ID
+func ChannelProtocol(name string) protocol.ID {
+	return protocol.ID(strings.Join([]string{PROTOCOL_CHANNEL_PREFIX, name}, ""))
+}
+
+// 设置通道处理
+func SetChannelHandler(name string, handler network.StreamHandler) {
+	protocols.Register(ChannelProtocol(name), handler)
+}
+
+// 打开会话, 没有连接时先连接节点
+func OpenSession(ctx context.Context, id peer.ID) (*Session, error) {
+	if !IsConnected(id) {
+		e := connect(node.Peerstore().PeerInfo(id))
+		if e != nil {
+			return nil, e
+		}
+	}
+	return &Session{
+		ctx:      ctx,
+		peer:     id,
+		channels: make(map[string]network.Stream),
+	}, nil
+}
+
+// 会话节点
+func (s *Session) Peer() peer.ID {
+	return s.peer
+}
+
+// 打开通道
+func (s *Session) OpenChannel(name string) (network.Stream, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil, ErrSessionClosed
+	}
+	if _, exists := s.channels[name]; exists {
+		return nil, ErrChannelExists
+	}
+
+	stream, e := node.NewStream(s.ctx, s.peer, ChannelProtocol(name))
+	if e != nil {
+		return nil, e
+	}
+	s.channels[name] = stream
+	return stream, nil
+}
+
+// 获取已打开的通道, 没有时返回nil
+func (s *Session) Channel(name string) network.Stream {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.channels[name]
+}
+
+// 关闭通道
+func (s *Session) CloseChannel(name string) error {
+	s.lock.Lock()
+	stream, exists := s.channels[name]
+	delete(s.channels, name)
+	s.lock.Unlock()
+	if !exists {
+		return nil
+	}
+	return stream.Close()
+}
+
+// 关闭会话和所有通道, 返回第一个错误
+func (s *Session) Close() error {
+	s.lock.Lock()
+	channels := s.channels
+	s.channels = make(map[string]network.Stream)
+	s.closed = true
+	s.lock.Unlock()
+
+	var err error
+	for _, stream := range channels {
+		e := stream.Close()
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package mp2p
+
+import (
+	"context"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSessionChannels(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer remote.Close()
+
+	//远程节点回复通道名称
+	names := []string{"chat", "file", "control"}
+	for _, name := range names {
+		name := name
+		remote.SetStreamHandler(ChannelProtocol(name), func(s network.Stream) {
+			_, _ = s.Write([]byte(name))
+			_ = s.Close()
+		})
+	}
+	node.Peerstore().AddAddrs(remote.ID(), remote.Addrs(), peerstore.TempAddrTTL)
+
+	session, e := OpenSession(context.Background(), remote.ID())
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, name := range names {
+		s, e := session.OpenChannel(name)
+		if e != nil {
+			t.Fatal(e)
+		}
+		data, e := ioutil.ReadAll(s)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if string(data) != name {
+			t.Fatal("通道数据错误:", name, string(data))
+		}
+	}
+	if _, e = session.OpenChannel("chat"); e != ErrChannelExists {
+		t.Fatal("重复打开通道应返回ErrChannelExists:", e)
+	}
+
+	e = session.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, name := range names {
+		if session.Channel(name) != nil {
+			t.Fatal("会话关闭后通道应关闭:", name)
+		}
+	}
+	if _, e = session.OpenChannel("chat"); e != ErrSessionClosed {
+		t.Fatal("会话关闭后应返回ErrSessionClosed:", e)
+	}
+}
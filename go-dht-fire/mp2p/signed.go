@@ -0,0 +1,115 @@
+package mp2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"strings"
+)
+
+const (
+	SIGNATURE_DOMAIN = "mp2p-signed-message:" //签名内容的前缀, 防止签名被当作其它用途的签名
+)
+
+var ErrUnverified = errors.New("消息签名验证失败")
+
+// 签名内容: 前缀, 协议, 消息ID和数据
+// 包含协议和消息ID, 签名不能用于其它协议或其它消息.
+func signingBytes(proto protocol.ID, msgID string, data []byte) []byte {
+	prefix := strings.Join([]string{SIGNATURE_DOMAIN, string(proto), "\n", msgID, "\n"}, "")
+	return append([]byte(prefix), data...)
+}
+
+// 使用节点私钥签名消息, 设置From和Sig
+func signMessage(proto protocol.ID, msg *requestMessage) error {
+	key := node.Peerstore().PrivKey(node.ID())
+	if key == nil {
+		return fmt.Errorf("%w: 没有节点私钥", ErrUnverified)
+	}
+	sig, e := key.Sign(signingBytes(proto, msg.ID, msg.Data))
+	if e != nil {
+		return e
+	}
+	msg.From = node.ID().String()
+	msg.Sig = sig
+	return nil
+}
+
+// 验证消息签名, 返回签名的节点
+// 公钥从节点存储获取(没有时从节点ID中提取, 如Ed25519), 没有签名, 没有公钥或签名错误时返回ErrUnverified.
+func verifyMessage(proto protocol.ID, msg requestMessage) (peer.ID, error) {
+	if msg.From == "" || len(msg.Sig) == 0 {
+		return "", fmt.Errorf("%w: 没有签名", ErrUnverified)
+	}
+	from, e := peer.Decode(msg.From)
+	if e != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnverified, e)
+	}
+	key := node.Peerstore().PubKey(from)
+	if key == nil {
+		return "", fmt.Errorf("%w: 没有节点公钥 %s", ErrUnverified, from)
+	}
+	ok, e := key.Verify(signingBytes(proto, msg.ID, msg.Data), msg.Sig)
+	if e != nil || !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnverified, from)
+	}
+	return from, nil
+}
+
+// 验证回复由请求的节点签名, 请求没有签名时不验证
+func verifyReply(proto protocol.ID, req requestMessage, res requestMessage, id peer.ID) error {
+	if len(req.Sig) == 0 {
+		return nil
+	}
+	from, e := verifyMessage(proto, res)
+	if e != nil {
+		return e
+	}
+	if from != id {
+		return fmt.Errorf("%w: 回复的签名节点 %s 不是 %s", ErrUnverified, from, id)
+	}
+	return nil
+}
+
+// 设置签名请求处理, 只处理签名正确的请求(VerifiedRequest), 回复同样签名
+// handler的from为签名的节点. 没有签名或签名错误的请求记录日志并重置流.
+func SetVerifiedRequestHandler(proto protocol.ID, handler RequestHandler) {
+	setRequestHandler(proto, handler, true)
+}
+
+// 签名请求, 使用节点私钥签名请求并验证回复由id签名
+// 对方需要使用SetVerifiedRequestHandler. 回复没有签名或签名错误时返回ErrUnverified, 其它同Request.
+func VerifiedRequest(ctx context.Context, id peer.ID, proto protocol.ID, data []byte, opts *RequestOptions) ([]byte, error) {
+	req := requestMessage{ID: newMessageID(), Data: data}
+	e := signMessage(proto, &req)
+	if e != nil {
+		return nil, e
+	}
+	return request(ctx, id, proto, req, opts)
+}
+
+// 设置签名广播处理, 只处理签名正确的消息(VerifiedBroadcast), 重复的消息被丢弃
+// handler的from为签名的节点(消息的作者), 经过其它节点转发时也不变. 没有签名或签名错误的消息记录日志并重置流.
+func SetVerifiedBroadcastHandler(proto protocol.ID, handler BroadcastHandler) {
+	setBroadcastHandler(proto, handler, true)
+}
+
+// 签名广播, 使用节点私钥签名消息, 接收方据此验证消息来自本节点且没有被修改
+// 对方需要使用SetVerifiedBroadcastHandler. 签名失败时所有节点的结果都是该错误, 其它同Broadcast.
+func VerifiedBroadcast(ctx context.Context, ids []peer.ID, proto protocol.ID, data []byte, opts *BroadcastOptions) []BroadcastResult {
+	msg := requestMessage{ID: newMessageID(), Data: data}
+	e := signMessage(proto, &msg)
+	if e != nil {
+		if len(ids) == 0 {
+			ids = node.Network().Peers()
+		}
+		results := make([]BroadcastResult, len(ids))
+		for i, id := range ids {
+			results[i] = BroadcastResult{Peer: id, Err: e}
+		}
+		return results
+	}
+	return broadcast(ctx, ids, proto, msg, opts)
+}
@@ -0,0 +1,148 @@
+package mp2p
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"testing"
+)
+
+// 用h的私钥签名消息
+func signWith(t *testing.T, h host.Host, proto protocol.ID, msg *requestMessage) {
+	sig, e := h.Peerstore().PrivKey(h.ID()).Sign(signingBytes(proto, msg.ID, msg.Data))
+	if e != nil {
+		t.Fatal(e)
+	}
+	msg.From = h.ID().String()
+	msg.Sig = sig
+}
+
+func TestVerifiedRequestHandler(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	const proto = protocol.ID("/mp2p/test/signed")
+
+	var from peer.ID
+	SetVerifiedRequestHandler(proto, func(id peer.ID, msgID string, data []byte) ([]byte, error) {
+		from = id
+		return data, nil
+	})
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer remote.Close()
+	remote.Peerstore().AddAddrs(node.ID(), node.Addrs(), peerstore.TempAddrTTL)
+
+	send := func(req requestMessage) (requestMessage, error) {
+		var res requestMessage
+		s, e := remote.NewStream(ctx, node.ID(), proto)
+		if e != nil {
+			return res, e
+		}
+		defer s.Close()
+		if e = writeJSONToStream(s, req); e != nil {
+			return res, e
+		}
+		text, e := readTextFormStream(s)
+		if e != nil {
+			return res, e
+		}
+		return res, json.Unmarshal([]byte(text), &res)
+	}
+
+	//签名正确时处理, 回复由节点签名
+	req := requestMessage{ID: newMessageID(), Data: []byte("hello")}
+	signWith(t, remote, proto, &req)
+	res, e := send(req)
+	if e != nil || string(res.Data) != "hello" || from != remote.ID() {
+		t.Fatal("签名正确的请求应处理:", string(res.Data), from, e)
+	}
+	if e = verifyReply(proto, req, res, node.ID()); e != nil {
+		t.Fatal("回复应由节点签名:", e)
+	}
+
+	//没有签名或数据被修改时拒绝
+	if _, e = send(requestMessage{ID: newMessageID(), Data: []byte("hello")}); e == nil {
+		t.Fatal("没有签名的请求应被拒绝")
+	}
+	req.Data = []byte("changed")
+	if _, e = send(req); e == nil {
+		t.Fatal("数据被修改的请求应被拒绝")
+	}
+
+	//签名不能用于其它协议
+	other := requestMessage{ID: newMessageID(), Data: []byte("hello")}
+	signWith(t, remote, "/mp2p/test/other", &other)
+	if _, e = send(other); e == nil {
+		t.Fatal("其它协议的签名应被拒绝")
+	}
+}
+
+func TestVerifiedRequestReply(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	const proto = protocol.ID("/mp2p/test/signed")
+
+	//对方回复没有签名
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer remote.Close()
+	remote.SetStreamHandler(proto, func(s network.Stream) {
+		defer s.Close()
+		text, _ := readTextFormStream(s)
+		var req requestMessage
+		_ = json.Unmarshal([]byte(text), &req)
+		_ = writeJSONToStream(s, requestMessage{ID: req.ID, Data: req.Data})
+	})
+	node.Peerstore().AddAddrs(remote.ID(), remote.Addrs(), peerstore.TempAddrTTL)
+
+	if _, e = VerifiedRequest(ctx, remote.ID(), proto, []byte("hello"), nil); !errors.Is(e, ErrUnverified) {
+		t.Fatal("回复没有签名时应出错:", e)
+	}
+	if data, e := Request(ctx, remote.ID(), proto, []byte("hello"), nil); e != nil || string(data) != "hello" {
+		t.Fatal("普通请求不验证回复:", string(data), e)
+	}
+}
+
+func TestVerifiedBroadcast(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	seenMessages = newSeenCache(0, 0)
+	const proto = protocol.ID("/mp2p/test/signed-broadcast")
+
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer remote.Close()
+	received := make(chan requestMessage, 1)
+	remote.SetStreamHandler(proto, func(s network.Stream) {
+		defer s.Close()
+		text, _ := readTextFormStream(s)
+		var msg requestMessage
+		_ = json.Unmarshal([]byte(text), &msg)
+		received <- msg
+	})
+	node.Peerstore().AddAddrs(remote.ID(), remote.Addrs(), peerstore.TempAddrTTL)
+
+	results := VerifiedBroadcast(ctx, []peer.ID{remote.ID()}, proto, []byte("hello"), nil)
+	if results[0].Err != nil {
+		t.Fatal(results[0].Err)
+	}
+	msg := <-received
+	if from, e := verifyMessage(proto, msg); e != nil || from != node.ID() {
+		t.Fatal("签名广播应能验证:", from, e)
+	}
+	msg.Data = []byte("changed")
+	if _, e = verifyMessage(proto, msg); !errors.Is(e, ErrUnverified) {
+		t.Fatal("数据被修改时验证应失败:", e)
+	}
+}
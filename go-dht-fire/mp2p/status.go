@@ -0,0 +1,113 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"sort"
+)
+
+// 节点状态
+type Status struct {
+	Version          string    `json:"version"`           //mp2p版本
+	ID               string    `json:"id"`                //节点ID
+	ListenAddrs      []string  `json:"listen_addrs"`      //监听地址
+	AdvertisedAddrs  []string  `json:"advertised_addrs"`  //宣告的节点地址
+	ConnectedPeers   int       `json:"connected_peers"`   //已连接节点数量
+	KnownPeers       int       `json:"known_peers"`       //缓存的节点数量
+	UnconnectedPeers int       `json:"unconnected_peers"` //已知但当前未连接的节点数量
+	DHTPeers         int       `json:"dht_peers"`         //DHT路由表节点数量
+	DroppedEvents    uint64    `json:"dropped_events"`    //因缓冲满丢弃的事件数量(按Config.EventDropPolicy)
+	DiscoveryPaused  bool      `json:"discovery_paused"`  //是否暂停了发现新节点(PauseDiscovery)
+	ConnectTimes     Histogram `json:"connect_times"`     //连接耗时(拨号到连接完成)
+	OpenBreakers     int       `json:"open_breakers"`     //连续拨号失败而熔断的节点数量(CircuitBreakers)
+
+	Memory    MemoryUsage                   `json:"memory"`    //mp2p记录占用的内存(估计值)
+	Bandwidth map[protocol.ID]metrics.Stats `json:"bandwidth"` //各协议的带宽(ProtocolBandwidth)
+
+	Reachability *SelfDialResult `json:"reachability,omitempty"` //最近一次可达性自检(SelfDialTest)结果
+}
+
+// 获取节点状态
+func GetStatus() Status {
+	status := Status{
+		Version:         Version(),
+		ID:              node.ID().String(),
+		AdvertisedAddrs: advertisedAddrs(),
+		ConnectedPeers:  len(node.Network().Peers()),
+		DroppedEvents:   DroppedEvents(),
+		DiscoveryPaused: DiscoveryPaused(),
+		ConnectTimes:    ConnectHistogram(),
+		OpenBreakers:    openBreakerCount(),
+		Reachability:    lastSelfDialResult(),
+		Memory:          GetMemoryUsage(),
+		Bandwidth:       ProtocolBandwidth(),
+	}
+	for _, ma := range node.Addrs() {
+		status.ListenAddrs = append(status.ListenAddrs, ma.String())
+	}
+	if rt := RoutingTable(); rt != nil {
+		status.DHTPeers = rt.Size()
+	}
+	status.UnconnectedPeers, _ = PeerStateCounts()
+	sm.RLock()
+	status.KnownPeers = len(peerMap)
+	sm.RUnlock()
+	return status
+}
+
+// 网络拓扑中的节点
+type TopologyPeer struct {
+	ID        string   `json:"id"`                   //节点ID
+	Addrs     []string `json:"addrs"`                //连接地址
+	LatencyMs int64    `json:"latency_ms,omitempty"` //延迟(毫秒), 未知时为0
+	InDHT     bool     `json:"in_dht"`               //是否在DHT路由表中
+}
+
+// 本节点看到的网络拓扑
+type TopologyJSON struct {
+	ID       string         `json:"id"`        //本节点ID
+	Peers    []TopologyPeer `json:"peers"`     //已连接节点
+	DHTPeers []string       `json:"dht_peers"` //在DHT路由表中但未直接连接的节点
+}
+
+// 获取网络拓扑快照, 用于可视化
+// 延迟优先使用ping测量的结果, 没有时使用连接耗时.
+func Topology() TopologyJSON {
+	topology := TopologyJSON{ID: node.ID().String()}
+
+	dhtPeers := make(map[peer.ID]bool)
+	if rt := RoutingTable(); rt != nil {
+		for _, id := range rt.ListPeers() {
+			dhtPeers[id] = true
+		}
+	}
+	if rt := LANRoutingTable(); rt != nil {
+		for _, id := range rt.ListPeers() {
+			dhtPeers[id] = true
+		}
+	}
+
+	connected := make(map[peer.ID]bool)
+	for _, id := range node.Network().Peers() {
+		connected[id] = true
+		tp := TopologyPeer{ID: id.String(), InDHT: dhtPeers[id]}
+		for _, conn := range node.Network().ConnsToPeer(id) {
+			tp.Addrs = append(tp.Addrs, conn.RemoteMultiaddr().String())
+		}
+		latency := node.Peerstore().LatencyEWMA(id)
+		if latency == 0 {
+			latency = peerLatency(id)
+		}
+		tp.LatencyMs = latency.Milliseconds()
+		topology.Peers = append(topology.Peers, tp)
+	}
+
+	for id := range dhtPeers {
+		if !connected[id] {
+			topology.DHTPeers = append(topology.DHTPeers, id.String())
+		}
+	}
+	sort.Strings(topology.DHTPeers)
+	return topology
+}
@@ -0,0 +1,112 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_MAX_STREAMS_PER_PEER  = 64
+	DEFAULT_MAX_HANDLERS          = 512         //默认同时执行的协议处理数量
+	DEFAULT_HANDLER_QUEUE_TIMEOUT = time.Second //默认处理已满时的排队时间
+)
+
+// 每个节点正在处理的进入流数量
+var streamLock sync.Mutex
+var inboundStreams = make(map[peer.ID]int)
+
+// 每个节点的最大并发进入流数量
+func maxStreamsPerPeer() int {
+	if config.MaxStreamsPerPeer > 0 {
+		return config.MaxStreamsPerPeer
+	}
+	return DEFAULT_MAX_STREAMS_PER_PEER
+}
+
+// 所有协议处理共用的并发信号量
+var handlerLock sync.Mutex
+var handlerSem = make(chan struct{}, DEFAULT_MAX_HANDLERS)
+var handlerQueueTimeout = DEFAULT_HANDLER_QUEUE_TIMEOUT
+
+// 设置同时执行的协议处理数量和排队时间, 参数不大于0时使用默认值
+// 只应在节点启动前调用, 正在执行的处理仍占用旧的信号量.
+func setHandlerLimit(max int, queueTimeout time.Duration) {
+	if max <= 0 {
+		max = DEFAULT_MAX_HANDLERS
+	}
+	if queueTimeout <= 0 {
+		queueTimeout = DEFAULT_HANDLER_QUEUE_TIMEOUT
+	}
+	handlerLock.Lock()
+	handlerSem = make(chan struct{}, max)
+	handlerQueueTimeout = queueTimeout
+	handlerLock.Unlock()
+}
+
+// 获取处理信号量, 已满时排队等待, 超时返回false
+func acquireHandler() (chan struct{}, bool) {
+	handlerLock.Lock()
+	sem := handlerSem
+	timeout := handlerQueueTimeout
+	handlerLock.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return sem, true
+	default:
+	}
+	select {
+	case sem <- struct{}{}:
+		return sem, true
+	case <-clock.After(timeout):
+		return sem, false
+	}
+}
+
+// 限制每个节点的并发进入流和所有节点的并发处理, 超过上限时重置新的流
+// 每个节点超过上限时立即重置, 防止单个节点占满处理协程; 所有处理超过上限时排队, 排队超时后重置, 防止大量节点同时请求耗尽协程.
+// 用于mp2p自己的协议处理. 排空中的节点直接重置新的流.
+func limitStreams(handler network.StreamHandler) network.StreamHandler {
+	return func(s network.Stream) {
+		id := s.Conn().RemotePeer()
+		wg := beginHandler()
+		if wg == nil {
+			logMsg("streams.draining", id.String())
+			_ = s.Reset()
+			return
+		}
+		defer wg.Done()
+		max := maxStreamsPerPeer()
+
+		streamLock.Lock()
+		if inboundStreams[id] >= max {
+			streamLock.Unlock()
+			logMsg("streams.limit", id.String(), max)
+			_ = s.Reset()
+			return
+		}
+		inboundStreams[id]++
+		streamLock.Unlock()
+
+		defer func() {
+			streamLock.Lock()
+			inboundStreams[id]--
+			if inboundStreams[id] <= 0 {
+				delete(inboundStreams, id)
+			}
+			streamLock.Unlock()
+		}()
+
+		sem, ok := acquireHandler()
+		if !ok {
+			logMsg("streams.handler_limit", id.String(), cap(sem))
+			_ = s.Reset()
+			return
+		}
+		defer func() { <-sem }()
+		applyStreamDeadline(s)
+		handler(s)
+	}
+}
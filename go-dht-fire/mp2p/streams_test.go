@@ -0,0 +1,135 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimitStreams(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	config = Config{MaxStreamsPerPeer: 3}
+	defer func() {
+		config = Config{}
+	}()
+
+	//处理协程阻塞直到测试结束
+	var handling int32
+	release := make(chan struct{})
+	node.SetStreamHandler("/mp2p/test/limit", limitStreams(func(s network.Stream) {
+		atomic.AddInt32(&handling, 1)
+		<-release
+		_ = s.Close()
+	}))
+
+	remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer remote.Close()
+	remote.Peerstore().AddAddrs(node.ID(), node.Addrs(), peerstore.TempAddrTTL)
+
+	var wg sync.WaitGroup
+	var reset int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, e := remote.NewStream(ctx, node.ID(), "/mp2p/test/limit")
+			if e != nil {
+				atomic.AddInt32(&reset, 1)
+				return
+			}
+			//超过上限的流被重置, 读取出错
+			_, _ = s.Write([]byte("a"))
+			_ = s.SetReadDeadline(time.Now().Add(time.Second * 2))
+			_, e = s.Read(make([]byte, 1))
+			if netErr, ok := e.(net.Error); ok && netErr.Timeout() {
+				return
+			}
+			if e != nil {
+				atomic.AddInt32(&reset, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&handling); n != 3 {
+		t.Fatal("同时处理的流数量应为上限3:", n)
+	}
+	if n := atomic.LoadInt32(&reset); n != 7 {
+		t.Fatal("超过上限的流应被重置:", n)
+	}
+	close(release)
+}
+
+func TestLimitHandlers(t *testing.T) {
+	closeNode := newTestNode(t)
+	defer closeNode()
+	setHandlerLimit(4, time.Millisecond*200)
+	defer setHandlerLimit(0, 0)
+
+	//记录同时执行的最大处理数量
+	var running, maxRunning int32
+	release := make(chan struct{})
+	node.SetStreamHandler("/mp2p/test/handlers", limitStreams(func(s network.Stream) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&maxRunning)
+			if n <= old || atomic.CompareAndSwapInt32(&maxRunning, old, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+		_ = s.Close()
+	}))
+
+	//多个节点同时打开流, 每个节点都没有超过自己的上限
+	var wg sync.WaitGroup
+	var reset int32
+	for i := 0; i < 4; i++ {
+		remote, e := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if e != nil {
+			t.Fatal(e)
+		}
+		defer remote.Close()
+		remote.Peerstore().AddAddrs(node.ID(), node.Addrs(), peerstore.TempAddrTTL)
+
+		for j := 0; j < 5; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s, e := remote.NewStream(ctx, node.ID(), "/mp2p/test/handlers")
+				if e != nil {
+					atomic.AddInt32(&reset, 1)
+					return
+				}
+				_, _ = s.Write([]byte("a"))
+				_ = s.SetReadDeadline(time.Now().Add(time.Second * 2))
+				_, e = s.Read(make([]byte, 1))
+				if netErr, ok := e.(net.Error); ok && netErr.Timeout() {
+					return
+				}
+				if e != nil {
+					atomic.AddInt32(&reset, 1)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(release)
+
+	if n := atomic.LoadInt32(&maxRunning); n != 4 {
+		t.Fatal("同时执行的处理数量应为上限4:", n)
+	}
+	if n := atomic.LoadInt32(&reset); n != 16 {
+		t.Fatal("排队超时的流应被重置:", n)
+	}
+}
@@ -0,0 +1,77 @@
+package mp2p
+
+import (
+	"github.com/libp2p/go-libp2p-core/peer"
+	"sync"
+	"time"
+)
+
+// 连接耗时直方图的桶上限(毫秒), 超出最后一个的计入溢出桶
+var connectBucketsMs = []int64{10, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// 直方图桶
+type HistogramBucket struct {
+	LeMs  int64  `json:"le_ms"` //上限(毫秒), -1为无上限
+	Count uint64 `json:"count"` //不大于上限的数量(不累计)
+}
+
+// 直方图
+type Histogram struct {
+	Count   uint64            `json:"count"`
+	SumMs   int64             `json:"sum_ms"`
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+var timingLock sync.Mutex
+var dialStarts = make(map[peer.ID]time.Time) //正在拨号的节点和开始时间
+var connectCounts = make([]uint64, len(connectBucketsMs)+1)
+var connectCount uint64
+var connectSum time.Duration
+
+// 记录开始拨号
+func markDialStart(id peer.ID) {
+	timingLock.Lock()
+	defer timingLock.Unlock()
+	if _, exists := dialStarts[id]; !exists {
+		dialStarts[id] = clock.Now()
+	}
+}
+
+// 记录拨号结束, 连接成功时(网络通知Connected)计入直方图, 失败时只清除开始时间
+// 耗时包括拨号, 加密握手和多路复用协商.
+func markDialEnd(id peer.ID, connected bool) {
+	timingLock.Lock()
+	defer timingLock.Unlock()
+	start, exists := dialStarts[id]
+	if !exists {
+		return
+	}
+	delete(dialStarts, id)
+	if !connected {
+		return
+	}
+
+	d := clock.Now().Sub(start)
+	connectCount++
+	connectSum += d
+	ms := d.Milliseconds()
+	for i, le := range connectBucketsMs {
+		if ms <= le {
+			connectCounts[i]++
+			return
+		}
+	}
+	connectCounts[len(connectBucketsMs)]++
+}
+
+// 获取连接耗时直方图
+func ConnectHistogram() Histogram {
+	timingLock.Lock()
+	defer timingLock.Unlock()
+	h := Histogram{Count: connectCount, SumMs: connectSum.Milliseconds()}
+	for i, le := range connectBucketsMs {
+		h.Buckets = append(h.Buckets, HistogramBucket{LeMs: le, Count: connectCounts[i]})
+	}
+	h.Buckets = append(h.Buckets, HistogramBucket{LeMs: -1, Count: connectCounts[len(connectBucketsMs)]})
+	return h
+}
@@ -0,0 +1,32 @@
+package mp2p
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnectHistogram(t *testing.T) {
+	fc, restore := useFakeClock()
+	defer restore()
+	//直方图是全局的, 其它测试的连接也会计入, 只比较本测试的增量
+	before := ConnectHistogram()
+
+	id := randomPeerID(t)
+	markDialStart(id)
+	fc.Advance(time.Millisecond * 80)
+	markDialEnd(id, true)
+
+	failed := randomPeerID(t)
+	markDialStart(failed)
+	markDialEnd(failed, false)
+
+	h := ConnectHistogram()
+	if h.Count-before.Count != 1 || h.SumMs-before.SumMs != 80 {
+		t.Fatal("直方图数量或总耗时错误:", h.Count-before.Count, h.SumMs-before.SumMs)
+	}
+	for i, b := range h.Buckets {
+		if b.LeMs == 100 && b.Count-before.Buckets[i].Count != 1 {
+			t.Fatal("80毫秒应计入100毫秒的桶:", h.Buckets)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package mp2p
+
+import "syscall"
+
+// 在umask为mask时执行f, 之后恢复原来的umask
+// umask是进程范围的, 只用于创建文件这样短暂的操作.
+func withUmask(mask int, f func()) {
+	old := syscall.Umask(mask)
+	defer syscall.Umask(old)
+	f()
+}
@@ -0,0 +1,6 @@
+package mp2p
+
+// Windows没有umask, 直接执行f
+func withUmask(mask int, f func()) {
+	f()
+}
@@ -0,0 +1,108 @@
+package mp2p
+
+import (
+	"context"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/transport"
+	tptu "github.com/libp2p/go-libp2p-transport-upgrader"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+	"os"
+	"path/filepath"
+)
+
+const (
+	UNIX_SOCKET_MODE = 0600 //套接字文件权限, 只有运行节点的用户可以连接
+)
+
+// Unix域套接字传输, 用于同一主机的进程间通信
+// 连接同样经过加密和多路复用, 与TCP传输相同.
+type unixTransport struct {
+	upgrader *tptu.Upgrader
+}
+
+func newUnixTransport(upgrader *tptu.Upgrader) *unixTransport {
+	return &unixTransport{upgrader: upgrader}
+}
+
+func (t *unixTransport) CanDial(addr multiaddr.Multiaddr) bool {
+	_, e := addr.ValueForProtocol(multiaddr.P_UNIX)
+	return e == nil
+}
+
+func (t *unixTransport) Dial(ctx context.Context, raddr multiaddr.Multiaddr, p peer.ID) (transport.CapableConn, error) {
+	var d manet.Dialer
+	conn, e := d.DialContext(ctx, raddr)
+	if e != nil {
+		return nil, e
+	}
+	return t.upgrader.UpgradeOutbound(ctx, t, conn, p)
+}
+
+// 监听套接字, 创建时文件权限即为UNIX_SOCKET_MODE
+// 先创建再修改权限时, 之间其它用户可以连接, 所以创建时设置umask. 之后仍修改一次权限, 失败时不监听.
+func (t *unixTransport) Listen(laddr multiaddr.Multiaddr) (transport.Listener, error) {
+	path, e := laddr.ValueForProtocol(multiaddr.P_UNIX)
+	if e != nil {
+		return nil, e
+	}
+	var l manet.Listener
+	withUmask(0777&^UNIX_SOCKET_MODE, func() {
+		l, e = manet.Listen(laddr)
+	})
+	if e != nil {
+		return nil, e
+	}
+	e = os.Chmod(path, UNIX_SOCKET_MODE)
+	if e != nil {
+		_ = l.Close()
+		return nil, e
+	}
+	return t.upgrader.UpgradeListener(t, l), nil
+}
+
+func (t *unixTransport) Protocols() []int {
+	return []int{multiaddr.P_UNIX}
+}
+
+func (t *unixTransport) Proxy() bool {
+	return false
+}
+
+// 获取套接字监听地址, 并删除上次异常退出残留的套接字文件
+func unixListenAddr(path string) (string, error) {
+	path, e := filepath.Abs(path)
+	if e != nil {
+		return "", e
+	}
+	info, e := os.Stat(path)
+	if e == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return "", fmt.Errorf("套接字路径已存在且不是套接字: %s", path)
+		}
+		logMsg("unix.remove_stale", path)
+		e = os.Remove(path)
+		if e != nil {
+			return "", e
+		}
+	}
+	ma, e := multiaddr.NewComponent("unix", path)
+	if e != nil {
+		return "", e
+	}
+	return ma.String(), nil
+}
+
+// 删除套接字文件
+func removeUnixSocket(path string) error {
+	path, e := filepath.Abs(path)
+	if e != nil {
+		return e
+	}
+	e = os.Remove(path)
+	if e != nil && !os.IsNotExist(e) {
+		return fmt.Errorf("删除套接字文件出错: %w", e)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package mp2p
+
+import (
+	tptu "github.com/libp2p/go-libp2p-transport-upgrader"
+	"github.com/multiformats/go-multiaddr"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestUnixSocketMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows没有套接字文件权限")
+	}
+	dir, e := ioutil.TempDir("", "mp2p")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	//创建文件时就使用umask的权限, 不需要之后再修改
+	withUmask(0777&^UNIX_SOCKET_MODE, func() {
+		var f *os.File
+		f, e = os.OpenFile(filepath.Join(dir, "file"), os.O_CREATE|os.O_WRONLY, 0666)
+		if e == nil {
+			_ = f.Close()
+		}
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if info, e := os.Stat(filepath.Join(dir, "file")); e != nil || info.Mode().Perm() != UNIX_SOCKET_MODE {
+		t.Fatal("创建时的权限错误:", info.Mode(), e)
+	}
+
+	//进程的umask不限制时, 套接字仍只允许所有者连接
+	addr, e := unixListenAddr(filepath.Join(dir, "mp2p.sock"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	laddr, _ := multiaddr.NewMultiaddr(addr)
+	withUmask(0, func() {
+		l, e := newUnixTransport(&tptu.Upgrader{}).Listen(laddr)
+		if e != nil {
+			t.Fatal(e)
+		}
+		defer l.Close()
+		info, e := os.Stat(filepath.Join(dir, "mp2p.sock"))
+		if e != nil || info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != UNIX_SOCKET_MODE {
+			t.Fatal("套接字权限错误:", info.Mode(), e)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+// OpenTelemetry指标导出
+// 单独的模块, 只有使用OpenTelemetry的程序才依赖它. 指标来自mp2p.CollectMetrics, 与其它导出相同.
+package otelmetrics
+
+import (
+	"context"
+	"github.com/alx696/libp2p/go-dht-fire/mp2p"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"sync"
+)
+
+const (
+	METER_NAME = "github.com/alx696/libp2p/go-dht-fire/mp2p"
+)
+
+// OpenTelemetry导出, 实现mp2p.MetricsExporter
+// 启动时在MeterProvider中注册异步指标, 采集时调用mp2p.CollectMetrics. 导出间隔和目标由MeterProvider的Reader决定.
+type Exporter struct {
+	provider     metric.MeterProvider
+	lock         sync.Mutex
+	registration metric.Registration
+}
+
+// 创建导出, 加入mp2p.Config.MetricsExporters
+func New(provider metric.MeterProvider) *Exporter {
+	return &Exporter{provider: provider}
+}
+
+// 注册指标, 已注册时直接返回nil
+// 指标: mp2p.peers.connected, mp2p.peers.known, mp2p.streams(按protocol), mp2p.bandwidth.in/out(字节, 累计),
+// mp2p.bandwidth.rate.in/out(字节/秒), mp2p.events.dropped.
+func (x *Exporter) Start() error {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	if x.registration != nil {
+		return nil
+	}
+
+	meter := x.provider.Meter(METER_NAME)
+	connected, e := meter.Int64ObservableGauge("mp2p.peers.connected", metric.WithDescription("已连接节点数量"))
+	if e != nil {
+		return e
+	}
+	known, e := meter.Int64ObservableGauge("mp2p.peers.known", metric.WithDescription("缓存的节点数量"))
+	if e != nil {
+		return e
+	}
+	streams, e := meter.Int64ObservableGauge("mp2p.streams", metric.WithDescription("各协议打开的流数量"))
+	if e != nil {
+		return e
+	}
+	bytesIn, e := meter.Int64ObservableCounter("mp2p.bandwidth.in", metric.WithUnit("By"), metric.WithDescription("接收的总字节数"))
+	if e != nil {
+		return e
+	}
+	bytesOut, e := meter.Int64ObservableCounter("mp2p.bandwidth.out", metric.WithUnit("By"), metric.WithDescription("发送的总字节数"))
+	if e != nil {
+		return e
+	}
+	rateIn, e := meter.Float64ObservableGauge("mp2p.bandwidth.rate.in", metric.WithUnit("By/s"), metric.WithDescription("接收速率"))
+	if e != nil {
+		return e
+	}
+	rateOut, e := meter.Float64ObservableGauge("mp2p.bandwidth.rate.out", metric.WithUnit("By/s"), metric.WithDescription("发送速率"))
+	if e != nil {
+		return e
+	}
+	dropped, e := meter.Int64ObservableCounter("mp2p.events.dropped", metric.WithDescription("因缓冲满丢弃的事件数量"))
+	if e != nil {
+		return e
+	}
+
+	x.registration, e = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		m := mp2p.CollectMetrics()
+		o.ObserveInt64(connected, int64(m.ConnectedPeers))
+		o.ObserveInt64(known, int64(m.KnownPeers))
+		for proto, n := range m.Streams {
+			o.ObserveInt64(streams, int64(n), metric.WithAttributes(attribute.String("protocol", string(proto))))
+		}
+		o.ObserveInt64(bytesIn, m.BytesIn)
+		o.ObserveInt64(bytesOut, m.BytesOut)
+		o.ObserveFloat64(rateIn, m.RateIn)
+		o.ObserveFloat64(rateOut, m.RateOut)
+		o.ObserveInt64(dropped, int64(m.DroppedEvents))
+		return nil
+	}, connected, known, streams, bytesIn, bytesOut, rateIn, rateOut, dropped)
+	return e
+}
+
+// 注销指标, 之后MeterProvider不再采集mp2p指标
+func (x *Exporter) Close() error {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	if x.registration == nil {
+		return nil
+	}
+	e := x.registration.Unregister()
+	x.registration = nil
+	return e
+}